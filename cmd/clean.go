@@ -0,0 +1,72 @@
+/*
+Copyright 2025 Lucas Chagas <lucas.w.chagas@gmail.com>
+*/
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/DiskMethod/cs2-voice-tools/internal/extract"
+	"github.com/spf13/cobra"
+)
+
+// dryRun lists the files clean would remove without removing them
+var dryRun bool
+
+// cleanCmd represents the clean command
+var cleanCmd = &cobra.Command{
+	Use:   "clean [flags]",
+	Short: "Remove files written by previous extractions from the output directory",
+	Long: `Remove files written by previous extractions from the output directory (-o).
+
+Only files matching the extract command's naming are removed: SteamID-named
+audio files in a supported format, playlist.m3u8, timeline.json, chat.json and
+the resume manifest. Any other file is left alone. You are asked to confirm
+unless --force is given.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		artifacts, err := extract.FindArtifacts(Opts.AbsOutputDir)
+		if err != nil {
+			return err
+		}
+
+		if len(artifacts) == 0 {
+			return printResult(artifacts, fmt.Sprintf("No extraction files found in %s", Opts.AbsOutputDir))
+		}
+
+		if dryRun {
+			return printResult(artifacts, strings.Join(artifacts, "\n"))
+		}
+
+		if !Opts.ForceOverwrite {
+			fmt.Fprintf(os.Stderr, "Remove %d files from %s? [y/N] ", len(artifacts), Opts.AbsOutputDir)
+			answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+			answer = strings.ToLower(strings.TrimSpace(answer))
+			if answer != "y" && answer != "yes" {
+				return fmt.Errorf("clean cancelled, no files removed")
+			}
+		}
+
+		removed := []string{}
+		for _, path := range artifacts {
+			if err := os.Remove(path); err != nil {
+				slog.Error("Failed to remove file", "path", path, "error", err)
+				continue
+			}
+			slog.Debug("Removed file", "path", path)
+			removed = append(removed, path)
+		}
+
+		return printResult(removed, fmt.Sprintf("Removed %d files from %s", len(removed), Opts.AbsOutputDir))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(cleanCmd)
+
+	cleanCmd.Flags().BoolVar(&dryRun, "dry-run", false, "list the files that would be removed without removing them")
+}
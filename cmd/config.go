@@ -0,0 +1,81 @@
+/*
+Copyright 2025 Lucas Chagas <lucas.w.chagas@gmail.com>
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// defaultConfigPath returns where the config file is looked for when --config is not given:
+// $XDG_CONFIG_HOME/cs2voice/config.yaml, or the platform's equivalent user config directory
+func defaultConfigPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "cs2voice", "config.yaml"), nil
+}
+
+// applyConfigFile reads the config file and uses its values for every flag of cmd that was
+// not given on the command line. Keys are the long flag names (e.g. "format", "bit-depth").
+// It returns the path of the file read, or "" when there is none. A missing default config
+// file is not an error; a missing --config file is.
+func applyConfigFile(cmd *cobra.Command) (string, error) {
+	path := Opts.ConfigFile
+	if path == "" {
+		defaultPath, err := defaultConfigPath()
+		if err != nil {
+			return "", nil
+		}
+		if _, err := os.Stat(defaultPath); errors.Is(err, os.ErrNotExist) {
+			return "", nil
+		}
+		path = defaultPath
+	}
+
+	config := viper.New()
+	config.SetConfigFile(path)
+	if err := config.ReadInConfig(); err != nil {
+		return "", fmt.Errorf("failed to read config file %s: %w", path, err)
+	}
+
+	var applyErr error
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if applyErr != nil || f.Changed || f.Name == "config" || !config.IsSet(f.Name) {
+			return
+		}
+
+		// Setting the value directly rather than through the flag set leaves the flag
+		// unchanged, so config values act as defaults and commands can still tell
+		// whether a flag was given on the command line
+		var err error
+		if slice, ok := f.Value.(pflag.SliceValue); ok {
+			err = slice.Replace(config.GetStringSlice(f.Name))
+		} else if list, ok := config.Get(f.Name).([]any); ok {
+			// A list for a comma-separated flag such as players
+			items := make([]string, len(list))
+			for i, item := range list {
+				items[i] = fmt.Sprint(item)
+			}
+			err = f.Value.Set(strings.Join(items, ","))
+		} else {
+			err = f.Value.Set(config.GetString(f.Name))
+		}
+		if err != nil {
+			applyErr = fmt.Errorf("invalid value for %q in config file %s: %w", f.Name, path, err)
+		}
+	})
+	if applyErr != nil {
+		return "", applyErr
+	}
+	return path, nil
+}
@@ -4,118 +4,565 @@ Copyright 2025 Lucas Chagas <lucas.w.chagas@gmail.com>
 package cmd
 
 import (
+	"bufio"
 	"fmt"
+	"io"
 	"log/slog"
+	"os"
+	"path/filepath"
 	"regexp"
 	"strings"
+	"time"
 
+	"github.com/DiskMethod/cs2-voice-tools/internal/decoder"
 	"github.com/DiskMethod/cs2-voice-tools/internal/extract"
 	"github.com/spf13/cobra"
 )
 
-var (
+// extractFlags holds the extract command's flag values, kept apart from cobra so
+// buildExtractOptions can turn them into ExtractOptions without running a command.
+type extractFlags struct {
 	// playerFilter is a comma-separated list of SteamID64s to filter by
 	playerFilter string
 
+	// playersFile is a path to a file with one SteamID64 per line
+	playersFile string
+
 	// formatOption specifies the output format for audio files
 	formatOption string
 
+	// lossModeOption selects how lost frames are filled (plc, silence, skip)
+	lossModeOption string
+
+	// maxConcealedFrames is the most lost frames per gap synthesized with PLC
+	maxConcealedFrames int
+
+	// silenceGaps writes signalled silence frames as zeros
+	silenceGaps bool
+
+	// preview decodes only this much audio per player
+	preview time.Duration
+
+	// httpTimeout limits demo downloads when the argument is a URL
+	httpTimeout time.Duration
+
+	// authHeader is sent with demo downloads when the argument is a URL
+	authHeader string
+
+	// demoEntry selects the demo inside a zip archive
+	demoEntry string
+
+	// minDuration skips players with less decoded speech than this
+	minDuration time.Duration
+
+	// keepEmpty writes players without any decodable audio as empty files
+	keepEmpty bool
+
+	// playlist writes an M3U8 playlist of the extracted files
+	playlist bool
+
+	// playlistOrder orders the playlist (name, duration)
+	playlistOrder string
+
+	// sortOutput orders players for processing and listing (steamid, name, talk-time)
+	sortOutput string
+
+	// flattenSampleRates decodes every player at flattenRate
+	flattenSampleRates bool
+
+	// flattenRate is the common sample rate used with flattenSampleRates
+	flattenRate int
+
+	// timeline writes a timeline.json index of talk-spurts
+	timeline bool
+
+	// manifest writes a manifest.json describing the extracted files
+	manifest bool
+	// manifestInlineLimit inlines files of up to this many bytes in the manifest (0 inlines none)
+	manifestInlineLimit int64
+
+	// packetCues marks each packet's samples as a cue region in the WAV
+	packetCues bool
+
+	// withChat writes the demo's text chat to chat.json
+	withChat bool
+
+	// wavInfo tags WAV outputs with a LIST/INFO chunk describing their provenance
+	wavInfo bool
+
+	// pipeFFmpeg pipes audio through ffmpeg instead of using temporary files
+	pipeFFmpeg bool
+
+	// jobs is the number of players decoded and written at once
+	jobs int
+
+	// ffmpegArgs are extra arguments passed through to ffmpeg
+	ffmpegArgs []string
+
+	// cacheDir caches parsed voice data between runs
+	cacheDir string
+
+	// resume skips players already extracted from the same packets
+	resume bool
+
+	// bitDepth is the sample size of WAV output
+	bitDepth int
+
+	// wavEncoder selects the WAV writer (go-audio, native)
+	wavEncoder string
+
+	// oggEncoder selects how ogg output is produced (ffmpeg, native)
+	oggEncoder string
+
+	// listFormats prints the supported formats and exits
+	listFormats bool
+
+	// headroom lowers the output level by this many dB
+	headroom float64
+
+	// gain raises the decoded voice by this many dB
+	gain int
+
+	// loudnessMatch gains every player to the same loudness
+	loudnessMatch bool
+
+	// loudnessTarget is the loudness, in dBFS, used by loudnessMatch
+	loudnessTarget float64
+
+	// mix writes every player mixed into one file
+	mix bool
+
+	// stdout writes the single player's WAV to stdout instead of a file
+	stdout bool
+
+	// mergeDuplicates merges voice sources that resolve to the same SteamID64
+	mergeDuplicates bool
+
+	// limitPlayers extracts only this many of the most active players
+	limitPlayers int
+
+	// fromScore extracts voice from when a team reaches a number of round wins
+	fromScore string
+
+	// mappingFile is a JSON or CSV file giving players their own output file name and format
+	mappingFile string
+
+	// mappingOnly extracts only the players in mappingFile
+	mappingOnly bool
+
+	// splitBySpurt writes each talk-spurt as its own numbered file
+	splitBySpurt bool
+
+	// perRound writes each round's voice as its own file
+	perRound bool
+
+	// roundFreezeTime counts freeze time as part of its round
+	roundFreezeTime bool
+
+	// compactTimeline shortens each file to its talk-spurts joined by compactGap of silence
+	compactTimeline bool
+
+	// compactGap is the silence compactTimeline puts between talk-spurts
+	compactGap time.Duration
+
+	// tickRangeOption extracts only voice packets that arrived within START:END ticks
+	tickRangeOption string
+
+	// aliveOnly extracts only voice sent while the player was alive
+	aliveOnly bool
+
+	// deadOnly extracts only voice sent while the player was dead
+	deadOnly bool
+
+	// includeBots extracts voice from bots and SourceTV as well as real players
+	includeBots bool
+
+	// keyByUserID keys outputs and --players by the demo's user ID instead of SteamID64
+	keyByUserID bool
+
+	// showProgress prints the parse progress to stderr
+	showProgress bool
+
+	// formatChanged is true when --format was given explicitly
+	formatChanged bool
+}
+
+var (
+	// extractArgs receives the extract command's flags
+	extractArgs extractFlags
+
 	// steamID64Regex is the regular expression for validating SteamID64 format
 	// SteamID64 should be a 17-digit number starting with 7656
 	steamID64Regex = regexp.MustCompile(`^7656\d{13}$`)
+
+	// userIDRegex is the regular expression for validating a demo user ID
+	userIDRegex = regexp.MustCompile(`^\d{1,10}$`)
 )
 
-// extractCmd represents the extract command
-var extractCmd = &cobra.Command{
-	Use:   "extract [flags] <demo-file>",
-	Short: "Extract voice data from a CS2 demo",
-	Args:  cobra.ExactArgs(1),
-	RunE: func(cmd *cobra.Command, args []string) error {
-		demoPath := args[0]
-
-		// Parse player filter if provided
-		var playerIDs []string
-		var invalidIDs []string
-
-		if playerFilter != "" {
-			// Split the comma-separated list and trim whitespace
-			for _, id := range strings.Split(playerFilter, ",") {
-				// Trim whitespace and ensure non-empty
-				id = strings.TrimSpace(id)
-				if id == "" {
-					continue
-				}
-
-				// Validate SteamID64 format
-				if !steamID64Regex.MatchString(id) {
-					slog.Warn("Invalid SteamID64 format, skipping", "id", id)
-					invalidIDs = append(invalidIDs, id)
-					continue
-				}
-
-				playerIDs = append(playerIDs, id)
+// readPlayersFile reads newline-separated SteamID64s from path, relative to the working directory.
+// Blank lines and lines starting with # are ignored; validation is left to the caller.
+func readPlayersFile(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("players file not found: %s", path)
+		}
+		return nil, fmt.Errorf("failed to open players file '%s': %w", path, err)
+	}
+	defer file.Close()
+
+	var ids []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		ids = append(ids, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read players file '%s': %w", path, err)
+	}
+
+	return ids, nil
+}
+
+// formatListing is one entry of --list-formats.
+type formatListing struct {
+	Format string `json:"format"`
+	// Native is true when the format is written without ffmpeg
+	Native bool `json:"native"`
+}
+
+// printFormats lists the supported formats and whether each needs ffmpeg.
+func printFormats() error {
+	native := make(map[string]bool)
+	for _, format := range extract.GetNativeFormats(extractArgs.oggEncoder) {
+		native[format] = true
+	}
+
+	var listings []formatListing
+	var text strings.Builder
+	for _, format := range extract.GetSupportedFormats() {
+		listings = append(listings, formatListing{Format: format, Native: native[format]})
+		encoder := "ffmpeg"
+		if native[format] {
+			encoder = "native"
+		}
+		fmt.Fprintf(&text, "%-5s %s\n", format, encoder)
+	}
+	return printResult(listings, strings.TrimSuffix(text.String(), "\n"))
+}
+
+// buildExtractOptions turns the extract command's flag values into ExtractOptions. It parses and
+// validates the player filter, players file, format, loss mode and output mapping, and resolves an
+// output path that names a file rather than a directory. Nothing is extracted.
+func buildExtractOptions(demoPath string, f extractFlags, globals Options) (extract.ExtractOptions, error) {
+	// Collect player IDs from the comma-separated list and the roster file
+	var candidateIDs []string
+	if f.playerFilter != "" {
+		candidateIDs = append(candidateIDs, strings.Split(f.playerFilter, ",")...)
+	}
+	if f.playersFile != "" {
+		fileIDs, err := readPlayersFile(f.playersFile)
+		if err != nil {
+			return extract.ExtractOptions{}, err
+		}
+		candidateIDs = append(candidateIDs, fileIDs...)
+	}
+
+	// Parse player filter if provided
+	var playerIDs []string
+	var invalidIDs []string
+	seenIDs := make(map[string]bool)
+
+	if len(candidateIDs) > 0 {
+		for _, id := range candidateIDs {
+			// Trim whitespace and ensure non-empty
+			id = strings.TrimSpace(id)
+			if id == "" || seenIDs[id] {
+				continue
 			}
+			seenIDs[id] = true
 
-			// Warn if no valid IDs were provided
-			if len(playerIDs) == 0 && len(invalidIDs) > 0 {
-				return fmt.Errorf("no valid SteamID64s provided, received: %s", strings.Join(invalidIDs, ", "))
+			// Validate SteamID64 format, or user ID format when keying by user ID
+			if f.keyByUserID && !userIDRegex.MatchString(id) {
+				slog.Warn("Invalid user ID format, skipping", "id", id)
+				invalidIDs = append(invalidIDs, id)
+				continue
 			}
+			if !f.keyByUserID && !steamID64Regex.MatchString(id) {
+				slog.Warn("Invalid SteamID64 format, skipping", "id", id)
+				invalidIDs = append(invalidIDs, id)
+				continue
+			}
+
+			playerIDs = append(playerIDs, id)
+		}
+
+		// Warn if no valid IDs were provided
+		if len(playerIDs) == 0 && len(invalidIDs) > 0 {
+			if f.keyByUserID {
+				return extract.ExtractOptions{}, fmt.Errorf("no valid user IDs provided, received: %s", strings.Join(invalidIDs, ", "))
+			}
+			return extract.ExtractOptions{}, fmt.Errorf("no valid SteamID64s provided, received: %s", strings.Join(invalidIDs, ", "))
+		}
+	}
+
+	// Stdout carries the audio, so it can hold neither more than one output nor the JSON result
+	var outputWriter io.Writer
+	if f.stdout {
+		if len(playerIDs) != 1 && !f.mix {
+			return extract.ExtractOptions{}, fmt.Errorf("--stdout requires exactly one player selected with --players, or --mix (got %d players)", len(playerIDs))
+		}
+		if globals.OutputFormat == "json" {
+			return extract.ExtractOptions{}, fmt.Errorf("--stdout cannot be combined with --output-format json, since stdout carries the audio")
+		}
+		outputWriter = os.Stdout
+	}
+
+	// An output path with an audio extension is treated as the output file itself
+	outputDir := globals.AbsOutputDir
+	var outputFile string
+	formatOption := f.formatOption
+	if extract.HasAudioExtension(outputDir) {
+		if len(playerIDs) != 1 && !f.mix {
+			return extract.ExtractOptions{}, fmt.Errorf("output path %s looks like a file name; pass a directory to --output-dir, select exactly one player with --players, or use --mix to write a single file", globals.OutputDir)
 		}
+		outputFile = outputDir
+		outputDir = filepath.Dir(outputFile)
+
+		// Infer the format from the file name unless it was given explicitly
+		if !f.formatChanged {
+			formatOption = strings.TrimPrefix(filepath.Ext(outputFile), ".")
+		}
+	}
+
+	// Validate the format, accepting a leading dot, any casing and common aliases
+	format, err := extract.NormalizeFormat(formatOption)
+	if err != nil {
+		return extract.ExtractOptions{}, err
+	}
+	if format == "" {
+		// Default to WAV if no format specified
+		format = "wav"
+	}
 
-		// Validate format option
-		format := strings.ToLower(formatOption)
-		isFormatValid := false
-
-		if format == "" {
-			// Default to WAV if no format specified
-			format = "wav"
-			isFormatValid = true
-		} else {
-			// Check if the format is supported
-			for _, supportedFormat := range extract.GetSupportedFormats() {
-				if format == supportedFormat {
-					isFormatValid = true
-					break
-				}
+	// Parse the loss concealment mode
+	lossMode, err := decoder.ParseLossConcealment(strings.ToLower(f.lossModeOption))
+	if err != nil {
+		return extract.ExtractOptions{}, err
+	}
+
+	// Zero would silently mean the default; filling whole gaps with silence is its own loss mode
+	if f.maxConcealedFrames < 1 {
+		return extract.ExtractOptions{}, fmt.Errorf("invalid --max-concealed-frames: %d (expected 1 or more; use --loss-mode silence to fill gaps with silence only)", f.maxConcealedFrames)
+	}
+
+	// A common sample rate only applies when flattening
+	var targetSampleRate int
+	if f.flattenSampleRates {
+		targetSampleRate = f.flattenRate
+	}
+
+	// Load the per-player output mapping, rejecting keys that cannot match a player
+	var outputMapping map[string]extract.PlayerOutput
+	if f.mappingFile != "" {
+		outputMapping, err = extract.LoadOutputMapping(f.mappingFile)
+		if err != nil {
+			return extract.ExtractOptions{}, err
+		}
+		for id := range outputMapping {
+			if f.keyByUserID && !userIDRegex.MatchString(id) {
+				return extract.ExtractOptions{}, fmt.Errorf("invalid user ID in output mapping: %s", id)
+			}
+			if !f.keyByUserID && !steamID64Regex.MatchString(id) {
+				return extract.ExtractOptions{}, fmt.Errorf("invalid SteamID64 in output mapping: %s", id)
 			}
 		}
+	}
+
+	// Create extract options from command-line arguments
+	options := extract.ExtractOptions{
+		DemoPath:              demoPath,
+		DemoEntry:             f.demoEntry,
+		HTTPTimeout:           f.httpTimeout,
+		HTTPAuthHeader:        f.authHeader,
+		OutputDir:             outputDir,
+		OutputFile:            outputFile,
+		ForceOverwrite:        globals.ForceOverwrite,
+		FileMode:              globals.FileMode,
+		DirMode:               globals.DirMode,
+		PlayerIDs:             playerIDs,
+		Format:                format,
+		IncludeBots:           f.includeBots,
+		MergeDuplicateSources: f.mergeDuplicates,
+		KeyByUserID:           f.keyByUserID,
+		MaxPlayers:            f.limitPlayers,
+		FromScore:             f.fromScore,
+		TickRange:             f.tickRangeOption,
+		AliveOnly:             f.aliveOnly,
+		DeadOnly:              f.deadOnly,
+		Headroom:              f.headroom,
+		Gain:                  f.gain,
+		BitDepth:              f.bitDepth,
+		WAVEncoder:            f.wavEncoder,
+		OggEncoder:            f.oggEncoder,
+		LoudnessMatch:         f.loudnessMatch,
+		Mix:                   f.mix,
+		OutputWriter:          outputWriter,
+		LoudnessTarget:        f.loudnessTarget,
+		Resume:                f.resume,
+		Playlist:              f.playlist,
+		PlaylistOrder:         f.playlistOrder,
+		SortBy:                f.sortOutput,
+		PipeFFmpeg:            f.pipeFFmpeg,
+		Jobs:                  f.jobs,
+		FFmpegExtraArgs:       f.ffmpegArgs,
+		Timeline:              f.timeline,
+		Manifest:              f.manifest,
+		ManifestInlineLimit:   f.manifestInlineLimit,
+		PacketCues:            f.packetCues,
+		WithChat:              f.withChat,
+		WAVInfo:               f.wavInfo,
+		TargetSampleRate:      targetSampleRate,
+		MinDuration:           f.minDuration,
+		KeepEmpty:             f.keepEmpty,
+		SplitBySpurt:          f.splitBySpurt,
+		PerRound:              f.perRound,
+		RoundFreezeTime:       f.roundFreezeTime,
+		CompactTimeline:       f.compactTimeline,
+		CompactGap:            f.compactGap,
+		OutputMapping:         outputMapping,
+		MappingOnly:           f.mappingOnly,
+		CacheDir:              f.cacheDir,
+		LossConcealment:       lossMode,
+		MaxConcealedFrames:    f.maxConcealedFrames,
+		SilenceGaps:           f.silenceGaps,
+		Preview:               f.preview,
+	}
+
+	if f.showProgress {
+		options.Progress = printProgress
+	}
 
-		if !isFormatValid {
-			return fmt.Errorf("unsupported format: %s (supported formats: %s)",
-				format, strings.Join(extract.GetSupportedFormats(), ", "))
+	return options, nil
+}
+
+// extractCmd represents the extract command
+var extractCmd = &cobra.Command{
+	Use:   "extract [flags] <demo-file|demo-zip|demo-url|->",
+	Short: "Extract voice data from a CS2 demo",
+	Args: func(cmd *cobra.Command, args []string) error {
+		if extractArgs.listFormats {
+			return nil
+		}
+		return cobra.ExactArgs(1)(cmd, args)
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if extractArgs.listFormats {
+			return printFormats()
 		}
 
-		// Create extract options from command-line arguments
-		options := extract.ExtractOptions{
-			DemoPath:       demoPath,
-			OutputDir:      Opts.AbsOutputDir,
-			ForceOverwrite: Opts.ForceOverwrite,
-			PlayerIDs:      playerIDs,
-			Format:         format,
+		extractArgs.formatChanged = cmd.Flags().Changed("format")
+		options, err := buildExtractOptions(args[0], extractArgs, Opts)
+		if err != nil {
+			return err
 		}
 
 		// Extract voice data with the configured options
-		if err := extract.ExtractVoiceData(options); err != nil {
+		result, err := extract.ExtractVoiceData(options)
+		if err != nil {
 			return err
 		}
+		if options.OutputWriter != nil {
+			// Stdout holds the audio; the summary goes to the log on stderr
+			slog.Info("Voice data extraction complete, audio written to stdout", "files", len(result.Files))
+			return nil
+		}
 
-		msg := fmt.Sprintf("Voice data extraction complete. Files saved to: %s", Opts.AbsOutputDir)
-		if len(playerIDs) > 0 {
-			msg += fmt.Sprintf(" (filtered to %d players)", len(playerIDs))
+		msg := fmt.Sprintf("Voice data extraction complete. Files saved to: %s", options.OutputDir)
+		if options.OutputFile != "" {
+			msg = fmt.Sprintf("Voice data extraction complete. File saved to: %s", options.OutputFile)
 		}
-		if format != "wav" {
-			msg += fmt.Sprintf(" (format: %s)", format)
+		if len(options.PlayerIDs) > 0 {
+			msg += fmt.Sprintf(" (filtered to %d players)", len(options.PlayerIDs))
 		}
-		fmt.Println(msg)
-		return nil
+		if options.Format != "wav" {
+			msg += fmt.Sprintf(" (format: %s)", options.Format)
+		}
+		return printResult(result, msg)
 	},
 }
 
+// printProgress shows the parse progress on a single stderr line, ending it once parsing completes.
+func printProgress(fraction float64) {
+	fmt.Fprintf(os.Stderr, "\rParsing demo: %3.0f%%", fraction*100)
+	if fraction >= 1 {
+		fmt.Fprintln(os.Stderr)
+	}
+}
+
 func init() {
 	rootCmd.AddCommand(extractCmd)
 
 	// Add command-specific flags
-	extractCmd.Flags().StringVarP(&playerFilter, "players", "p", "", "filter to specific players by steamID64 (comma-separated list)")
-	extractCmd.Flags().StringVarP(&formatOption, "format", "t", "wav",
+	extractCmd.Flags().StringVarP(&extractArgs.playerFilter, "players", "p", "", "filter to specific players by steamID64 (comma-separated list)")
+	extractCmd.Flags().StringVar(&extractArgs.playersFile, "players-file", "", "read SteamID64s to filter by from a file (one per line, # for comments)")
+	extractCmd.Flags().StringVarP(&extractArgs.formatOption, "format", "t", "wav",
 		fmt.Sprintf("output audio format (%s)", strings.Join(extract.GetSupportedFormats(), ", ")))
+	extractCmd.Flags().StringVar(&extractArgs.lossModeOption, "loss-mode", "plc",
+		"how to fill lost frames: plc (synthesized), silence (zero-fill) or skip (drop, shifts timing)")
+	extractCmd.Flags().IntVar(&extractArgs.maxConcealedFrames, "max-concealed-frames", decoder.DefaultMaxConcealedFrames,
+		"with --loss-mode plc, the most lost frames per gap synthesized by the decoder; the rest of a gap is silence")
+	extractCmd.Flags().DurationVar(&extractArgs.preview, "preview", 0, "decode only this much audio per player (e.g. 10s) and write it as a .preview sample clip")
+	extractCmd.Flags().BoolVar(&extractArgs.silenceGaps, "silence-gaps", false, "write the frames signalled by silence packets as zeros, keeping pauses within a transmission")
+	extractCmd.Flags().StringVar(&extractArgs.demoEntry, "demo-entry", "", "name of the .dem entry to read when the input is a zip archive (default: first .dem)")
+	extractCmd.Flags().DurationVar(&extractArgs.httpTimeout, "http-timeout", 0, "time limit for downloading a demo URL, including the body (0 = no limit)")
+	extractCmd.Flags().StringVar(&extractArgs.authHeader, "auth-header", "", "header sent when downloading a demo URL, as 'Name: value'")
+	extractCmd.Flags().StringVar(&extractArgs.cacheDir, "cache-dir", "", "cache parsed voice data here, keyed by demo content hash, so repeat runs skip parsing")
+	extractCmd.Flags().BoolVar(&extractArgs.resume, "resume", false, "skip players whose output was already produced from the same demo data (tracked in the output directory)")
+	extractCmd.Flags().DurationVar(&extractArgs.minDuration, "min-duration", 0, "skip players with less decoded speech than this (e.g. 2s); concealment and silence don't count")
+	extractCmd.Flags().BoolVar(&extractArgs.keepEmpty, "keep-empty", false, "write players whose packets decode to no audio as empty files instead of skipping them")
+	extractCmd.Flags().BoolVar(&extractArgs.playlist, "playlist", false, "write a playlist.m3u8 of the extracted files to the output directory")
+	extractCmd.Flags().StringVar(&extractArgs.playlistOrder, "playlist-order", "name", "playlist ordering: name or duration (longest first)")
+	extractCmd.Flags().StringVar(&extractArgs.sortOutput, "sort-output", extract.SortBySteamID,
+		"order players are processed and listed in: steamid, name or talk-time (most voice packets first)")
+	extractCmd.Flags().BoolVar(&extractArgs.flattenSampleRates, "flatten-sample-rates", false, "write every output at the same sample rate (see --flatten-rate)")
+	extractCmd.Flags().IntVar(&extractArgs.flattenRate, "flatten-rate", 48000, "sample rate used by --flatten-sample-rates (8000, 12000, 16000, 24000 or 48000)")
+	extractCmd.Flags().BoolVar(&extractArgs.timeline, "timeline", false, "write a timeline.json indexing every talk-spurt with its demo time and sample range")
+	extractCmd.Flags().BoolVar(&extractArgs.manifest, "manifest", false, "write a manifest.json listing every extracted file with its player, format, duration and packet count")
+	extractCmd.Flags().Int64Var(&extractArgs.manifestInlineLimit, "manifest-inline-limit", 0, "inline each file of at most this many bytes in manifest.json as base64 (0 inlines none; requires --manifest)")
+	extractCmd.Flags().BoolVar(&extractArgs.packetCues, "packet-cues", false, "mark each voice packet's samples as a cue region in the WAV output (debugging aid)")
+	extractCmd.Flags().BoolVar(&extractArgs.wavInfo, "wav-info", false, "tag WAV outputs with the player's SteamID64 and name, the demo name and the extraction time (LIST/INFO chunk)")
+	extractCmd.Flags().BoolVar(&extractArgs.withChat, "with-chat", false, "also write the demo's text chat (player, team, time, message) to chat.json")
+	extractCmd.Flags().StringArrayVar(&extractArgs.ffmpegArgs, "ffmpeg-arg", nil, "extra argument passed to ffmpeg before the output file (repeatable)")
+	extractCmd.Flags().IntVar(&extractArgs.bitDepth, "bit-depth", 32, "bits per sample of WAV output: 16, 24 or 32")
+	extractCmd.Flags().StringVar(&extractArgs.wavEncoder, "wav-encoder", extract.WAVEncoderGoAudio, "WAV writer: go-audio or native (writes the chunks directly)")
+	extractCmd.Flags().StringVar(&extractArgs.oggEncoder, "ogg-encoder", extract.OggEncoderFFmpeg, "ogg output: ffmpeg (Vorbis) or native (Opus, needs no ffmpeg)")
+	extractCmd.Flags().BoolVar(&extractArgs.listFormats, "list-formats", false, "list the supported output formats and whether each needs ffmpeg, then exit")
+	extractCmd.Flags().IntVar(&extractArgs.gain, "gain", 0, "raise the decoded voice by this many dB, or lower it when negative (-128 to 127), before clipping")
+	extractCmd.Flags().Float64Var(&extractArgs.headroom, "headroom", 0, "lower the output level by this many dB (e.g. 3) so full-scale voice stays below clipping")
+	extractCmd.Flags().BoolVar(&extractArgs.loudnessMatch, "loudness-match", false, "gain every player to the same loudness so the files play back balanced (holds all audio in memory)")
+	extractCmd.Flags().BoolVar(&extractArgs.stdout, "stdout", false, "write the WAV of the one selected player (or the --mix) to stdout instead of a file, for piping into other tools")
+	extractCmd.Flags().BoolVar(&extractArgs.mix, "mix", false, "write one file (mixed.<format>) with every player's voice overlapped at its demo time instead of a file per player")
+	extractCmd.Flags().Float64Var(&extractArgs.loudnessTarget, "loudness-target", -20, "loudness in dBFS used by --loudness-match")
+	extractCmd.Flags().BoolVar(&extractArgs.mergeDuplicates, "merge-duplicates", false, "merge voice sources that resolve to the same SteamID64 (e.g. a bot placeholder and the real xuid) into one file")
+	extractCmd.Flags().BoolVar(&extractArgs.pipeFFmpeg, "pipe-ffmpeg", false, "pipe audio through ffmpeg's stdin/stdout instead of temporary WAV files (m4a still uses a file)")
+	extractCmd.Flags().IntVarP(&extractArgs.jobs, "jobs", "j", 0, "number of players to decode and write at once (default: one per CPU)")
+	extractCmd.Flags().IntVar(&extractArgs.limitPlayers, "limit-players", 0, "extract only the N players with the most voice packets (ignored with --players)")
+	extractCmd.Flags().StringVar(&extractArgs.fromScore, "from-score", "", "extract only from when a team first reaches this many round wins to the end, as <team>=<wins> (team: any, ct, t or a clan name)")
+	extractCmd.Flags().StringVar(&extractArgs.mappingFile, "mapping", "", "JSON or CSV file mapping SteamID64s to an output file name and optional format (player,file[,format])")
+	extractCmd.Flags().BoolVar(&extractArgs.mappingOnly, "mapping-only", false, "extract only the players listed in --mapping")
+	extractCmd.Flags().BoolVar(&extractArgs.splitBySpurt, "split-by-spurt", false, "write each talk-spurt (split at pauses over 500ms) as its own numbered file, e.g. <player>_001.wav; --min-duration then drops short spurts")
+	extractCmd.Flags().BoolVar(&extractArgs.perRound, "per-round", false, "write each player's voice from every round as its own file, e.g. <player>_round03.wav; voice between rounds goes to round00")
+	extractCmd.Flags().BoolVar(&extractArgs.roundFreezeTime, "round-freeze-time", false, "with --per-round, count freeze time as part of its round instead of between rounds")
+	extractCmd.Flags().BoolVar(&extractArgs.compactTimeline, "compact-timeline", false, "shorten each file to its talk-spurts, in order, separated by --compact-gap of silence")
+	extractCmd.Flags().DurationVar(&extractArgs.compactGap, "compact-gap", 750*time.Millisecond, "silence put between talk-spurts by --compact-timeline")
+	extractCmd.Flags().StringVar(&extractArgs.tickRangeOption, "tick-range", "", "extract only voice packets that arrived between two server ticks, as START:END (inclusive)")
+	extractCmd.Flags().BoolVar(&extractArgs.aliveOnly, "alive-only", false, "extract only voice sent while the player was alive (warmup and between rounds count as alive)")
+	extractCmd.Flags().BoolVar(&extractArgs.deadOnly, "dead-only", false, "extract only voice sent while the player was dead, from their death to the end of the round")
+	extractCmd.Flags().BoolVar(&extractArgs.keyByUserID, "key-by-user-id", false, "name outputs by the demo's user ID instead of SteamID64 (bots get a file each); --players then takes user IDs")
+	extractCmd.Flags().BoolVar(&extractArgs.showProgress, "progress", false, "print the demo parse progress to stderr")
+	extractCmd.Flags().BoolVar(&extractArgs.includeBots, "include-bots", false, "also extract voice from bots and SourceTV (skipped by default)")
 }
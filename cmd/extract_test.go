@@ -0,0 +1,203 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/DiskMethod/cs2-voice-tools/internal/decoder"
+	"github.com/DiskMethod/cs2-voice-tools/internal/extract"
+)
+
+const (
+	testPlayer  = "76561198000000001"
+	otherPlayer = "76561198000000002"
+)
+
+// testExtractFlags returns the flag values of a plain "cs2voice extract" run.
+func testExtractFlags() extractFlags {
+	return extractFlags{formatOption: "wav", lossModeOption: "plc", maxConcealedFrames: decoder.DefaultMaxConcealedFrames}
+}
+
+// testGlobals returns global options writing text output to dir.
+func testGlobals(dir string) Options {
+	return Options{OutputDir: dir, AbsOutputDir: dir, OutputFormat: "text"}
+}
+
+func TestBuildExtractOptions(t *testing.T) {
+	dir := t.TempDir()
+
+	for _, tt := range []struct {
+		name    string
+		flags   func(*extractFlags)
+		globals func(*Options)
+		check   func(*testing.T, extract.ExtractOptions)
+	}{
+		{
+			name: "defaults",
+			check: func(t *testing.T, opts extract.ExtractOptions) {
+				if opts.Format != "wav" || opts.OutputDir != dir || opts.OutputFile != "" || opts.OutputWriter != nil {
+					t.Errorf("Format %q, OutputDir %q, OutputFile %q; want wav into %s", opts.Format, opts.OutputDir, opts.OutputFile, dir)
+				}
+				if opts.LossConcealment != decoder.LossPLC || opts.TargetSampleRate != 0 || opts.PlayerIDs != nil {
+					t.Errorf("LossConcealment %v, TargetSampleRate %d, PlayerIDs %v", opts.LossConcealment, opts.TargetSampleRate, opts.PlayerIDs)
+				}
+			},
+		},
+		{
+			name: "player filter is trimmed and deduplicated, skipping invalid IDs",
+			flags: func(f *extractFlags) {
+				f.playerFilter = " " + testPlayer + ",123," + otherPlayer + ",," + testPlayer
+			},
+			check: func(t *testing.T, opts extract.ExtractOptions) {
+				if want := []string{testPlayer, otherPlayer}; !slices.Equal(opts.PlayerIDs, want) {
+					t.Errorf("PlayerIDs = %v, want %v", opts.PlayerIDs, want)
+				}
+			},
+		},
+		{
+			name: "user IDs when keying by user ID",
+			flags: func(f *extractFlags) {
+				f.keyByUserID = true
+				f.playerFilter = "3," + testPlayer + ",12"
+			},
+			check: func(t *testing.T, opts extract.ExtractOptions) {
+				if want := []string{"3", "12"}; !slices.Equal(opts.PlayerIDs, want) || !opts.KeyByUserID {
+					t.Errorf("PlayerIDs = %v, KeyByUserID %v; want %v, true", opts.PlayerIDs, opts.KeyByUserID, want)
+				}
+			},
+		},
+		{
+			name:  "stdout with one player",
+			flags: func(f *extractFlags) { f.stdout, f.playerFilter = true, testPlayer },
+			check: func(t *testing.T, opts extract.ExtractOptions) {
+				if opts.OutputWriter != os.Stdout {
+					t.Errorf("OutputWriter is not stdout")
+				}
+			},
+		},
+		{
+			name:  "stdout with a mix",
+			flags: func(f *extractFlags) { f.stdout, f.mix = true, true },
+			check: func(t *testing.T, opts extract.ExtractOptions) {
+				if opts.OutputWriter != os.Stdout || !opts.Mix {
+					t.Errorf("OutputWriter is not stdout, or Mix is unset")
+				}
+			},
+		},
+		{
+			name:    "output file infers the format",
+			flags:   func(f *extractFlags) { f.playerFilter = testPlayer },
+			globals: func(g *Options) { g.AbsOutputDir = filepath.Join(dir, "comms.MP3") },
+			check: func(t *testing.T, opts extract.ExtractOptions) {
+				if opts.OutputFile != filepath.Join(dir, "comms.MP3") || opts.OutputDir != dir || opts.Format != "mp3" {
+					t.Errorf("OutputFile %q, OutputDir %q, Format %q", opts.OutputFile, opts.OutputDir, opts.Format)
+				}
+			},
+		},
+		{
+			name: "explicit format wins over the output file extension",
+			flags: func(f *extractFlags) {
+				f.mix, f.formatOption, f.formatChanged = true, "flac", true
+			},
+			globals: func(g *Options) { g.AbsOutputDir = filepath.Join(dir, "mix.wav") },
+			check: func(t *testing.T, opts extract.ExtractOptions) {
+				if opts.OutputFile != filepath.Join(dir, "mix.wav") || opts.Format != "flac" {
+					t.Errorf("OutputFile %q, Format %q", opts.OutputFile, opts.Format)
+				}
+			},
+		},
+		{
+			name:  "format aliases and loss mode casing",
+			flags: func(f *extractFlags) { f.formatOption, f.lossModeOption = ".OGG", "Silence" },
+			check: func(t *testing.T, opts extract.ExtractOptions) {
+				if opts.Format != "ogg" || opts.LossConcealment != decoder.LossSilence {
+					t.Errorf("Format %q, LossConcealment %v", opts.Format, opts.LossConcealment)
+				}
+			},
+		},
+		{
+			name:  "concealed frames per gap",
+			flags: func(f *extractFlags) { f.maxConcealedFrames = 25 },
+			check: func(t *testing.T, opts extract.ExtractOptions) {
+				if opts.MaxConcealedFrames != 25 {
+					t.Errorf("MaxConcealedFrames = %d, want 25", opts.MaxConcealedFrames)
+				}
+			},
+		},
+		{
+			name:  "sample rate only when flattening",
+			flags: func(f *extractFlags) { f.flattenRate = 16000 },
+			check: func(t *testing.T, opts extract.ExtractOptions) {
+				if opts.TargetSampleRate != 0 {
+					t.Errorf("TargetSampleRate = %d without flattening", opts.TargetSampleRate)
+				}
+			},
+		},
+		{
+			name:  "flattened sample rate",
+			flags: func(f *extractFlags) { f.flattenSampleRates, f.flattenRate = true, 16000 },
+			check: func(t *testing.T, opts extract.ExtractOptions) {
+				if opts.TargetSampleRate != 16000 {
+					t.Errorf("TargetSampleRate = %d, want 16000", opts.TargetSampleRate)
+				}
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			f, globals := testExtractFlags(), testGlobals(dir)
+			if tt.flags != nil {
+				tt.flags(&f)
+			}
+			if tt.globals != nil {
+				tt.globals(&globals)
+			}
+			opts, err := buildExtractOptions("demo.dem", f, globals)
+			if err != nil {
+				t.Fatalf("buildExtractOptions: %v", err)
+			}
+			if opts.DemoPath != "demo.dem" {
+				t.Errorf("DemoPath = %q", opts.DemoPath)
+			}
+			tt.check(t, opts)
+		})
+	}
+}
+
+func TestBuildExtractOptionsRejectsConflicts(t *testing.T) {
+	dir := t.TempDir()
+
+	for _, tt := range []struct {
+		name    string
+		flags   func(*extractFlags)
+		globals func(*Options)
+		// want is part of the expected error message
+		want string
+	}{
+		{"only invalid SteamID64s", func(f *extractFlags) { f.playerFilter = "123,abc" }, nil, "no valid SteamID64s"},
+		{"only invalid user IDs", func(f *extractFlags) { f.keyByUserID, f.playerFilter = true, "abc" }, nil, "no valid user IDs"},
+		{"stdout without a single player", func(f *extractFlags) { f.stdout, f.playerFilter = true, testPlayer+","+otherPlayer }, nil, "--stdout requires"},
+		{"stdout with JSON output", func(f *extractFlags) { f.stdout, f.playerFilter = true, testPlayer }, func(g *Options) { g.OutputFormat = "json" }, "--output-format json"},
+		{"output file for several players", nil, func(g *Options) { g.AbsOutputDir = filepath.Join(dir, "out.wav") }, "looks like a file name"},
+		{"unknown format", func(f *extractFlags) { f.formatOption = "xyz" }, nil, "invalid audio format"},
+		{"unknown loss mode", func(f *extractFlags) { f.lossModeOption = "guess" }, nil, "guess"},
+		{"no concealed frames", func(f *extractFlags) { f.maxConcealedFrames = 0 }, nil, "--loss-mode silence"},
+		{"missing players file", func(f *extractFlags) { f.playersFile = filepath.Join(dir, "missing.txt") }, nil, "missing.txt"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			f, globals := testExtractFlags(), testGlobals(dir)
+			if tt.flags != nil {
+				tt.flags(&f)
+			}
+			if tt.globals != nil {
+				tt.globals(&globals)
+			}
+			_, err := buildExtractOptions("demo.dem", f, globals)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
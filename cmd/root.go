@@ -4,11 +4,16 @@ Copyright 2025 Lucas Chagas <lucas.w.chagas@gmail.com>
 package cmd
 
 import (
+	"encoding/json"
+	"fmt"
 	"io"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 
+	"github.com/DiskMethod/cs2-voice-tools/internal/extract"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 )
@@ -28,11 +33,40 @@ type Options struct {
 	// ForceOverwrite when true allows overwriting existing files
 	// When false (default), operations will fail if files already exist
 	ForceOverwrite bool
+
+	// OutputFormat selects how commands print their result: "text" or "json"
+	// Logs always go to stderr, so JSON on stdout stays machine-readable
+	OutputFormat string
+
+	// ConfigFile is the config file given with --config
+	// When empty, the default location is used if a file exists there
+	ConfigFile string
+
+	// FileMode and DirMode are the permissions of written files and created directories
+	// These are parsed from --file-mode and --dir-mode during command execution
+	FileMode os.FileMode
+	DirMode  os.FileMode
 }
 
 // Opts is the global options instance used by all commands
 var Opts Options
 
+// Version is the release version of the binary
+// Set at build time with -ldflags "-X github.com/DiskMethod/cs2-voice-tools/cmd.Version=v1.2.3"
+var Version = "dev"
+
+// fileModeOption and dirModeOption are the octal --file-mode and --dir-mode values
+var fileModeOption, dirModeOption string
+
+// parseMode parses octal permissions such as 0644, rejecting anything beyond the permission bits.
+func parseMode(flag, value string) (os.FileMode, error) {
+	mode, err := strconv.ParseUint(strings.TrimPrefix(value, "0o"), 8, 32)
+	if err != nil || os.FileMode(mode)&^os.ModePerm != 0 {
+		return 0, fmt.Errorf("invalid %s: %s (expected octal permissions such as 0644)", flag, value)
+	}
+	return os.FileMode(mode), nil
+}
+
 // verbose is a package-private variable for backward compatibility with direct flag binding
 // All new code should use Opts.Verbose or IsVerbose() instead
 var verbose bool
@@ -67,12 +101,36 @@ func resolveOutputDir() error {
 		Opts.AbsOutputDir = Opts.OutputDir
 	}
 
-	// Create the directory if it doesn't exist
-	if err := os.MkdirAll(Opts.AbsOutputDir, 0755); err != nil { // Using 0755 (rwxr-xr-x) for directory permissions
+	// A path that looks like an audio file is left for the command to interpret
+	if extract.HasAudioExtension(Opts.AbsOutputDir) {
+		return nil
+	}
+
+	// Create the directory if it doesn't exist, with exactly --dir-mode regardless of the umask
+	if _, err := os.Stat(Opts.AbsOutputDir); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(Opts.AbsOutputDir, Opts.DirMode); err != nil {
 		return err
 	}
 
-	return nil
+	return os.Chmod(Opts.AbsOutputDir, Opts.DirMode)
+}
+
+// printResult writes a command's primary result to stdout, as the text message
+// or, with --output-format json, as the JSON encoding of v
+func printResult(v any, text string) error {
+	switch Opts.OutputFormat {
+	case "", "text":
+		fmt.Println(text)
+		return nil
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(v)
+	default:
+		return fmt.Errorf("unsupported output format: %s (expected text or json)", Opts.OutputFormat)
+	}
 }
 
 // Default logger that other packages can import
@@ -101,6 +159,10 @@ var rootCmd = &cobra.Command{
 	Long: `cs2-voice-tools is a single binary that provides sub-commands to
 extract, transcribe, and analyse player voice data from CS2 demo files.`,
 	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		// Fill in flags not given on the command line from the config file first,
+		// so settings such as verbose apply to everything below
+		configPath, configErr := applyConfigFile(cmd)
+
 		// Set up logging based on verbose flag
 		logLevel := slog.LevelInfo
 		if Opts.Verbose {
@@ -116,6 +178,31 @@ extract, transcribe, and analyse player voice data from CS2 demo files.`,
 		// Replace the default logger
 		slog.SetDefault(Logger)
 
+		if configErr != nil {
+			slog.Error("Failed to load config", "error", configErr)
+			os.Exit(1)
+		}
+		if configPath != "" {
+			slog.Debug("Loaded config file", "path", configPath)
+		}
+
+		// Reject an unknown result format before doing any work
+		if Opts.OutputFormat != "text" && Opts.OutputFormat != "json" {
+			slog.Error("Unsupported output format", "format", Opts.OutputFormat, "expected", "text or json")
+			os.Exit(1)
+		}
+
+		// Parse the permissions before anything is created
+		var err error
+		if Opts.FileMode, err = parseMode("file mode", fileModeOption); err != nil {
+			slog.Error("Invalid file mode", "error", err)
+			os.Exit(1)
+		}
+		if Opts.DirMode, err = parseMode("directory mode", dirModeOption); err != nil {
+			slog.Error("Invalid directory mode", "error", err)
+			os.Exit(1)
+		}
+
 		// Resolve and prepare output directory
 		if err := resolveOutputDir(); err != nil {
 			slog.Error("Failed to set up output directory", "error", err)
@@ -134,10 +221,17 @@ func Execute() {
 }
 
 func init() {
+	// Enable the --version flag
+	rootCmd.Version = Version
+
 	// Register flags directly with the Options struct
 	rootCmd.PersistentFlags().BoolVarP(&Opts.Verbose, "verbose", "v", false, "enable verbose output")
 	rootCmd.PersistentFlags().StringVarP(&Opts.OutputDir, "output-dir", "o", "", "directory to save output files (default: current directory)")
 	rootCmd.PersistentFlags().BoolVarP(&Opts.ForceOverwrite, "force", "f", false, "force overwrite existing files")
+	rootCmd.PersistentFlags().StringVar(&Opts.OutputFormat, "output-format", "text", "format of the command result on stdout: text or json (logs go to stderr)")
+	rootCmd.PersistentFlags().StringVar(&fileModeOption, "file-mode", "0644", "permissions of written files, in octal (applied regardless of the umask)")
+	rootCmd.PersistentFlags().StringVar(&dirModeOption, "dir-mode", "0755", "permissions of created output directories, in octal (applied regardless of the umask)")
+	rootCmd.PersistentFlags().StringVar(&Opts.ConfigFile, "config", "", "config file of default flag values (default: $XDG_CONFIG_HOME/cs2voice/config.yaml)")
 
 	// For backward compatibility with code that might access the verbose variable directly
 	// We set up a hook to keep it synchronized when the flag changes
@@ -0,0 +1,241 @@
+/*
+Copyright 2025 Lucas Chagas <lucas.w.chagas@gmail.com>
+*/
+package cmd
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/DiskMethod/cs2-voice-tools/internal/extract"
+	dem "github.com/markus-wa/demoinfocs-golang/v4/pkg/demoinfocs"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// serveAddr is the address the HTTP server listens on
+	serveAddr string
+
+	// maxUploadSize limits the size of an uploaded demo, in bytes
+	maxUploadSize int64
+)
+
+// serveCmd represents the serve command
+var serveCmd = &cobra.Command{
+	Use:   "serve [flags]",
+	Short: "Run an HTTP server that extracts voice data from uploaded demos",
+	Long: `Run an HTTP server exposing voice extraction.
+
+  GET  /healthz   reports that the server is up
+  POST /extract   extracts voice from a demo and returns the files as a zip
+
+The demo is sent as a multipart form file named "demo", as the raw request
+body, or as a URL in the "url" query parameter. Query parameters "players"
+(comma-separated SteamID64s) and "format" select what is extracted, and
+"response=json" returns the extraction summary instead of the zip.
+Cancelling the request stops the extraction.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		mux := http.NewServeMux()
+		mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintln(w, "ok")
+		})
+		mux.HandleFunc("POST /extract", handleExtract)
+
+		server := &http.Server{
+			Addr:              serveAddr,
+			Handler:           mux,
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		errCh := make(chan error, 1)
+		go func() {
+			slog.Info("Listening", "addr", serveAddr)
+			errCh <- server.ListenAndServe()
+		}()
+
+		select {
+		case err := <-errCh:
+			return err
+		case <-ctx.Done():
+		}
+
+		slog.Info("Shutting down")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		return server.Shutdown(shutdownCtx)
+	},
+}
+
+// handleExtract runs an extraction for one request in its own temporary directory
+// and responds with a zip of the files written, or the summary as JSON.
+func handleExtract(w http.ResponseWriter, r *http.Request) {
+	workDir, err := os.MkdirTemp("", "cs2voice-serve-*")
+	if err != nil {
+		writeHTTPError(w, http.StatusInternalServerError, err)
+		return
+	}
+	defer os.RemoveAll(workDir)
+
+	query := r.URL.Query()
+	demoPath := query.Get("url")
+	if demoPath == "" {
+		demoPath, err = saveUploadedDemo(w, r, workDir)
+		if err != nil {
+			writeHTTPError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	var playerIDs []string
+	if players := query.Get("players"); players != "" {
+		for _, id := range strings.Split(players, ",") {
+			id = strings.TrimSpace(id)
+			if !steamID64Regex.MatchString(id) {
+				writeHTTPError(w, http.StatusBadRequest, fmt.Errorf("invalid SteamID64: %s", id))
+				return
+			}
+			playerIDs = append(playerIDs, id)
+		}
+	}
+
+	outputDir := filepath.Join(workDir, "output")
+	if err := os.Mkdir(outputDir, extract.DirPermissions); err != nil {
+		writeHTTPError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	options := extract.ExtractOptions{
+		DemoPath:       demoPath,
+		DemoEntry:      query.Get("entry"),
+		OutputDir:      outputDir,
+		ForceOverwrite: true,
+		PlayerIDs:      playerIDs,
+		Format:         query.Get("format"),
+	}
+
+	slog.Info("Extracting", "demo", demoPath, "remote", r.RemoteAddr)
+	result, err := extract.ExtractVoiceDataContext(r.Context(), options)
+	if err != nil {
+		writeHTTPError(w, extractErrorStatus(err), err)
+		return
+	}
+
+	if query.Get("response") == "json" {
+		// Paths inside the temporary directory mean nothing to the client
+		for i := range result.Files {
+			result.Files[i].Path = filepath.Base(result.Files[i].Path)
+		}
+		result.Demo, result.OutputDir = filepath.Base(result.Demo), ""
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="voice.zip"`)
+	if err := writeZip(w, result.Files); err != nil {
+		// Headers are already sent, so the error can only be logged
+		slog.Error("Failed to write zip response", "error", err)
+	}
+}
+
+// saveUploadedDemo stores the demo sent as a "demo" form file or the raw body in dir and returns its path.
+// The upload's extension is kept so zip archives are recognized.
+func saveUploadedDemo(w http.ResponseWriter, r *http.Request, dir string) (string, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+
+	var body io.Reader = r.Body
+	name := "upload.dem"
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		file, header, err := r.FormFile("demo")
+		if err != nil {
+			return "", fmt.Errorf("missing demo upload: %w", err)
+		}
+		defer file.Close()
+		body = file
+		if ext := strings.ToLower(filepath.Ext(header.Filename)); ext == ".zip" {
+			name = "upload.zip"
+		}
+	}
+
+	path := filepath.Join(dir, name)
+	out, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(out, body); err != nil {
+		out.Close()
+		return "", fmt.Errorf("failed to read demo upload: %w", err)
+	}
+	if err := out.Close(); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// writeZip streams the extracted files to w as a zip archive.
+func writeZip(w io.Writer, files []extract.ExtractedFile) error {
+	archive := zip.NewWriter(w)
+	for _, f := range files {
+		src, err := os.Open(f.Path)
+		if err != nil {
+			return err
+		}
+		dst, err := archive.Create(filepath.Base(f.Path))
+		if err == nil {
+			_, err = io.Copy(dst, src)
+		}
+		src.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+// extractErrorStatus maps an extraction error to an HTTP status code.
+func extractErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, context.Canceled):
+		// The client went away; the status is never seen
+		return 499
+	case errors.Is(err, extract.ErrNoVoiceData):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, extract.ErrInvalidFormat), errors.Is(err, extract.ErrDemoNotInArchive),
+		errors.Is(err, dem.ErrInvalidFileType), errors.Is(err, dem.ErrUnexpectedEndOfDemo):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// writeHTTPError responds with status and the error message as JSON.
+func writeHTTPError(w http.ResponseWriter, status int, err error) {
+	slog.Warn("Extraction request failed", "status", status, "error", err)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+
+	serveCmd.Flags().StringVar(&serveAddr, "addr", "127.0.0.1:8080", "address to listen on")
+	serveCmd.Flags().Int64Var(&maxUploadSize, "max-upload", 1<<30, "largest demo upload accepted, in bytes")
+}
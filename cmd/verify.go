@@ -0,0 +1,88 @@
+/*
+Copyright 2025 Lucas Chagas <lucas.w.chagas@gmail.com>
+*/
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/DiskMethod/cs2-voice-tools/internal/extract"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// verifyLimits are the thresholds verify fails on
+	verifyLimits extract.VerifyLimits
+	// verifyIncludeBots verifies voice from bots and SourceTV as well as real players
+	verifyIncludeBots bool
+	// verifyDemoEntry selects the demo inside a zip archive
+	verifyDemoEntry string
+)
+
+// verifyCmd represents the verify command
+var verifyCmd = &cobra.Command{
+	Use:   "verify [flags] <demo-file|demo-zip|demo-url|->",
+	Short: "Decode a demo's voice in memory and check it for corruption",
+	Long: `Decode a demo's voice in memory and check it for corruption.
+
+Every player's voice is run through the same decode as extract, but nothing is
+written. The report lists the packets read, checksum failures, invalid packets,
+decode errors and how much audio each player has. The command exits with an
+error when a count exceeds its --max-* threshold (zero by default), so it can
+gate a pipeline before extraction.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		options := extract.ExtractOptions{
+			DemoPath:    args[0],
+			DemoEntry:   verifyDemoEntry,
+			IncludeBots: verifyIncludeBots,
+		}
+
+		result, err := extract.VerifyVoiceData(cmd.Context(), options, verifyLimits)
+		if err != nil {
+			return err
+		}
+
+		var text strings.Builder
+		for _, player := range result.Players {
+			name := player.Player
+			if player.Name != "" {
+				name = fmt.Sprintf("%s (%s)", player.Player, player.Name)
+			}
+			fmt.Fprintf(&text, "%s: %d packets, %d checksum failures, %d invalid, %d skipped, %.1fs decodable",
+				name, player.Packets, player.ChecksumFailures, player.InvalidPackets, player.SkippedPackets, player.Duration)
+			if player.DecodeError != "" {
+				fmt.Fprintf(&text, ", decode failed: %s", player.DecodeError)
+			}
+			text.WriteString("\n")
+		}
+		fmt.Fprintf(&text, "Total: %d packets from %d players, %d checksum failures, %d invalid packets, %d decode errors\n",
+			result.Packets, len(result.Players), result.ChecksumFailures, result.InvalidPackets, result.DecodeErrors)
+		if result.Passed {
+			text.WriteString("PASS")
+		} else {
+			text.WriteString("FAIL: " + strings.Join(result.Failures, ", "))
+		}
+
+		if err := printResult(result, text.String()); err != nil {
+			return err
+		}
+		if !result.Passed {
+			// The report already explains the failure, so skip the usage text
+			cmd.SilenceUsage = true
+			return fmt.Errorf("verification failed: %s", strings.Join(result.Failures, ", "))
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(verifyCmd)
+
+	verifyCmd.Flags().IntVar(&verifyLimits.MaxChecksumFailures, "max-checksum-failures", 0, "number of packets with a bad checksum to tolerate")
+	verifyCmd.Flags().IntVar(&verifyLimits.MaxInvalidPackets, "max-invalid-packets", 0, "number of malformed packets to tolerate")
+	verifyCmd.Flags().IntVar(&verifyLimits.MaxDecodeErrors, "max-decode-errors", 0, "number of decode errors (skipped packets or failed players) to tolerate")
+	verifyCmd.Flags().BoolVar(&verifyIncludeBots, "include-bots", false, "also verify voice from bots and SourceTV (skipped by default)")
+	verifyCmd.Flags().StringVar(&verifyDemoEntry, "demo-entry", "", "name of the .dem entry to read when the input is a zip archive (default: first .dem)")
+}
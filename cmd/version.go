@@ -0,0 +1,22 @@
+/*
+Copyright 2025 Lucas Chagas <lucas.w.chagas@gmail.com>
+*/
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// versionCmd represents the version command
+var versionCmd = &cobra.Command{
+	Use:   "version",
+	Short: "Print the version of cs2-voice-tools",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return printResult(map[string]string{"version": Version}, Version)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(versionCmd)
+}
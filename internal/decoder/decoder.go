@@ -1,138 +1,529 @@
-// Package decoder provides utilities for decoding Opus-encoded audio streams from Steam and CS2 voice data.
+// Package decoder provides utilities for decoding Opus-encoded audio streams from Steam and CS2 voice data,
+// and an Opus encoder for writing decoded voice back out.
 package decoder
 
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"time"
 
-	"gopkg.in/hraban/opus.v2"
+	"github.com/DiskMethod/cs2-voice-tools/internal/voicepacket"
 )
 
 const (
-	// FrameSize is the number of samples per Opus frame for decoding.
-	FrameSize = 480
+	// SteamFrameDuration is the length of a Steam voice frame. Silence packets are counted in these
+	// frames, and it is the frame length assumed for concealing loss before any frame is decoded.
+	SteamFrameDuration = 20 * time.Millisecond
+
+	// MinGainDB and MaxGainDB bound the decoder gain, matching the Q8 range of libopus' OPUS_SET_GAIN.
+	MinGainDB = -128
+	MaxGainDB = 127
+
+	// DefaultMaxConcealedFrames is the number of lost frames per gap an OpusDecoder synthesizes
+	// with packet loss concealment unless created with WithMaxConcealedFrames.
+	DefaultMaxConcealedFrames = 10
 )
 
-// OpusDecoder wraps an opus.Decoder and tracks the current frame for audio processing.
+// frameCounterWindow is how far, modulo the 16-bit counter, a frame may be ahead of the expected
+// frame and still count as following it after lost frames, or behind it and count as a late frame
+// from the past. It is 5 seconds of 20ms frames, longer than any plausible run of lost packets.
+const frameCounterWindow = 250
+
+// maxOpusFrameDuration is the longest frame an Opus packet can carry, in milliseconds.
+const maxOpusFrameDuration = 120
+
+// SteamFrameSamples returns the number of samples per channel in a Steam voice frame at the
+// given sample rate.
+func SteamFrameSamples(sampleRate int) int {
+	return int(time.Duration(sampleRate) * SteamFrameDuration / time.Second)
+}
+
+// MaxOpusFrameSamples returns the number of interleaved samples in the longest possible
+// Opus frame (120ms) at the given sample rate and channel count. Buffers of this size can
+// hold the output of any single decode call without truncation.
+func MaxOpusFrameSamples(sampleRate, channels int) int {
+	return sampleRate * maxOpusFrameDuration / 1000 * channels
+}
+
+// ErrInvalidGain is returned when a decoder gain outside [MinGainDB, MaxGainDB] is requested.
+var ErrInvalidGain = errors.New("invalid decoder gain")
+
+// ErrInvalidLossConcealment is returned when an unknown loss-concealment mode is requested.
+var ErrInvalidLossConcealment = errors.New("invalid loss concealment mode")
+
+// ErrInvalidMaxConcealedFrames is returned by NewOpusDecoder when WithMaxConcealedFrames is
+// given a negative frame count.
+var ErrInvalidMaxConcealedFrames = errors.New("invalid maximum of concealed frames")
+
+// ErrOpusUnavailable is returned when Opus data must be decoded but the binary has no working
+// libopus, either because it was built with the nodecode tag or because libopus failed to load.
+var ErrOpusUnavailable = errors.New("opus decoding is not available")
+
+// LossConcealment selects how the decoder fills frames lost between packets.
+type LossConcealment int
+
+const (
+	// LossPLC synthesizes lost frames with Opus packet loss concealment. Timing is preserved.
+	LossPLC LossConcealment = iota
+	// LossSilence fills lost frames with zeros. Timing is preserved.
+	LossSilence
+	// LossSkip drops lost frames entirely, so later audio shifts earlier in time.
+	LossSkip
+)
+
+// String returns the mode name as accepted by ParseLossConcealment.
+func (l LossConcealment) String() string {
+	switch l {
+	case LossPLC:
+		return "plc"
+	case LossSilence:
+		return "silence"
+	case LossSkip:
+		return "skip"
+	default:
+		return fmt.Sprintf("LossConcealment(%d)", int(l))
+	}
+}
+
+// ParseLossConcealment converts a mode name (plc, silence, skip) into a LossConcealment.
+func ParseLossConcealment(s string) (LossConcealment, error) {
+	switch s {
+	case "plc", "":
+		return LossPLC, nil
+	case "silence":
+		return LossSilence, nil
+	case "skip":
+		return LossSkip, nil
+	default:
+		return LossPLC, fmt.Errorf("%w: '%s' (expected plc, silence or skip)", ErrInvalidLossConcealment, s)
+	}
+}
+
+// DecodeStats counts what happened to the frames of a voice stream during decoding.
+type DecodeStats struct {
+	// Frames is the number of Opus frames decoded from real data
+	Frames int
+	// VoicedSamples is the number of samples per channel decoded from real data
+	VoicedSamples int
+	// LostFrames is the number of frames detected missing from gaps in the frame counter
+	LostFrames int
+	// PLCFrames is the number of frames synthesized by packet loss concealment
+	PLCFrames int
+	// SilenceFrames is the number of frames signalled as silence by the sender
+	SilenceFrames int
+	// SkippedPackets is the number of packets dropped because they failed to parse or decode
+	SkippedPackets int
+	// SteamIDMismatches is the number of Steam packets whose embedded SteamID differs from the
+	// xuid of the net message carrying them
+	SteamIDMismatches int
+}
+
+// Add accumulates the counters of other into s.
+func (s *DecodeStats) Add(other DecodeStats) {
+	s.Frames += other.Frames
+	s.VoicedSamples += other.VoicedSamples
+	s.LostFrames += other.LostFrames
+	s.PLCFrames += other.PLCFrames
+	s.SilenceFrames += other.SilenceFrames
+	s.SkippedPackets += other.SkippedPackets
+	s.SteamIDMismatches += other.SteamIDMismatches
+}
+
+// Codec decodes single Opus packets. *opus.Decoder from gopkg.in/hraban/opus.v2 implements it.
+type Codec interface {
+	DecodeFloat32(data []byte, pcm []float32) (int, error)
+	DecodePLCFloat32(pcm []float32) error
+}
+
+// Encoder encodes PCM frames as Opus packets. *opus.Encoder from gopkg.in/hraban/opus.v2 implements it.
+type Encoder interface {
+	EncodeFloat32(pcm []float32, data []byte) (int, error)
+}
+
+// NewEncoder returns an Opus encoder tuned for voice at the given sample rate and channel count.
+// It fails with ErrOpusUnavailable if the binary has no working Opus support (see CheckOpus).
+func NewEncoder(sampleRate, channels int) (Encoder, error) {
+	return newEncoder(sampleRate, channels)
+}
+
+// OpusDecoder wraps an Opus codec and tracks the current frame for audio processing.
+//
+// Frames lost between packets are filled according to the loss concealment mode. With LossPLC,
+// only the first maxConcealedFrames of a gap (DefaultMaxConcealedFrames unless created with
+// WithMaxConcealedFrames) are synthesized by Opus; PLC fades towards silence and costs a decode
+// per frame, so there is little to gain from synthesizing long gaps. The rest of the gap is
+// filled with silence, keeping later audio at its real time. A long gap can therefore add a lot
+// of silence; LossSkip drops gaps instead, at the cost of timing.
 type OpusDecoder struct {
-	decoder *opus.Decoder
+	decoder Codec
 
+	// currentFrame is the frame counter expected next
 	currentFrame uint16
+
+	// synced is set once currentFrame has been seeded from a frame. A new decoder, and one whose
+	// sender reset its stream, takes the next frame's counter as the start rather than a gap
+	synced bool
+
+	// sampleRate is the output sample rate (Hz) the decoder was created with
+	sampleRate int
+
+	// channels is the number of interleaved channels in each decoded frame
+	channels int
+
+	// frameSamples is the length, in samples per channel, of the last frame decoded, read from its
+	// TOC byte. Lost frames are concealed at this length
+	frameSamples int
+
+	// gain is the linear factor applied to every decoded frame (0 means unity)
+	gain float32
+
+	// lossMode controls how frames missing between packets are filled
+	lossMode LossConcealment
+
+	// maxConcealedFrames is the most lost frames per gap synthesized with PLC; the rest of a
+	// longer gap is filled with silence
+	maxConcealedFrames int
+
+	// stats counts decoded and concealed frames over the decoder's lifetime
+	stats DecodeStats
+
+	// position is the number of samples per channel output over the decoder's lifetime
+	position int
 }
 
-// NewOpusDecoder creates a new OpusDecoder with the specified sample rate and channel count.
-func NewOpusDecoder(sampleRate, channels int) (*OpusDecoder, error) {
-	decoder, err := opus.NewDecoder(sampleRate, channels)
+// FrameSpan locates one frame of decoded audio in the decoder's output stream.
+type FrameSpan struct {
+	// Offset is the sample (per channel) the frame starts at, counted over the decoder's lifetime
+	Offset int
+	// Samples is the frame's length in samples per channel
+	Samples int
+	// Frame is the frame counter the sender gave the frame; for lost frames, the first missing one
+	Frame uint16
+	// Concealed marks audio filled in for lost frames (PLC or silence) rather than decoded
+	Concealed bool
+}
+
+// OpusDecoderOption configures an OpusDecoder as NewOpusDecoder creates it.
+type OpusDecoderOption func(*OpusDecoder) error
+
+// WithMaxConcealedFrames sets how many lost frames per gap are synthesized with packet loss
+// concealment in LossPLC mode; the rest of a longer gap is filled with silence. Zero fills
+// every gap with silence. A negative count makes NewOpusDecoder fail with
+// ErrInvalidMaxConcealedFrames. The default is DefaultMaxConcealedFrames.
+func WithMaxConcealedFrames(frames int) OpusDecoderOption {
+	return func(d *OpusDecoder) error {
+		if frames < 0 {
+			return fmt.Errorf("%w: %d (expected zero or more)", ErrInvalidMaxConcealedFrames, frames)
+		}
+		d.maxConcealedFrames = frames
+		return nil
+	}
+}
+
+// NewOpusDecoder creates a new OpusDecoder with the specified sample rate and channel count,
+// configured by opts. It fails with ErrOpusUnavailable if the binary has no working Opus support
+// (see CheckOpus), or with the error of the first option that is invalid.
+func NewOpusDecoder(sampleRate, channels int, opts ...OpusDecoderOption) (*OpusDecoder, error) {
+	decoder, err := newCodec(sampleRate, channels)
 
 	if err != nil {
 		return nil, err
 	}
 
-	return &OpusDecoder{
-		decoder:      decoder,
+	return newOpusDecoder(decoder, sampleRate, channels, opts...)
+}
+
+// newOpusDecoder wraps a codec producing audio at sampleRate with channels in an OpusDecoder
+// and applies opts to it.
+func newOpusDecoder(codec Codec, sampleRate, channels int, opts ...OpusDecoderOption) (*OpusDecoder, error) {
+	d := &OpusDecoder{
+		decoder:      codec,
 		currentFrame: 0,
-	}, nil
+		sampleRate:   sampleRate,
+		channels:     channels,
+		frameSamples: SteamFrameSamples(sampleRate),
+
+		maxConcealedFrames: DefaultMaxConcealedFrames,
+	}
+	for _, opt := range opts {
+		if err := opt(d); err != nil {
+			return nil, err
+		}
+	}
+	return d, nil
+}
+
+// SampleRate returns the output sample rate (Hz) the decoder was created with.
+func (d *OpusDecoder) SampleRate() int {
+	return d.sampleRate
+}
+
+// Channels returns the number of interleaved channels in the decoder's output.
+func (d *OpusDecoder) Channels() int {
+	return d.channels
+}
+
+// Position returns the number of samples per channel the decoder has output so far, which is
+// the offset the next decoded frame will start at.
+func (d *OpusDecoder) Position() int {
+	return d.position
 }
 
 // Decode decodes a slice of Opus-encoded bytes into PCM float32 samples.
 func (d *OpusDecoder) Decode(b []byte) ([]float32, error) {
+	output, _, err := d.DecodeLimit(b, 0)
+	return output, err
+}
+
+// DecodeSpans decodes like Decode and also reports where each frame's audio lands in the
+// decoder's output stream, so callers can map an audio position back to the packet and
+// frame it came from. Offsets are relative to the decoder's whole lifetime (see Position).
+func (d *OpusDecoder) DecodeSpans(b []byte) ([]float32, []FrameSpan, error) {
+	var spans []FrameSpan
+	output, _, err := d.decode(b, 0, &spans)
+	if err != nil {
+		return nil, nil, err
+	}
+	return output, spans, nil
+}
+
+// DecodeLimit decodes like Decode but stops once maxSamples samples have been produced,
+// returning the samples up to the cap and truncated set to true. A maxSamples of 0 means unlimited.
+// This bounds the work done for a single packet whose frames would expand to far more audio
+// than expected. Frames after the cap are discarded and show up as lost on the next packet.
+func (d *OpusDecoder) DecodeLimit(b []byte, maxSamples int) (output []float32, truncated bool, err error) {
+	return d.decode(b, maxSamples, nil)
+}
+
+// decode implements DecodeLimit, appending a FrameSpan per frame to spans when it is non-nil.
+func (d *OpusDecoder) decode(b []byte, maxSamples int, spans *[]FrameSpan) (output []float32, truncated bool, err error) {
 	buf := bytes.NewBuffer(b)
+	start := d.position
 
-	output := make([]float32, 0, 1024)
+	output = make([]float32, 0, 1024)
 
 	for buf.Len() != 0 {
 		var chunkLen int16
 		if err := binary.Read(buf, binary.LittleEndian, &chunkLen); err != nil {
-			return nil, err
+			return nil, false, fmt.Errorf("%w: truncated frame length: %w", voicepacket.ErrInvalidVoicePacket, err)
 		}
 
 		if chunkLen == -1 {
-			d.currentFrame = 0
+			d.synced = false
 			break
 		}
 
+		// -1 is the only negative length with a meaning; any other would not fit in a buffer
+		if chunkLen < 0 {
+			return nil, false, fmt.Errorf("%w: negative frame length %d", voicepacket.ErrInvalidVoicePacket, chunkLen)
+		}
+
 		var currentFrame uint16
 		if err := binary.Read(buf, binary.LittleEndian, &currentFrame); err != nil {
-			return nil, err
+			return nil, false, fmt.Errorf("%w: truncated frame number: %w", voicepacket.ErrInvalidVoicePacket, err)
 		}
 
+		// The first frame of a stream starts the count wherever the sender's counter stands
+		if !d.synced {
+			d.currentFrame = currentFrame
+			d.synced = true
+		}
 		previousFrame := d.currentFrame
 
 		chunk := make([]byte, chunkLen)
 		n, err := buf.Read(chunk)
 		if err != nil {
-			return nil, err
+			return nil, false, fmt.Errorf("%w: truncated frame: %w", voicepacket.ErrInvalidVoicePacket, err)
 		}
 
 		if n != int(chunkLen) {
-			return nil, ErrInvalidVoicePacket
+			return nil, false, fmt.Errorf("%w: frame of %d bytes has only %d", voicepacket.ErrInvalidVoicePacket, chunkLen, n)
 		}
 
-		if currentFrame >= previousFrame {
-			if currentFrame == previousFrame {
-				d.currentFrame = currentFrame + 1
-
-				decoded, err := d.decodeSteamChunk(chunk)
+		// The counter wraps past 65535 during long transmissions, so frames are compared by how far
+		// ahead of or behind the expected one they are, modulo 2^16. Up to frameCounterWindow ahead
+		// is a gap of lost frames, and up to frameCounterWindow behind is a late frame from the
+		// past, which is dropped. A jump further in either direction is not plausible loss (the
+		// sender restarted its counter, say), so decoding resyncs to the frame without a gap.
+		ahead := currentFrame - previousFrame
+		if behind := previousFrame - currentFrame; behind == 0 || behind > frameCounterWindow {
+			if ahead > 0 && ahead <= frameCounterWindow {
+				decoded, err := d.decodeLoss(ahead)
 
 				if err != nil {
-					return nil, err
+					return nil, false, err
 				}
 
+				d.addSpan(spans, start, len(output), len(decoded), previousFrame, true)
 				output = append(output, decoded...)
-			} else {
-				decoded, err := d.decodeLoss(currentFrame - previousFrame)
+			}
 
-				if err != nil {
-					return nil, err
-				}
+			// Continue from the frame after this one, past any gap
+			d.currentFrame = currentFrame + 1
 
-				output = append(output, decoded...)
+			decoded, err := d.decodeSteamChunk(chunk)
+
+			if err != nil {
+				return nil, false, err
+			}
+
+			d.addSpan(spans, start, len(output), len(decoded), currentFrame, false)
+			output = append(output, decoded...)
+		}
+
+		if maxSamples > 0 && len(output) >= maxSamples {
+			truncated = len(output) > maxSamples || buf.Len() != 0
+			output = output[:maxSamples]
+			if spans != nil && len(*spans) > 0 {
+				// The last frame may have been cut short
+				last := &(*spans)[len(*spans)-1]
+				last.Samples = start + maxSamples/d.channels - last.Offset
 			}
+			break
 		}
 	}
 
-	return output, nil
+	d.position = start + len(output)/d.channels
+	return output, truncated, nil
 }
 
+// addSpan records a frame of n interleaved samples output after the first produced samples
+// of a decode call that started at position start. Empty frames are not recorded.
+func (d *OpusDecoder) addSpan(spans *[]FrameSpan, start, produced, n int, frame uint16, concealed bool) {
+	if spans == nil || n == 0 {
+		return
+	}
+	*spans = append(*spans, FrameSpan{
+		Offset:    start + produced/d.channels,
+		Samples:   n / d.channels,
+		Frame:     frame,
+		Concealed: concealed,
+	})
+}
+
+// SetGainDB sets a fixed gain, in dB, applied to all audio produced by the decoder,
+// including concealment frames. Valid values are MinGainDB to MaxGainDB; 0 disables it.
+// The gain persists for the lifetime of the decoder.
+//
+// libopus exposes this as OPUS_SET_GAIN, but the opus binding does not wrap that CTL,
+// so the equivalent linear factor is applied to each frame as it is decoded.
+func (d *OpusDecoder) SetGainDB(db int) error {
+	if db < MinGainDB || db > MaxGainDB {
+		return fmt.Errorf("%w: %d dB (expected %d to %d)", ErrInvalidGain, db, MinGainDB, MaxGainDB)
+	}
+
+	if db == 0 {
+		d.gain = 0
+		return nil
+	}
+
+	d.gain = float32(math.Pow(10, float64(db)/20))
+	return nil
+}
+
+// Stats returns the frame counters accumulated by Decode since the decoder was created.
+// Only Frames, VoicedSamples, LostFrames and PLCFrames are tracked here; packet-level counters are left to callers.
+func (d *OpusDecoder) Stats() DecodeStats {
+	return d.stats
+}
+
+// SetLossConcealment selects how frames lost between packets are filled.
+// The default is LossPLC.
+func (d *OpusDecoder) SetLossConcealment(mode LossConcealment) {
+	d.lossMode = mode
+}
+
+// applyGain scales the frame in place by the configured decoder gain.
+func (d *OpusDecoder) applyGain(pcm []float32) {
+	if d.gain == 0 {
+		return
+	}
+
+	for i := range pcm {
+		pcm[i] *= d.gain
+	}
+}
+
+// decodeSteamChunk decodes one Opus packet, sizing the output from the frame duration in its TOC
+// byte so packets of any frame length decode in full. The length is remembered for concealment.
 func (d *OpusDecoder) decodeSteamChunk(b []byte) ([]float32, error) {
-	o := make([]float32, FrameSize)
+	size := MaxOpusFrameSamples(d.sampleRate, d.channels)
+	samples, tocErr := PacketSamples(b, d.sampleRate)
+	if tocErr == nil {
+		size = samples * d.channels
+	}
+	o := make([]float32, size)
 
+	// DecodeFloat32 reports samples per channel; the buffer is interleaved
 	n, err := d.decoder.DecodeFloat32(b, o)
 
 	if err != nil {
-		return nil, err
+		// Keep libopus' own error reachable with errors.As alongside the sentinel
+		return nil, fmt.Errorf("%w: %w", ErrInvalidOpusPacket, err)
+	}
+	if tocErr == nil && n > 0 {
+		d.frameSamples = n
 	}
 
-	return o[:n], nil
+	o = o[:n*d.channels]
+	d.applyGain(o)
+	d.stats.Frames++
+	d.stats.VoicedSamples += n
+
+	return o, nil
 }
 
+// decodeLoss fills a gap of the given number of frames, each as long as the last decoded frame.
+// With LossPLC, frames past maxConcealedFrames are filled with silence. Gaps are capped at
+// frameCounterWindow frames, which bounds the allocation; decode treats longer jumps as a resync.
 func (d *OpusDecoder) decodeLoss(samples uint16) ([]float32, error) {
-	loss := min(samples, 10)
+	samples = min(samples, frameCounterWindow)
+	d.stats.LostFrames += int(samples)
 
-	o := make([]float32, 0, FrameSize*loss)
+	if d.lossMode == LossSkip {
+		return nil, nil
+	}
 
-	for i := 0; i < int(loss); i += 1 {
-		t := make([]float32, FrameSize)
+	frameLen := d.frameSamples * d.channels
+
+	if d.lossMode == LossSilence {
+		return make([]float32, frameLen*int(samples)), nil
+	}
+
+	// Only the start of the gap is synthesized; silence keeps the rest of it in time
+	loss := min(int(samples), d.maxConcealedFrames)
+	o := make([]float32, 0, frameLen*int(samples))
+
+	for i := 0; i < loss; i += 1 {
+		t := make([]float32, frameLen)
 
 		if err := d.decoder.DecodePLCFloat32(t); err != nil {
 			return nil, err
 		}
 
+		d.applyGain(t)
+		d.stats.PLCFrames++
+
 		o = append(o, t...)
 	}
 
-	return o, nil
+	// The capacity past the synthesized frames is zeroed, which is the silence for the rest of the gap
+	return o[:frameLen*int(samples)], nil
 }
 
-// NewDecoder returns a new opus.Decoder for the given sample rate and channel count.
-func NewDecoder(sampleRate, channels int) (*opus.Decoder, error) {
-	decoder, err := opus.NewDecoder(sampleRate, channels)
-	return decoder, err
+// NewDecoder returns a new Opus codec for the given sample rate and channel count.
+// It fails with ErrOpusUnavailable if the binary has no working Opus support (see CheckOpus).
+func NewDecoder(sampleRate, channels int) (Codec, error) {
+	return newCodec(sampleRate, channels)
 }
 
-// Decode decodes Opus-encoded data using the provided opus.Decoder and returns PCM float32 samples.
-func Decode(decoder *opus.Decoder, data []byte) ([]float32, error) {
-	pcm := make([]float32, 1024)
+// Decode decodes Opus-encoded data using the provided codec and returns PCM float32 samples.
+// The buffer is sized for a 120ms frame at 48kHz stereo, the largest a single packet can produce.
+func Decode(decoder Codec, data []byte) ([]float32, error) {
+	pcm := make([]float32, MaxOpusFrameSamples(48000, 2))
 
 	nlen, err := decoder.DecodeFloat32(data, pcm)
 	if err != nil {
@@ -141,3 +532,54 @@ func Decode(decoder *opus.Decoder, data []byte) ([]float32, error) {
 
 	return pcm[:nlen], nil
 }
+
+// DecodeSteamPacket decodes a single raw Steam voice packet into PCM float32 samples.
+// It parses the packet with DecodeChunk and decodes its Opus frames with a fresh OpusDecoder.
+// Silence packets yield zero-valued samples covering the signalled number of frames.
+//
+// The decoder is thrown away afterwards, so there is no loss concealment continuity between
+// calls; use OpusDecoder.Decode directly to decode a stream of packets.
+func DecodeSteamPacket(payload []byte, sampleRate, channels int) ([]float32, error) {
+	chunk, err := voicepacket.DecodeChunk(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(chunk.Data) == 0 {
+		return make([]float32, chunk.SilenceFrames()*SteamFrameSamples(sampleRate)*channels), nil
+	}
+
+	d, err := NewOpusDecoder(sampleRate, channels)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.Decode(chunk.Data)
+}
+
+// DecodeRawPCM converts the little-endian 16-bit mono samples of a raw PCM chunk (VoiceTypeRaw),
+// recorded at srcRate, to float samples at dstRate. Rates are converted by linear interpolation,
+// which is adequate for voice. A trailing odd byte is ignored.
+func DecodeRawPCM(data []byte, srcRate, dstRate int) []float32 {
+	samples := make([]float32, len(data)/2)
+	for i := range samples {
+		samples[i] = float32(int16(binary.LittleEndian.Uint16(data[2*i:]))) / 32768
+	}
+	if srcRate <= 0 || dstRate <= 0 || srcRate == dstRate || len(samples) == 0 {
+		return samples
+	}
+
+	out := make([]float32, len(samples)*dstRate/srcRate)
+	step := float64(srcRate) / float64(dstRate)
+	for i := range out {
+		pos := float64(i) * step
+		j := int(pos)
+		if j >= len(samples)-1 {
+			out[i] = samples[len(samples)-1]
+			continue
+		}
+		frac := float32(pos - float64(j))
+		out[i] = samples[j] + (samples[j+1]-samples[j])*frac
+	}
+	return out
+}
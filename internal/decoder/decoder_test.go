@@ -0,0 +1,305 @@
+package decoder
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"math"
+	"testing"
+
+	"github.com/DiskMethod/cs2-voice-tools/internal/voicepacket"
+)
+
+// testSampleRate is the rate the tests decode at, where a 20ms frame is 480 samples.
+const testSampleRate = 24000
+
+// testFrameSamples is the length of one celt20ms frame at testSampleRate.
+const testFrameSamples = 480
+
+// celt20ms is an Opus packet whose TOC byte declares a single 20ms CELT frame.
+var celt20ms = []byte{0xf8, 0x00}
+
+// Levels the stand-in codec fills decoded and concealed frames with, so the tests can tell them apart.
+const (
+	voiceLevel = 0.5
+	plcLevel   = 0.25
+)
+
+// fakeCodec stands in for libopus: every packet decodes to a frame filling the buffer with
+// voiceLevel, and every concealed frame is filled with plcLevel. It only produces mono audio.
+type fakeCodec struct {
+	// plcCalls counts the frames synthesized with packet loss concealment
+	plcCalls int
+}
+
+func (c *fakeCodec) DecodeFloat32(data []byte, pcm []float32) (int, error) {
+	if len(data) == 0 {
+		return 0, errors.New("empty packet")
+	}
+	for i := range pcm {
+		pcm[i] = voiceLevel
+	}
+	return len(pcm), nil
+}
+
+func (c *fakeCodec) DecodePLCFloat32(pcm []float32) error {
+	c.plcCalls++
+	for i := range pcm {
+		pcm[i] = plcLevel
+	}
+	return nil
+}
+
+// newTestDecoder returns a mono OpusDecoder at testSampleRate around a fakeCodec.
+func newTestDecoder() (*OpusDecoder, *fakeCodec) {
+	codec := &fakeCodec{}
+	d, _ := newOpusDecoder(codec, testSampleRate, 1)
+	return d, codec
+}
+
+// steamFrame appends a frame holding the given Opus packet to the Opus data of a Steam voice packet.
+func steamFrame(b []byte, counter uint16, packet []byte) []byte {
+	b = binary.LittleEndian.AppendUint16(b, uint16(len(packet)))
+	b = binary.LittleEndian.AppendUint16(b, counter)
+	return append(b, packet...)
+}
+
+// steamFrames builds the Opus data of a Steam voice packet with a celt20ms frame for each counter.
+func steamFrames(counters ...uint16) []byte {
+	var b []byte
+	for _, counter := range counters {
+		b = steamFrame(b, counter, celt20ms)
+	}
+	return b
+}
+
+func TestSetGainDBScalesDecodedAndConcealedFrames(t *testing.T) {
+	// Frame 1 is missing, so it is concealed between two decoded frames
+	packet := steamFrames(0, 2)
+
+	plain, _ := newTestDecoder()
+	want, err := plain.Decode(packet)
+	if err != nil {
+		t.Fatalf("Decode without gain: %v", err)
+	}
+
+	gained, codec := newTestDecoder()
+	if err := gained.SetGainDB(6); err != nil {
+		t.Fatalf("SetGainDB(6): %v", err)
+	}
+	got, err := gained.Decode(packet)
+	if err != nil {
+		t.Fatalf("Decode with gain: %v", err)
+	}
+
+	if codec.plcCalls != 1 {
+		t.Fatalf("concealed %d frames, want 1", codec.plcCalls)
+	}
+	if len(got) != 3*testFrameSamples || len(got) != len(want) {
+		t.Fatalf("got %d samples, want %d", len(got), 3*testFrameSamples)
+	}
+
+	factor := float32(math.Pow(10, 6.0/20))
+	for _, i := range []int{0, testFrameSamples, 2 * testFrameSamples} {
+		if diff := got[i] - want[i]*factor; diff > 1e-6 || diff < -1e-6 {
+			t.Errorf("sample %d = %v, want %v (%v raised by 6 dB)", i, got[i], want[i]*factor, want[i])
+		}
+	}
+	if got[testFrameSamples] <= plcLevel {
+		t.Errorf("concealed sample %v was not raised above %v", got[testFrameSamples], plcLevel)
+	}
+}
+
+func TestSetGainDBRejectsOutOfRange(t *testing.T) {
+	d, _ := newTestDecoder()
+	for _, db := range []int{MinGainDB - 1, MaxGainDB + 1} {
+		if err := d.SetGainDB(db); !errors.Is(err, ErrInvalidGain) {
+			t.Errorf("SetGainDB(%d) = %v, want ErrInvalidGain", db, err)
+		}
+	}
+	if err := d.SetGainDB(0); err != nil {
+		t.Errorf("SetGainDB(0) = %v, want nil", err)
+	}
+}
+
+func TestDecodeLimitCapsSamples(t *testing.T) {
+	packet := steamFrames(0, 1, 2, 3)
+
+	for _, tt := range []struct {
+		name          string
+		maxSamples    int
+		wantSamples   int
+		wantTruncated bool
+	}{
+		{"unlimited", 0, 4 * testFrameSamples, false},
+		{"cap inside a frame", 2*testFrameSamples + 100, 2*testFrameSamples + 100, true},
+		{"cap on the last frame", 4 * testFrameSamples, 4 * testFrameSamples, false},
+		{"cap above the packet", 10 * testFrameSamples, 4 * testFrameSamples, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			d, _ := newTestDecoder()
+			output, truncated, err := d.DecodeLimit(packet, tt.maxSamples)
+			if err != nil {
+				t.Fatalf("DecodeLimit: %v", err)
+			}
+			if len(output) != tt.wantSamples || truncated != tt.wantTruncated {
+				t.Errorf("got %d samples, truncated %v; want %d, %v", len(output), truncated, tt.wantSamples, tt.wantTruncated)
+			}
+			if d.Position() != len(output) {
+				t.Errorf("Position() = %d, want %d", d.Position(), len(output))
+			}
+		})
+	}
+}
+
+func TestDecodeSizesFramesFromTheTOC(t *testing.T) {
+	// A 120ms packet of six 20ms CELT frames, then a lost frame, then a 20ms packet
+	sixFrames := []byte{0xfb, 0x06}
+	packet := steamFrame(nil, 0, sixFrames)
+	packet = steamFrame(packet, 2, celt20ms)
+
+	d, codec := newTestDecoder()
+	output, err := d.Decode(packet)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+
+	// The 120ms packet decodes in full, and the lost frame is concealed at its length
+	long := 6 * testFrameSamples
+	if want := long + long + testFrameSamples; len(output) != want {
+		t.Fatalf("got %d samples, want %d", len(output), want)
+	}
+	if codec.plcCalls != 1 {
+		t.Errorf("concealed %d frames, want 1", codec.plcCalls)
+	}
+	if output[long-1] != voiceLevel || output[long] != plcLevel || output[2*long-1] != plcLevel || output[2*long] != voiceLevel {
+		t.Errorf("frame boundaries are not at %d and %d samples", long, 2*long)
+	}
+}
+
+func TestDecodeSteamPacketSilenceFollowsTheSampleRate(t *testing.T) {
+	// A silence packet for 3 frames; its length field is the frame count
+	packet := binary.LittleEndian.AppendUint64(nil, 76561198000000001)
+	packet = append(packet, voicepacket.PayloadTypeHeader)
+	packet = binary.LittleEndian.AppendUint16(packet, testSampleRate)
+	packet = append(packet, voicepacket.VoiceTypeSilence)
+	packet = binary.LittleEndian.AppendUint16(packet, 3)
+	packet = binary.LittleEndian.AppendUint32(packet, crc32.ChecksumIEEE(packet))
+
+	for _, rate := range []int{testSampleRate, 48000} {
+		pcm, err := DecodeSteamPacket(packet, rate, 2)
+		if err != nil {
+			t.Fatalf("DecodeSteamPacket at %d Hz: %v", rate, err)
+		}
+		// Three 20ms frames of stereo
+		if want := 3 * rate / 50 * 2; len(pcm) != want {
+			t.Errorf("at %d Hz: got %d samples, want %d", rate, len(pcm), want)
+		}
+	}
+}
+
+func TestDecodeFrameCounterWraps(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		// expected is the frame the decoder expects next
+		expected uint16
+		packet   []byte
+		// wantFrames and wantLost are the decoded and concealed frames
+		wantFrames, wantLost int
+		wantNext             uint16
+	}{
+		{"counter wraps past 65535", 65534, steamFrames(65534, 65535, 0, 1), 4, 0, 2},
+		{"gap across the wrap", 65535, steamFrames(65535, 2), 2, 2, 3},
+		{"late frame before the wrap", 1, steamFrames(65530), 0, 0, 1},
+		{"late frame", 300, steamFrames(299, 60), 0, 0, 300},
+		{"jump past the window resyncs", 10, steamFrames(10+frameCounterWindow+1, 10+frameCounterWindow+2), 2, 0, 10 + frameCounterWindow + 3},
+		{"jump back past the window resyncs", 1000, steamFrames(1000 - frameCounterWindow - 1), 1, 0, 1000 - frameCounterWindow},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			d, codec := newTestDecoder()
+			d.currentFrame, d.synced = tt.expected, true
+			output, err := d.Decode(tt.packet)
+			if err != nil {
+				t.Fatalf("Decode: %v", err)
+			}
+
+			stats := d.Stats()
+			if stats.Frames != tt.wantFrames || stats.LostFrames != tt.wantLost || codec.plcCalls != tt.wantLost {
+				t.Errorf("decoded %d and lost %d frames (%d concealed), want %d and %d",
+					stats.Frames, stats.LostFrames, codec.plcCalls, tt.wantFrames, tt.wantLost)
+			}
+			if want := (tt.wantFrames + tt.wantLost) * testFrameSamples; len(output) != want {
+				t.Errorf("got %d samples, want %d", len(output), want)
+			}
+			if d.currentFrame != tt.wantNext {
+				t.Errorf("next expected frame %d, want %d", d.currentFrame, tt.wantNext)
+			}
+		})
+	}
+}
+
+func TestDecodeSeedsFrameCounter(t *testing.T) {
+	d, codec := newTestDecoder()
+
+	// A new decoder starts at the first frame's counter, wherever the sender's stands
+	output, err := d.Decode(steamFrames(40000, 40001))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if len(output) != 2*testFrameSamples || codec.plcCalls != 0 {
+		t.Errorf("first packet: %d samples, %d concealed frames; want %d, 0", len(output), codec.plcCalls, 2*testFrameSamples)
+	}
+
+	// After the sender resets its stream (a length of -1) the count starts over from the next frame
+	reset := binary.LittleEndian.AppendUint16(nil, 0xffff)
+	if _, err := d.Decode(reset); err != nil {
+		t.Fatalf("Decode reset: %v", err)
+	}
+	output, err = d.Decode(steamFrames(7, 9))
+	if err != nil {
+		t.Fatalf("Decode after reset: %v", err)
+	}
+	if len(output) != 3*testFrameSamples || codec.plcCalls != 1 {
+		t.Errorf("after reset: %d samples, %d concealed frames; want %d, 1", len(output), codec.plcCalls, 3*testFrameSamples)
+	}
+	if stats := d.Stats(); stats.LostFrames != 1 {
+		t.Errorf("LostFrames = %d, want only the gap between frames 7 and 9", stats.LostFrames)
+	}
+}
+
+func TestWithMaxConcealedFramesFillsTheRestWithSilence(t *testing.T) {
+	codec := &fakeCodec{}
+	if _, err := newOpusDecoder(codec, testSampleRate, 1, WithMaxConcealedFrames(-1)); !errors.Is(err, ErrInvalidMaxConcealedFrames) {
+		t.Errorf("WithMaxConcealedFrames(-1): err = %v, want ErrInvalidMaxConcealedFrames", err)
+	}
+	d, err := newOpusDecoder(codec, testSampleRate, 1, WithMaxConcealedFrames(2))
+	if err != nil {
+		t.Fatalf("WithMaxConcealedFrames(2): %v", err)
+	}
+
+	// Frames 1 to 5 are lost: two are synthesized and three are silence
+	output, err := d.Decode(steamFrames(0, 6))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if len(output) != 7*testFrameSamples || codec.plcCalls != 2 {
+		t.Fatalf("got %d samples, %d concealed frames; want %d, 2", len(output), codec.plcCalls, 7*testFrameSamples)
+	}
+	for frame, want := range []float32{voiceLevel, plcLevel, plcLevel, 0, 0, 0, voiceLevel} {
+		if got := output[frame*testFrameSamples]; got != want {
+			t.Errorf("frame %d starts with %v, want %v", frame, got, want)
+		}
+	}
+}
+
+func TestDecodeLossIsCapped(t *testing.T) {
+	d, codec := newTestDecoder()
+	d.SetLossConcealment(LossSilence)
+	output, err := d.decodeLoss(math.MaxUint16)
+	if err != nil {
+		t.Fatalf("decodeLoss: %v", err)
+	}
+	if len(output) != frameCounterWindow*testFrameSamples || codec.plcCalls != 0 {
+		t.Errorf("got %d samples, want %d", len(output), frameCounterWindow*testFrameSamples)
+	}
+}
@@ -0,0 +1,24 @@
+//go:build nodecode
+
+package decoder
+
+import "fmt"
+
+// errNoDecode explains why a nodecode build cannot decode Opus.
+var errNoDecode = fmt.Errorf("%w: built with the nodecode tag, which leaves out libopus (rebuild without it to decode voice)", ErrOpusUnavailable)
+
+// CheckOpus returns nil if Opus data can be decoded, or an error wrapping ErrOpusUnavailable
+// that explains why not. Builds with the nodecode tag never can.
+func CheckOpus() error {
+	return errNoDecode
+}
+
+// newCodec always fails, since the nodecode build has no libopus.
+func newCodec(sampleRate, channels int) (Codec, error) {
+	return nil, errNoDecode
+}
+
+// newEncoder always fails, since the nodecode build has no libopus.
+func newEncoder(sampleRate, channels int) (Encoder, error) {
+	return nil, errNoDecode
+}
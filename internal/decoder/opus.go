@@ -0,0 +1,49 @@
+//go:build !nodecode
+
+package decoder
+
+import (
+	"fmt"
+
+	"gopkg.in/hraban/opus.v2"
+)
+
+// opusInitErr records a failure to create an Opus decoder at startup, which means libopus is
+// linked but not usable.
+var opusInitErr error
+
+func init() {
+	if _, err := opus.NewDecoder(48000, 1); err != nil {
+		opusInitErr = fmt.Errorf("%w: libopus failed to initialize: %w", ErrOpusUnavailable, err)
+	}
+}
+
+// CheckOpus returns nil if Opus data can be decoded, or an error wrapping ErrOpusUnavailable
+// that explains why not.
+func CheckOpus() error {
+	return opusInitErr
+}
+
+// newCodec creates a libopus decoder.
+func newCodec(sampleRate, channels int) (Codec, error) {
+	if opusInitErr != nil {
+		return nil, opusInitErr
+	}
+	decoder, err := opus.NewDecoder(sampleRate, channels)
+	if err != nil {
+		return nil, err
+	}
+	return decoder, nil
+}
+
+// newEncoder creates a libopus encoder tuned for voice.
+func newEncoder(sampleRate, channels int) (Encoder, error) {
+	if opusInitErr != nil {
+		return nil, opusInitErr
+	}
+	encoder, err := opus.NewEncoder(sampleRate, channels, opus.AppVoIP)
+	if err != nil {
+		return nil, err
+	}
+	return encoder, nil
+}
@@ -0,0 +1,59 @@
+package decoder
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidOpusPacket is returned when an Opus packet's table-of-contents byte cannot be parsed.
+var ErrInvalidOpusPacket = errors.New("invalid opus packet")
+
+// opusFrameUnits is the frame duration of each Opus configuration (the top five bits of the TOC
+// byte), in units of 2.5ms (RFC 6716, section 3.1).
+var opusFrameUnits = [32]int{
+	// SILK-only: 10, 20, 40, 60ms per bandwidth
+	4, 8, 16, 24, 4, 8, 16, 24, 4, 8, 16, 24,
+	// Hybrid: 10, 20ms per bandwidth
+	4, 8, 4, 8,
+	// CELT-only: 2.5, 5, 10, 20ms per bandwidth
+	1, 2, 4, 8, 1, 2, 4, 8, 1, 2, 4, 8, 1, 2, 4, 8,
+}
+
+// PacketSamples returns the number of samples per channel an Opus packet decodes to at the given
+// sample rate, read from its TOC byte the same way libopus' opus_packet_get_nb_samples does.
+// It fails with ErrInvalidOpusPacket for an empty or truncated packet, or one longer than 120ms.
+func PacketSamples(packet []byte, sampleRate int) (int, error) {
+	frames, units, err := parseTOC(packet)
+	if err != nil {
+		return 0, err
+	}
+	return frames * units * sampleRate / 400, nil
+}
+
+// parseTOC returns the number of frames in an Opus packet and the duration of each, in 2.5ms units.
+func parseTOC(packet []byte) (frames, units int, err error) {
+	if len(packet) == 0 {
+		return 0, 0, fmt.Errorf("%w: empty packet", ErrInvalidOpusPacket)
+	}
+
+	toc := packet[0]
+	units = opusFrameUnits[toc>>3]
+
+	switch toc & 0x3 {
+	case 0:
+		frames = 1
+	case 1, 2:
+		frames = 2
+	default:
+		// Code 3 packets carry the frame count in the following byte
+		if len(packet) < 2 {
+			return 0, 0, fmt.Errorf("%w: missing frame count", ErrInvalidOpusPacket)
+		}
+		frames = int(packet[1] & 0x3f)
+	}
+
+	if frames == 0 || frames*units > maxOpusFrameDuration*2/5 {
+		return 0, 0, fmt.Errorf("%w: %d frames of %.1fms", ErrInvalidOpusPacket, frames, float64(units)*2.5)
+	}
+	return frames, units, nil
+}
@@ -0,0 +1,58 @@
+package decoder
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPacketSamples(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		packet []byte
+		want   int
+	}{
+		{"CELT 2.5ms", []byte{0xe0}, 60},
+		{"CELT 20ms", celt20ms, 480},
+		{"SILK 60ms", []byte{0x18}, 1440},
+		{"two SILK 60ms frames", []byte{0x19}, 2880},
+		{"six CELT 20ms frames", []byte{0xfb, 0x06}, 2880},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := PacketSamples(tt.packet, testSampleRate)
+			if err != nil {
+				t.Fatalf("PacketSamples: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("PacketSamples = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPacketSamplesRejectsInvalidPackets(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		packet []byte
+	}{
+		{"empty", nil},
+		{"code 3 without a frame count", []byte{0xfb}},
+		{"code 3 with no frames", []byte{0xfb, 0x00}},
+		{"longer than 120ms", []byte{0xfb, 0x07}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := PacketSamples(tt.packet, testSampleRate); !errors.Is(err, ErrInvalidOpusPacket) {
+				t.Errorf("err = %v, want ErrInvalidOpusPacket", err)
+			}
+		})
+	}
+}
+
+func TestMaxOpusFrameSamples(t *testing.T) {
+	// 120ms at 48kHz stereo
+	if got := MaxOpusFrameSamples(48000, 2); got != 11520 {
+		t.Errorf("MaxOpusFrameSamples(48000, 2) = %d, want 11520", got)
+	}
+	if got := MaxOpusFrameSamples(testSampleRate, 1); got != 2880 {
+		t.Errorf("MaxOpusFrameSamples(%d, 1) = %d, want 2880", testSampleRate, got)
+	}
+}
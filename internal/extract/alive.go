@@ -0,0 +1,85 @@
+package extract
+
+import (
+	"strconv"
+	"time"
+
+	dem "github.com/markus-wa/demoinfocs-golang/v4/pkg/demoinfocs"
+	"github.com/markus-wa/demoinfocs-golang/v4/pkg/demoinfocs/events"
+)
+
+// deathSpan is a stretch of demo time during which a player was dead.
+type deathSpan struct {
+	// SteamID is the victim's SteamID64 (zero for bots)
+	SteamID uint64
+	// UserID is the victim's demo user ID
+	UserID int
+	Start  time.Duration
+	End    time.Duration
+}
+
+// trackDeaths records a death span for every player killed outside warmup, lasting until the
+// round ends. Kills during warmup are ignored since players respawn straight away, and the time
+// between rounds counts as alive. The returned function closes spans still open at the end of
+// the demo and must be called once parsing completes.
+func trackDeaths(parser dem.Parser, demo *parsedDemo) func() {
+	// open holds the index in demo.Deaths of each dead player's span, by user ID
+	open := make(map[int]int)
+
+	closeAll := func() {
+		now := parser.CurrentTime()
+		for _, i := range open {
+			demo.Deaths[i].End = now
+		}
+		clear(open)
+	}
+
+	parser.RegisterEventHandler(func(e events.Kill) {
+		if e.Victim == nil || parser.GameState().IsWarmupPeriod() {
+			return
+		}
+		if _, dead := open[e.Victim.UserID]; dead {
+			return
+		}
+		open[e.Victim.UserID] = len(demo.Deaths)
+		demo.Deaths = append(demo.Deaths, deathSpan{
+			SteamID: e.Victim.SteamID64,
+			UserID:  e.Victim.UserID,
+			Start:   parser.CurrentTime(),
+		})
+	})
+	parser.RegisterEventHandler(func(events.RoundEnd) { closeAll() })
+	// A round can start without a RoundEnd, e.g. after a restart
+	parser.RegisterEventHandler(func(events.RoundStart) { closeAll() })
+
+	return closeAll
+}
+
+// isDead reports whether the sender of a packet was dead at time t. The sender is matched by
+// user ID when known, otherwise by the SteamID64 key the packet was stored under.
+func isDead(deaths []deathSpan, key string, userID int, t time.Duration) bool {
+	for _, d := range deaths {
+		if t < d.Start || t >= d.End {
+			continue
+		}
+		if userID >= 0 && d.UserID == userID {
+			return true
+		}
+		if userID < 0 && d.SteamID != 0 && key == strconv.FormatUint(d.SteamID, 10) {
+			return true
+		}
+	}
+	return false
+}
+
+// packetsByLifeState keeps only the voice packets sent while their sender was dead (dead set)
+// or alive, dropping players left with none. It must run before sources are re-keyed or merged.
+func packetsByLifeState(demo *parsedDemo, dead bool) *parsedDemo {
+	return filterPackets(demo, func(key string, i int) bool {
+		userID := -1
+		if userIDs := demo.PacketUserIDs[key]; len(userIDs) == len(demo.PacketTimes[key]) {
+			userID = userIDs[i]
+		}
+		return isDead(demo.Deaths, key, userID, demo.PacketTimes[key][i]) == dead
+	})
+}
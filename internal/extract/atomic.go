@@ -0,0 +1,48 @@
+package extract
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// stageOutput creates an empty hidden file next to finalPath for an output to be written to
+// before commitOutput moves it into place. The name keeps finalPath's extension so ffmpeg still
+// picks the right muxer. Staging in the same directory keeps the final rename on one filesystem.
+func stageOutput(finalPath string) (string, error) {
+	base := filepath.Base(finalPath)
+	ext := filepath.Ext(base)
+	file, err := os.CreateTemp(filepath.Dir(finalPath), "."+strings.TrimSuffix(base, ext)+"-*"+ext)
+	if err != nil {
+		return "", fmt.Errorf("failed to create staging file for output: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(file.Name())
+		return "", fmt.Errorf("failed to create staging file for output: %w", err)
+	}
+	return file.Name(), nil
+}
+
+// commitOutput atomically replaces finalPath with the fully written staged file, so readers
+// of finalPath see either the previous file or the complete new one, never a partial write.
+// The output is given mode.
+func commitOutput(stagedPath, finalPath string, mode os.FileMode) error {
+	// Staging files are created private; give the output the requested permissions
+	if err := os.Chmod(stagedPath, mode); err != nil {
+		return fmt.Errorf("failed to set output permissions: %w", err)
+	}
+	if err := os.Rename(stagedPath, finalPath); err != nil {
+		return fmt.Errorf("failed to move output into place: %w", err)
+	}
+	return nil
+}
+
+// setMode gives path exactly mode. os.Create, os.WriteFile and os.Mkdir reduce the mode they
+// are given by the umask, which would drop e.g. the group write bit of a requested 0664.
+func setMode(path string, mode os.FileMode) error {
+	if err := os.Chmod(path, mode); err != nil {
+		return fmt.Errorf("failed to set permissions of %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,581 @@
+package extract
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/DiskMethod/cs2-voice-tools/internal/decoder"
+	"github.com/DiskMethod/cs2-voice-tools/internal/voicepacket"
+
+	"github.com/go-audio/audio"
+	"github.com/go-audio/wav"
+	"github.com/markus-wa/demoinfocs-golang/v4/pkg/demoinfocs/msgs2"
+)
+
+// decodeResult summarizes the decoded audio of one player.
+type decodeResult struct {
+	// Duration is the playback length of the decoded audio
+	Duration time.Duration
+	// VoicedDuration is the part of Duration decoded from real voice data,
+	// excluding loss concealment and silence
+	VoicedDuration time.Duration
+	// SampleRate is the sample rate (Hz) of the decoded audio
+	SampleRate int
+	// Samples is the number of samples per channel decoded
+	Samples int
+	// PacketOffsets holds, for each input packet, the sample offset where its audio starts
+	PacketOffsets []int
+	// Stats counts decoded, concealed, silent and skipped frames
+	Stats decoder.DecodeStats
+}
+
+// appendIntPCM converts interleaved float PCM samples to the integer range used by the WAV encoder,
+// appending them to dst. Samples are multiplied by maxValue, the integer that full scale maps to
+// (see fullScaleValue), after clamping to [-1, 1]: a peak then clips instead of overflowing the
+// bit depth and wrapping into a loud click.
+// The sample count must be a multiple of channels; a partial frame is rejected rather than
+// written, since it would shift every following sample onto the wrong channel.
+func appendIntPCM(dst []int, pcm []float32, channels int, maxValue float32) ([]int, error) {
+	if channels > 0 && len(pcm)%channels != 0 {
+		return dst, fmt.Errorf("%w (%d samples for %d channels)", ErrPartialFrame, len(pcm), channels)
+	}
+
+	start := len(dst)
+	dst = slices.Grow(dst, len(pcm))[:start+len(pcm)]
+	// Reslicing to exactly len(pcm) lets the compiler drop the bounds check in the loop
+	converted := dst[start:][:len(pcm)]
+	for i, v := range pcm {
+		v = max(-1, min(v, 1))
+		// float32 rounds the 32-bit full scale up to 1<<31, one past the largest sample
+		converted[i] = min(int(v*maxValue), math.MaxInt32)
+	}
+	return dst, nil
+}
+
+// appendPCM appends interleaved float PCM samples to dst, clamped to full scale (±1) and
+// multiplied by peak, the level full scale is lowered to for headroom (see headroomScale).
+// Decoders may overshoot full scale slightly on loud input; clamping here makes a peak clip
+// instead of overflowing the bit depth once the samples are converted to integers.
+// The sample count must be a multiple of channels; a partial frame is rejected rather than
+// appended, since it would shift every following sample onto the wrong channel.
+func appendPCM(dst []float32, pcm []float32, channels int, peak float32) ([]float32, error) {
+	if channels > 0 && len(pcm)%channels != 0 {
+		return dst, fmt.Errorf("%w (%d samples for %d channels)", ErrPartialFrame, len(pcm), channels)
+	}
+
+	start := len(dst)
+	dst = slices.Grow(dst, len(pcm))[:start+len(pcm)]
+	scaled := dst[start:][:len(pcm)]
+	for i, v := range pcm {
+		scaled[i] = max(-1, min(v, 1)) * peak
+	}
+	return dst, nil
+}
+
+// scalePCM multiplies the samples in pcm by factor in place; a factor of 1 leaves them untouched.
+func scalePCM(pcm []float32, factor float32) {
+	if factor == 1 {
+		return
+	}
+	for i := range pcm {
+		pcm[i] *= factor
+	}
+}
+
+// appendSilence appends n zero samples to dst, growing it at most once.
+func appendSilence(dst []float32, n int) []float32 {
+	if n <= 0 {
+		return dst
+	}
+	start := len(dst)
+	dst = slices.Grow(dst, n)[:start+n]
+	clear(dst[start:])
+	return dst
+}
+
+// capSamples cuts pcm to at most maxSamples samples per channel (0 means no limit) and points
+// the offsets of the packets from decoded on, which were not decoded, at the end of the audio.
+func capSamples(pcm []float32, offsets []int, decoded, maxSamples, channels int) []float32 {
+	if maxSamples > 0 && len(pcm) > maxSamples*channels {
+		pcm = pcm[:maxSamples*channels]
+	}
+	for i := decoded; i < len(offsets); i++ {
+		offsets[i] = len(pcm) / channels
+	}
+	return pcm
+}
+
+// decodeSteamVoice decodes Steam-format voice data payloads into float PCM at sampleRate,
+// which must be a rate supported by Opus. Each payload is parsed as a chunk and its Opus frames
+// are decoded with a single OpusDecoder so loss concealment carries across packets.
+// Raw PCM chunks, from demos recorded with voice compression disabled, are converted directly.
+// Packets that fail to parse or decode are skipped and counted, keeping the rest of the player's voice;
+// only when no packet with voice decodes is the last such error returned.
+// The xuid from the net message is checked against the SteamID embedded in each chunk; mismatches are logged
+// and counted in the stats.
+// So is messageRate, the sample rate the net messages report (0 if none), against each chunk's.
+// Samples are raised by gainDB decibels in the decoder, concealed frames included, and clamped
+// with full scale mapped to peak. With silenceGaps, the frames signalled by silence packets are
+// written as zeros; a run of silence packets is written as one gap.
+// Decoding stops once maxSamples samples per channel have been produced (0 means unlimited).
+func decodeSteamVoice(payloads [][]byte, xuid uint64, sampleRate, messageRate int, lossMode decoder.LossConcealment, maxConcealed int, silenceGaps bool, gainDB, maxSamples int, peak float32) ([]float32, decodeResult, error) {
+	var decoderOpts []decoder.OpusDecoderOption
+	if maxConcealed > 0 {
+		decoderOpts = append(decoderOpts, decoder.WithMaxConcealedFrames(maxConcealed))
+	}
+	voiceDecoder, err := decoder.NewOpusDecoder(sampleRate, defaultNumChannels, decoderOpts...)
+	if err != nil {
+		return nil, decodeResult{}, fmt.Errorf("failed to initialize OpusDecoder: %w", err)
+	}
+	voiceDecoder.SetLossConcealment(lossMode)
+	if err := voiceDecoder.SetGainDB(gainDB); err != nil {
+		return nil, decodeResult{}, err
+	}
+	// Raw PCM chunks bypass the Opus decoder, so they get the same gain here
+	rawGain := headroomScale(-float64(gainDB))
+	// The rest of the decode reads the rate and layout from the decoder so they cannot drift apart
+	sampleRate = voiceDecoder.SampleRate()
+	channels := voiceDecoder.Channels()
+	o := make([]float32, 0, 1024)
+	var mismatches int
+	var mismatchedID uint64
+	var rateMismatches, chunkRate int
+	var otherLayouts int
+	var otherLayout string
+	var skipErr error
+	var voicedPackets int
+	var stats decoder.DecodeStats
+	// Silence is held back until the next audio or the end, so a run of silence packets becomes
+	// one allocation rather than one per packet
+	var pendingSilence int
+	silenceFrameSamples := decoder.SteamFrameSamples(sampleRate)
+	offsets := make([]int, len(payloads))
+	decoded := len(payloads)
+	for i, payload := range payloads {
+		offsets[i] = len(o)/channels + pendingSilence
+		if maxSamples > 0 && offsets[i] >= maxSamples {
+			decoded = i
+			break
+		}
+		c, err := voicepacket.DecodeChunk(payload)
+		if err != nil {
+			stats.SkippedPackets++
+			skipErr = fmt.Errorf("failed to decode chunk: %w", err)
+			continue
+		}
+		// A chunk SteamID that differs from the message xuid points at a parsing bug or an unusual demo
+		if c.SteamID != xuid {
+			mismatches++
+			mismatchedID = c.SteamID
+		}
+		// Layouts other than the usual one point at a game update changing the packet format
+		if !c.IsStandardLayout() {
+			otherLayouts++
+			otherLayout = c.LayoutString()
+		}
+		if messageRate > 0 && c.SampleRate != 0 && int(c.SampleRate) != messageRate {
+			rateMismatches++
+			chunkRate = int(c.SampleRate)
+		}
+		if len(c.Data) == 0 {
+			stats.SilenceFrames += c.SilenceFrames()
+			if silenceGaps {
+				pendingSilence += c.SilenceFrames() * silenceFrameSamples
+			}
+			continue
+		}
+		o = appendSilence(o, pendingSilence*channels)
+		pendingSilence = 0
+		var pcm []float32
+		if c.VoiceType == voicepacket.VoiceTypeRaw {
+			pcm = decoder.DecodeRawPCM(c.Data, int(c.SampleRate), sampleRate)
+			scalePCM(pcm, rawGain)
+			stats.Frames++
+			stats.VoicedSamples += len(pcm) / channels
+		} else {
+			pcm, err = voiceDecoder.Decode(c.Data)
+			if err != nil {
+				stats.SkippedPackets++
+				skipErr = fmt.Errorf("failed to decode Opus frame: %w", err)
+				continue
+			}
+		}
+		o, err = appendPCM(o, pcm, channels, peak)
+		if err != nil {
+			stats.SkippedPackets++
+			skipErr = err
+			continue
+		}
+		voicedPackets++
+	}
+	if voicedPackets == 0 && skipErr != nil {
+		return nil, decodeResult{}, skipErr
+	}
+	if stats.SkippedPackets > 0 {
+		slog.Warn("Skipped voice packets that failed to parse or decode",
+			"xuid", xuid, "skipped", stats.SkippedPackets, "packets", len(payloads), "lastError", skipErr)
+	}
+	if mismatches > 0 {
+		slog.Warn("Chunk SteamID does not match net message xuid",
+			"xuid", xuid, "chunkSteamID", mismatchedID, "mismatches", mismatches, "packets", len(payloads))
+	}
+	if otherLayouts > 0 {
+		slog.Warn("Voice packets use a non-standard header layout",
+			"xuid", xuid, "layout", otherLayout, "packets", otherLayouts, "total", len(payloads))
+	}
+	if rateMismatches > 0 {
+		slog.Info("Chunk sample rate differs from the net message's, using the net message's",
+			"xuid", xuid, "messageRate", messageRate, "chunkRate", chunkRate, "mismatches", rateMismatches, "packets", len(payloads))
+	}
+	o = appendSilence(o, pendingSilence*channels)
+	o = capSamples(o, offsets, decoded, maxSamples, channels)
+	stats.SteamIDMismatches = mismatches
+	stats.Add(voiceDecoder.Stats())
+	return o, decodeResult{
+		Duration:       samplesDuration(len(o), sampleRate, channels),
+		VoicedDuration: samplesDuration(stats.VoicedSamples, sampleRate, 1),
+		SampleRate:     sampleRate,
+		Samples:        len(o) / channels,
+		PacketOffsets:  offsets,
+		Stats:          stats,
+	}, nil
+}
+
+// decodeOpusVoice decodes Opus-format voice data into float PCM at sampleRate,
+// which must be a rate supported by Opus. Packets that fail to decode are skipped.
+// Samples are raised by gainDB decibels and clamped with full scale mapped to peak. Decoding
+// stops once maxSamples samples per channel have been produced (0 means unlimited).
+func decodeOpusVoice(data [][]byte, sampleRate, gainDB, maxSamples int, peak float32) ([]float32, decodeResult, error) {
+	opusDecoder, err := decoder.NewDecoder(sampleRate, defaultNumChannels)
+	if err != nil {
+		return nil, decodeResult{}, fmt.Errorf("failed to initialize OpusDecoder: %w", err)
+	}
+	gain := headroomScale(-float64(gainDB))
+	var pcmBuffer []float32
+	var stats decoder.DecodeStats
+	offsets := make([]int, len(data))
+	decoded := len(data)
+	for i, d := range data {
+		offsets[i] = len(pcmBuffer) / defaultNumChannels
+		if maxSamples > 0 && offsets[i] >= maxSamples {
+			decoded = i
+			break
+		}
+		pcm, err := decoder.Decode(opusDecoder, d)
+		if err != nil {
+			slog.Warn("Failed to decode Opus data", "error", err)
+			stats.SkippedPackets++
+			continue
+		}
+		scalePCM(pcm, gain)
+		pcmBuffer, err = appendPCM(pcmBuffer, pcm, defaultNumChannels, peak)
+		if err != nil {
+			slog.Warn("Dropping Opus packet with a partial frame", "error", err)
+			stats.SkippedPackets++
+			continue
+		}
+		stats.Frames++
+		stats.VoicedSamples += len(pcm) / defaultNumChannels
+	}
+	pcmBuffer = capSamples(pcmBuffer, offsets, decoded, maxSamples, defaultNumChannels)
+	return pcmBuffer, decodeResult{
+		Duration:       samplesDuration(len(pcmBuffer), sampleRate, defaultNumChannels),
+		VoicedDuration: samplesDuration(stats.VoicedSamples, sampleRate, 1),
+		SampleRate:     sampleRate,
+		Samples:        len(pcmBuffer) / defaultNumChannels,
+		PacketOffsets:  offsets,
+		Stats:          stats,
+	}, nil
+}
+
+// formatRun is a stretch of consecutive packets of one player in the same voice data format.
+type formatRun struct {
+	Format string
+	// Start and End delimit the run's packets (end exclusive)
+	Start, End int
+}
+
+// splitFormatRuns splits a player's packet formats into runs of consecutive equal formats.
+func splitFormatRuns(formats []string) []formatRun {
+	var runs []formatRun
+	for i, format := range formats {
+		if len(runs) > 0 && runs[len(runs)-1].Format == format {
+			runs[len(runs)-1].End = i + 1
+			continue
+		}
+		runs = append(runs, formatRun{Format: format, Start: i, End: i + 1})
+	}
+	return runs
+}
+
+// decodePlayerVoice decodes a player's packets to float PCM, with full scale lowered by
+// opts.Headroom. It is the one decode path behind extraction, in-memory decoding and
+// verification; writers convert the samples to integers at their bit depth. Packets are split into runs of the
+// same voice data format, so a player whose format changes mid-demo keeps every packet; each run is
+// decoded with its format's decoder and the audio is concatenated. Runs are joined without a
+// crossfade, so a format change can leave a click at the join. All runs share one sample rate:
+// opts.TargetSampleRate if set, otherwise messageRate (the rate the player's net messages report,
+// 0 if none) when Opus can decode at it, otherwise the rate in the header of the player's first
+// Steam packet when Opus can decode at it, otherwise the Opus rate when any run is Opus, else the
+// Steam rate. With opts.Preview, decoding stops once that much audio has been produced, and the
+// remaining packets are not decoded. Runs of an unknown format go to opts.UnknownFormatHandler, or are skipped with a warning.
+// When no samples are produced ErrNoAudio is returned with the result, unless opts.KeepEmpty is set.
+func decodePlayerVoice(playerId string, payloads [][]byte, formats []string, messageRate int, opts ExtractOptions) ([]float32, decodeResult, error) {
+	peak := headroomScale(opts.Headroom)
+	runs := splitFormatRuns(formats)
+
+	sampleRate := opts.TargetSampleRate
+	if sampleRate == 0 && messageRate > 0 {
+		if opusSampleRates[messageRate] {
+			sampleRate = messageRate
+		} else {
+			slog.Warn("Net messages report a sample rate Opus cannot decode at, using the default",
+				"player", playerId, "messageRate", messageRate)
+		}
+	}
+	if sampleRate == 0 {
+		if chunkRate := steamPacketRate(payloads, formats); opusSampleRates[chunkRate] {
+			sampleRate = chunkRate
+		} else if chunkRate != 0 {
+			slog.Warn("Voice packets report a sample rate Opus cannot decode at, using the default",
+				"player", playerId, "chunkRate", chunkRate)
+		}
+	}
+	if sampleRate == 0 {
+		sampleRate = defaultSteamSampleRate
+		for _, run := range runs {
+			if run.Format == voiceFormatOpus {
+				sampleRate = defaultOpusSampleRate
+			}
+		}
+	}
+	if len(runs) > 1 {
+		slog.Debug("Player voice changes format mid-demo", "player", playerId, "runs", len(runs), "sampleRate", sampleRate)
+	}
+
+	// A preview stops decoding once it has opts.Preview of audio
+	previewSamples := int(time.Duration(sampleRate) * opts.Preview / time.Second)
+
+	var pcm []float32
+	result := decodeResult{SampleRate: sampleRate, PacketOffsets: make([]int, len(payloads))}
+	for _, run := range runs {
+		base := len(pcm) / defaultNumChannels
+		runPayloads := payloads[run.Start:run.End]
+
+		maxSamples := 0
+		if previewSamples > 0 {
+			maxSamples = previewSamples - base
+			if maxSamples <= 0 {
+				for i := run.Start; i < run.End; i++ {
+					result.PacketOffsets[i] = base
+				}
+				continue
+			}
+		}
+
+		var runPCM []float32
+		var runResult decodeResult
+		var err error
+		switch run.Format {
+		case voiceFormatOpus:
+			runPCM, runResult, err = decodeOpusVoice(runPayloads, sampleRate, opts.Gain, maxSamples, peak)
+		case voiceFormatSteam:
+			if !hasSteamHeader(runPayloads) {
+				// Without the Steam packet header there is no sample rate or codec to go on
+				slog.Warn("Steam-format voice without the Steam packet header, likely raw PCM from a demo recorded with voice compression disabled; skipping",
+					"player", playerId, "format", run.Format, "formatValue", msgs2.VoiceDataFormatT_value[run.Format], "packets", len(runPayloads))
+				for i := run.Start; i < run.End; i++ {
+					result.PacketOffsets[i] = base
+				}
+				continue
+			}
+			xuid, _ := strconv.ParseUint(playerId, 10, 64)
+			if opts.KeyByUserID {
+				// The key is a user ID, so check the chunks against the first speaker's own SteamID
+				xuid, _ = strconv.ParseUint(resolveSourceID(playerId, runPayloads, formats[run.Start:run.End]), 10, 64)
+			}
+			runPCM, runResult, err = decodeSteamVoice(runPayloads, xuid, sampleRate, messageRate, opts.LossConcealment, opts.MaxConcealedFrames, opts.SilenceGaps, opts.Gain, maxSamples, peak)
+		default:
+			if opts.UnknownFormatHandler != nil {
+				slog.Debug("Passing unknown voice data format to handler", "player", playerId, "format", run.Format)
+				opts.UnknownFormatHandler(playerId, run.Format, runPayloads)
+			} else if run.Format == voiceFormatEngine {
+				slog.Warn("Voice data uses the engine codec rather than Opus, likely a demo recorded with voice compression disabled; skipping",
+					"player", playerId, "format", run.Format, "formatValue", msgs2.VoiceDataFormatT_value[run.Format], "packets", len(runPayloads))
+			} else {
+				slog.Warn("Unknown voice data format", "player", playerId, "format", run.Format,
+					"formatValue", msgs2.VoiceDataFormatT_value[run.Format], "packets", len(runPayloads))
+			}
+			for i := run.Start; i < run.End; i++ {
+				result.PacketOffsets[i] = base
+			}
+			continue
+		}
+		if err != nil {
+			return nil, decodeResult{}, err
+		}
+		// The WAV header takes its rate from the result, so it must match what the decoder produced
+		if runResult.SampleRate != result.SampleRate {
+			return nil, decodeResult{}, fmt.Errorf("voice decoded at %d Hz, expected %d Hz", runResult.SampleRate, result.SampleRate)
+		}
+
+		pcm = append(pcm, runPCM...)
+		for i, offset := range runResult.PacketOffsets {
+			result.PacketOffsets[run.Start+i] = base + offset
+		}
+		result.VoicedDuration += runResult.VoicedDuration
+		result.Stats.Add(runResult.Stats)
+	}
+
+	result.Samples = len(pcm) / defaultNumChannels
+	result.Duration = samplesDuration(len(pcm), sampleRate, defaultNumChannels)
+	// A preview cut can fall inside a packet whose whole length was counted as voiced
+	result.VoicedDuration = min(result.VoicedDuration, result.Duration)
+	if len(pcm) == 0 && !opts.KeepEmpty {
+		return nil, result, ErrNoAudio
+	}
+	return pcm, result, nil
+}
+
+// steamPacketRate returns the sample rate in the header of the first Steam-format packet that
+// has one, or 0 if none does.
+func steamPacketRate(payloads [][]byte, formats []string) int {
+	for i, payload := range payloads {
+		if i >= len(formats) || formats[i] != voiceFormatSteam {
+			continue
+		}
+		if c, err := voicepacket.DecodeChunk(payload); err == nil && c.SampleRate != 0 {
+			return int(c.SampleRate)
+		}
+	}
+	return 0
+}
+
+// hasSteamHeader reports whether the first non-empty payload is a Steam voice packet: it parses
+// in any known layout, or carries a header record byte after its SteamID. Only the first is
+// checked; later packets are validated on decode.
+func hasSteamHeader(payloads [][]byte) bool {
+	for _, payload := range payloads {
+		if len(payload) == 0 {
+			continue
+		}
+		if _, err := voicepacket.DecodeChunk(payload); err == nil {
+			return true
+		}
+		return len(payload) > 8 && voicepacket.IsHeaderRecord(payload[8])
+	}
+	return true
+}
+
+// writeWav encodes integer PCM samples to a WAV file at fileName with bitDepth bits per sample,
+// using the named encoder (WAVEncoderGoAudio or WAVEncoderNative); the samples must already be
+// in that depth's range (see fullScaleValue).
+// On failure the partial file is removed, so it is not later mistaken for a finished output.
+func writeWav(fileName string, pcm []int, sampleRate, bitDepth int, encoder string) (err error) {
+	file, err := os.Create(fileName)
+	if err != nil {
+		return fmt.Errorf("failed to create wav file: %w", err)
+	}
+	defer func() {
+		// Close before removing; a failed close loses buffered data, so it counts as a failure
+		if closeErr := file.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("failed to close WAV file: %w", closeErr)
+		}
+		if err != nil {
+			os.Remove(fileName)
+		}
+	}()
+	return encodeWav(file, pcm, sampleRate, bitDepth, encoder)
+}
+
+// encodeWav encodes integer PCM samples as WAV to w with the named encoder. The go-audio
+// encoder seeks back to fill in the header sizes once all samples are written, so w must be seekable.
+func encodeWav(w io.WriteSeeker, pcm []int, sampleRate, bitDepth int, encoder string) error {
+	if encoder == WAVEncoderNative {
+		return encodeWavNative(w, pcm, sampleRate, bitDepth)
+	}
+
+	// The samples are integers at every bit depth, 32 included, so the fmt chunk must say PCM;
+	// tagging them as IEEE float would make players read the 32-bit output as noise
+	enc := wav.NewEncoder(w, sampleRate, bitDepth, defaultNumChannels, wavFormatPCM)
+	buffer := &audio.IntBuffer{
+		Data: pcm,
+		Format: &audio.Format{
+			SampleRate:  sampleRate,
+			NumChannels: defaultNumChannels,
+		},
+	}
+	if err := enc.Write(buffer); err != nil {
+		return fmt.Errorf("failed to write WAV data: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return fmt.Errorf("failed to finalize WAV file: %w", err)
+	}
+	return nil
+}
+
+// memWriteSeeker is an in-memory io.WriteSeeker, for encoding a WAV without a file.
+type memWriteSeeker struct {
+	buf []byte
+	pos int
+}
+
+// Write writes p at the current position, growing the buffer as needed.
+func (m *memWriteSeeker) Write(p []byte) (int, error) {
+	if end := m.pos + len(p); end > len(m.buf) {
+		m.buf = slices.Grow(m.buf, end-len(m.buf))[:end]
+	}
+	n := copy(m.buf[m.pos:], p)
+	m.pos += n
+	return n, nil
+}
+
+// Seek sets the position for the next Write.
+func (m *memWriteSeeker) Seek(offset int64, whence int) (int64, error) {
+	var pos int64
+	switch whence {
+	case io.SeekStart:
+		pos = offset
+	case io.SeekCurrent:
+		pos = int64(m.pos) + offset
+	case io.SeekEnd:
+		pos = int64(len(m.buf)) + offset
+	default:
+		return 0, fmt.Errorf("invalid whence: %d", whence)
+	}
+	if pos < 0 {
+		return 0, fmt.Errorf("negative seek position: %d", pos)
+	}
+	m.pos = int(pos)
+	return pos, nil
+}
+
+// Bytes returns the written content.
+func (m *memWriteSeeker) Bytes() []byte {
+	return m.buf
+}
+
+// fullScaleValue returns the largest sample value of a signed integer PCM bit depth,
+// e.g. 8388607 for 24-bit.
+func fullScaleValue(bitDepth int) int {
+	return 1<<(bitDepth-1) - 1
+}
+
+// headroomScale returns the linear factor that lowers full scale by headroomDB decibels.
+func headroomScale(headroomDB float64) float32 {
+	return float32(math.Pow(10, -headroomDB/20))
+}
+
+// samplesDuration returns the playback duration of n interleaved samples.
+func samplesDuration(n, sampleRate, channels int) time.Duration {
+	if sampleRate <= 0 || channels <= 0 {
+		return 0
+	}
+	return time.Duration(n/channels) * time.Second / time.Duration(sampleRate)
+}
@@ -0,0 +1,456 @@
+package extract
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"math"
+	"slices"
+	"strconv"
+	"testing"
+
+	"github.com/DiskMethod/cs2-voice-tools/internal/decoder"
+	"github.com/DiskMethod/cs2-voice-tools/internal/voicepacket"
+)
+
+// testSteamID is a SteamID64 in the individual account range.
+const testSteamID = 76561198000000001
+
+// steamPacket assembles a Steam voice packet in the standard layout at 24kHz, with a valid crc32.
+// For silence packets length is the frame count; otherwise it is the length of data.
+func steamPacket(voiceType byte, length uint16, data []byte) []byte {
+	b := binary.LittleEndian.AppendUint64(nil, testSteamID)
+	b = append(b, voicepacket.PayloadTypeHeader)
+	b = binary.LittleEndian.AppendUint16(b, defaultSteamSampleRate)
+	b = append(b, voiceType)
+	b = binary.LittleEndian.AppendUint16(b, length)
+	b = append(b, data...)
+	return binary.LittleEndian.AppendUint32(b, crc32.ChecksumIEEE(b))
+}
+
+// silencePacket is a Steam silence packet standing for frames frames of 20ms.
+func silencePacket(frames uint16) []byte {
+	return steamPacket(voicepacket.VoiceTypeSilence, frames, nil)
+}
+
+// rawPacket is a Steam raw PCM packet holding the given 16-bit samples, which decode without Opus.
+func rawPacket(samples ...int16) []byte {
+	var data []byte
+	for _, sample := range samples {
+		data = binary.LittleEndian.AppendUint16(data, uint16(sample))
+	}
+	return steamPacket(voicepacket.VoiceTypeRaw, uint16(len(data)), data)
+}
+
+// requireOpus skips a test that creates an Opus decoder in a build without one.
+func requireOpus(t *testing.T) {
+	t.Helper()
+	if err := decoder.CheckOpus(); err != nil {
+		t.Skip(err)
+	}
+}
+
+func TestDecodeSteamVoiceSilenceIsAGap(t *testing.T) {
+	requireOpus(t)
+	payloads := [][]byte{silencePacket(2), silencePacket(1), rawPacket(1000, -1000)}
+	frameSamples := decoder.SteamFrameSamples(defaultSteamSampleRate)
+
+	for _, tt := range []struct {
+		name        string
+		silenceGaps bool
+		// gap is the number of zero samples expected before the raw samples
+		gap int
+	}{
+		{"without silence gaps", false, 0},
+		{"with silence gaps", true, 3 * frameSamples},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			pcm, result, err := decodeSteamVoice(payloads, testSteamID, defaultSteamSampleRate, 0, decoder.LossPLC, 0, tt.silenceGaps, 0, 0, 1)
+			if err != nil {
+				t.Fatalf("decodeSteamVoice: %v", err)
+			}
+			if len(pcm) != tt.gap+2 {
+				t.Fatalf("got %d samples, want %d", len(pcm), tt.gap+2)
+			}
+			for i, v := range pcm[:tt.gap] {
+				if v != 0 {
+					t.Fatalf("gap sample %d = %v, want 0", i, v)
+				}
+			}
+			if pcm[tt.gap] <= 0 || pcm[tt.gap+1] >= 0 {
+				t.Errorf("raw samples = %v, want one positive and one negative", pcm[tt.gap:])
+			}
+			if result.Stats.SilenceFrames != 3 {
+				t.Errorf("SilenceFrames = %d, want 3", result.Stats.SilenceFrames)
+			}
+			if result.Stats.SkippedPackets != 0 {
+				t.Errorf("SkippedPackets = %d, want 0", result.Stats.SkippedPackets)
+			}
+			if got := result.PacketOffsets[2]; got != tt.gap {
+				t.Errorf("raw packet starts at sample %d, want %d", got, tt.gap)
+			}
+		})
+	}
+}
+
+func TestDecodeSteamVoiceCoalescesSilenceRuns(t *testing.T) {
+	requireOpus(t)
+	frameSamples := decoder.SteamFrameSamples(defaultSteamSampleRate)
+	// A run of three silence packets between audio, and a trailing one at the end of the stream
+	payloads := [][]byte{rawPacket(1000), silencePacket(2), silencePacket(3), silencePacket(1), rawPacket(-1000), silencePacket(4)}
+
+	pcm, result, err := decodeSteamVoice(payloads, testSteamID, defaultSteamSampleRate, 0, decoder.LossPLC, 0, true, 0, 0, 1)
+	if err != nil {
+		t.Fatalf("decodeSteamVoice: %v", err)
+	}
+
+	// Each silence packet keeps its own offset inside the coalesced gap
+	wantOffsets := []int{0, 1, 1 + 2*frameSamples, 1 + 5*frameSamples, 1 + 6*frameSamples, 2 + 6*frameSamples}
+	if !slices.Equal(result.PacketOffsets, wantOffsets) {
+		t.Errorf("PacketOffsets = %v, want %v", result.PacketOffsets, wantOffsets)
+	}
+	if want := 2 + 10*frameSamples; len(pcm) != want {
+		t.Fatalf("got %d samples, want %d", len(pcm), want)
+	}
+	if pcm[0] <= 0 || pcm[wantOffsets[4]] >= 0 {
+		t.Errorf("raw samples at the wrong offsets: %v, %v", pcm[0], pcm[wantOffsets[4]])
+	}
+	for i, v := range pcm {
+		if v != 0 && i != 0 && i != wantOffsets[4] {
+			t.Fatalf("gap sample %d = %v, want 0", i, v)
+		}
+	}
+	if result.Stats.SilenceFrames != 10 {
+		t.Errorf("SilenceFrames = %d, want 10", result.Stats.SilenceFrames)
+	}
+}
+
+func TestAppendSilenceGrowsOnce(t *testing.T) {
+	dst := []float32{7}
+	got := appendSilence(dst, 5000)
+	if len(got) != 5001 || got[0] != 7 {
+		t.Fatalf("got %d samples starting %v, want 5001 starting 7", len(got), got[:1])
+	}
+	for i, v := range got[1:] {
+		if v != 0 {
+			t.Fatalf("sample %d = %v, want 0", i+1, v)
+		}
+	}
+	if allocs := testing.AllocsPerRun(10, func() { appendSilence([]float32{7}, 5000) }); allocs > 2 {
+		t.Errorf("appendSilence made %v allocations, want one grow", allocs)
+	}
+}
+
+func TestAppendIntPCMRejectsPartialFrames(t *testing.T) {
+	dst := []int{7}
+
+	got, err := appendIntPCM(dst, []float32{0.5, -0.5, 0.25}, 2, 100)
+	if !errors.Is(err, ErrPartialFrame) {
+		t.Fatalf("3 samples for 2 channels: err = %v, want ErrPartialFrame", err)
+	}
+	if len(got) != 1 || got[0] != 7 {
+		t.Errorf("partial frame changed the buffer to %v", got)
+	}
+
+	got, err = appendIntPCM(dst, []float32{0.5, -0.5}, 2, 100)
+	if err != nil {
+		t.Fatalf("2 samples for 2 channels: %v", err)
+	}
+	if want := []int{7, 50, -50}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestAppendPCMClampsAndScales(t *testing.T) {
+	got, err := appendPCM([]float32{7}, []float32{0.5, -1.5, 1.25, -0.25}, 2, 0.5)
+	if err != nil {
+		t.Fatalf("appendPCM: %v", err)
+	}
+	if want := []float32{7, 0.25, -0.5, 0.5, -0.125}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	if _, err := appendPCM(nil, []float32{0.5, -0.5, 0.25}, 2, 1); !errors.Is(err, ErrPartialFrame) {
+		t.Errorf("3 samples for 2 channels: err = %v, want ErrPartialFrame", err)
+	}
+}
+
+func TestDecodePlayerVoiceKeepsFloatPrecision(t *testing.T) {
+	requireOpus(t)
+	payloads := [][]byte{rawPacket(1, -1, 16384)}
+	formats := []string{voiceFormatSteam}
+	id := strconv.FormatUint(testSteamID, 10)
+
+	for _, tt := range []struct {
+		name     string
+		headroom float64
+		peak     float32
+	}{
+		{"no headroom", 0, 1},
+		{"6 dB headroom", 6, headroomScale(6)},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			pcm, _, err := decodePlayerVoice(id, payloads, formats, 0, ExtractOptions{Headroom: tt.headroom})
+			if err != nil {
+				t.Fatalf("decodePlayerVoice: %v", err)
+			}
+			want := []float32{tt.peak / 32768, -tt.peak / 32768, tt.peak * 0.5}
+			if len(pcm) != len(want) {
+				t.Fatalf("got %d samples, want %d", len(pcm), len(want))
+			}
+			for i := range want {
+				if math.Abs(float64(pcm[i]-want[i])) > 1e-9 {
+					t.Errorf("sample %d = %v, want %v", i, pcm[i], want[i])
+				}
+			}
+		})
+	}
+}
+
+// intPCMReference converts a packet the way the decoders did before appendIntPCM: into a slice
+// of its own, sample by sample.
+func intPCMReference(pcm []float32, maxValue float32) []int {
+	converted := make([]int, len(pcm))
+	for i, v := range pcm {
+		v = max(-1, min(v, 1))
+		converted[i] = min(int(v*maxValue), math.MaxInt32)
+	}
+	return converted
+}
+
+// testPackets returns count packets of n samples sweeping past full scale in both directions.
+func testPackets(count, n int) [][]float32 {
+	packets := make([][]float32, count)
+	for p := range packets {
+		packets[p] = make([]float32, n)
+		for i := range packets[p] {
+			packets[p][i] = float32(math.Sin(float64(p*n+i)/7)) * 1.25
+		}
+	}
+	return packets
+}
+
+func TestAppendIntPCMMatchesPerPacketConversion(t *testing.T) {
+	packets := testPackets(20, 960)
+	packets = append(packets, []float32{-1, 1, 0, -0.5})
+
+	for _, maxValue := range []float32{32767, 8388607, math.MaxInt32} {
+		var got, want []int
+		for _, pcm := range packets {
+			var err error
+			if got, err = appendIntPCM(got, pcm, 2, maxValue); err != nil {
+				t.Fatalf("appendIntPCM: %v", err)
+			}
+			want = append(want, intPCMReference(pcm, maxValue)...)
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("full scale %v: appended samples differ from per-packet conversion", maxValue)
+		}
+	}
+}
+
+func BenchmarkAppendIntPCM(b *testing.B) {
+	// A second of 20ms stereo packets at 48kHz
+	packets := testPackets(50, 1920)
+	b.ReportAllocs()
+	for range b.N {
+		var dst []int
+		for _, pcm := range packets {
+			dst, _ = appendIntPCM(dst, pcm, 2, 32767)
+		}
+	}
+}
+
+func TestDecodeSteamVoiceSkipsBadPackets(t *testing.T) {
+	requireOpus(t)
+	corrupt := rawPacket(500)
+	// Flip a sample byte, leaving the stored crc32 as it was
+	corrupt[len(corrupt)-5] ^= 0xff
+
+	payloads := [][]byte{rawPacket(1000), corrupt, []byte("not a packet"), rawPacket(-1000)}
+	pcm, result, err := decodeSteamVoice(payloads, testSteamID, defaultSteamSampleRate, 0, decoder.LossPLC, 0, false, 0, 0, 1)
+	if err != nil {
+		t.Fatalf("decodeSteamVoice: %v", err)
+	}
+	if len(pcm) != 2 {
+		t.Errorf("got %d samples, want the 2 from the good packets", len(pcm))
+	}
+	if result.Stats.SkippedPackets != 2 {
+		t.Errorf("SkippedPackets = %d, want 2", result.Stats.SkippedPackets)
+	}
+
+	// With nothing decodable, the packet error is returned so callers can match it
+	_, _, err = decodeSteamVoice([][]byte{corrupt}, testSteamID, defaultSteamSampleRate, 0, decoder.LossPLC, 0, false, 0, 0, 1)
+	if !errors.Is(err, voicepacket.ErrMismatchChecksum) {
+		t.Errorf("only a corrupt packet: err = %v, want ErrMismatchChecksum", err)
+	}
+}
+
+func TestDecodePlayerVoiceAllSilence(t *testing.T) {
+	requireOpus(t)
+	payloads := [][]byte{silencePacket(3), silencePacket(2)}
+	formats := []string{voiceFormatSteam, voiceFormatSteam}
+	id := strconv.FormatUint(testSteamID, 10)
+
+	pcm, result, err := decodePlayerVoice(id, payloads, formats, 0, ExtractOptions{})
+	if !errors.Is(err, ErrNoAudio) {
+		t.Fatalf("err = %v, want ErrNoAudio", err)
+	}
+	if len(pcm) != 0 {
+		t.Errorf("got %d samples, want none", len(pcm))
+	}
+	if result.Stats.SilenceFrames != 5 {
+		t.Errorf("SilenceFrames = %d, want 5", result.Stats.SilenceFrames)
+	}
+
+	// KeepEmpty keeps the player, with no audio
+	pcm, _, err = decodePlayerVoice(id, payloads, formats, 0, ExtractOptions{KeepEmpty: true})
+	if err != nil || len(pcm) != 0 {
+		t.Errorf("with KeepEmpty: %d samples, err = %v; want none, nil", len(pcm), err)
+	}
+}
+
+func TestDecodePlayerVoiceSurfacesSentinels(t *testing.T) {
+	requireOpus(t)
+	tampered := rawPacket(500)
+	// Flip a sample byte, leaving the stored crc32 as it was
+	tampered[len(tampered)-5] ^= 0xff
+	// An Opus payload cut off inside its first frame header
+	truncated := steamPacket(voicepacket.VoiceTypeOpusPLC, 1, []byte{0x05})
+	id := strconv.FormatUint(testSteamID, 10)
+
+	for _, tt := range []struct {
+		name    string
+		payload []byte
+		want    error
+	}{
+		{"tampered packet", tampered, voicepacket.ErrMismatchChecksum},
+		{"short packet", rawPacket(500)[:12], voicepacket.ErrInsufficientData},
+		{"truncated Opus frame", truncated, voicepacket.ErrInvalidVoicePacket},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := decodePlayerVoice(id, [][]byte{tt.payload}, []string{voiceFormatSteam}, 0, ExtractOptions{})
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("decodePlayerVoice: err = %v, want %v", err, tt.want)
+			}
+			// ExtractVoiceData wraps each player's error, then all of them, the same way
+			wrapped := fmt.Errorf("%w: %w", ErrNoDecodableVoice, errors.Join(fmt.Errorf("player %s: %w", id, err)))
+			if !errors.Is(wrapped, tt.want) || !errors.Is(wrapped, ErrNoDecodableVoice) {
+				t.Errorf("wrapped error %v lost %v or ErrNoDecodableVoice", wrapped, tt.want)
+			}
+		})
+	}
+}
+
+func TestHeadroomScalesFullScale(t *testing.T) {
+	requireOpus(t)
+	// The most negative sample is exactly full scale; the decoder reads it as -1
+	payloads := [][]byte{rawPacket(math.MinInt16, math.MaxInt16)}
+	formats := []string{voiceFormatSteam}
+	id := strconv.FormatUint(testSteamID, 10)
+
+	for _, tt := range []struct {
+		headroom float64
+		bitDepth int
+		// want is the magnitude of the loudest output sample
+		want int
+	}{
+		{0, 16, 32767},
+		{0, 24, 8388607},
+		{3, 16, 23197},
+		{6, 16, 16422},
+		{6, 24, 4204262},
+		{20, 32, 214748364},
+	} {
+		pcm, _, err := decodePlayerVoice(id, payloads, formats, 0, ExtractOptions{Headroom: tt.headroom})
+		if err != nil {
+			t.Fatalf("decodePlayerVoice: %v", err)
+		}
+		samples, err := appendIntPCM(nil, pcm, defaultNumChannels, float32(fullScaleValue(tt.bitDepth)))
+		if err != nil {
+			t.Fatalf("appendIntPCM: %v", err)
+		}
+		// float32 keeps 24 bits of precision, so 32-bit samples are only that close
+		tolerance := max(1, tt.want>>22)
+		if got := -samples[0]; got < tt.want-tolerance || got > tt.want+tolerance {
+			t.Errorf("%v dB at %d bits: loudest sample %d, want %d", tt.headroom, tt.bitDepth, got, tt.want)
+		}
+		if samples[1] > -samples[0] {
+			t.Errorf("%v dB at %d bits: positive peak %d above full scale %d", tt.headroom, tt.bitDepth, samples[1], -samples[0])
+		}
+	}
+}
+
+func TestSplitFormatRuns(t *testing.T) {
+	steam, opus := voiceFormatSteam, voiceFormatOpus
+	for _, tt := range []struct {
+		name    string
+		formats []string
+		want    []formatRun
+	}{
+		{"empty", nil, nil},
+		{"one format", []string{steam, steam}, []formatRun{{steam, 0, 2}}},
+		{"format changes", []string{steam, opus, opus, steam}, []formatRun{{steam, 0, 1}, {opus, 1, 3}, {steam, 3, 4}}},
+	} {
+		if got := splitFormatRuns(tt.formats); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDecodePlayerVoiceMixedFormats(t *testing.T) {
+	requireOpus(t)
+	id := strconv.FormatUint(testSteamID, 10)
+	// A CELT-only 20ms mono frame
+	opusFrame := []byte{0xf8, 0x00}
+
+	for _, tt := range []struct {
+		name     string
+		payloads [][]byte
+		formats  []string
+		// opusAt is the index of the Opus packet, or -1 if there is none
+		opusAt int
+	}{
+		{
+			name:     "Steam, Opus, Steam",
+			payloads: [][]byte{rawPacket(1000), opusFrame, rawPacket(-1000)},
+			formats:  []string{voiceFormatSteam, voiceFormatOpus, voiceFormatSteam},
+			opusAt:   1,
+		},
+		{
+			name:     "unknown format between Steam runs",
+			payloads: [][]byte{rawPacket(1000), []byte("engine"), rawPacket(-1000)},
+			formats:  []string{voiceFormatSteam, voiceFormatEngine, voiceFormatSteam},
+			opusAt:   -1,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			pcm, result, err := decodePlayerVoice(id, tt.payloads, tt.formats, 0, ExtractOptions{})
+			if err != nil {
+				t.Fatalf("decodePlayerVoice: %v", err)
+			}
+			offsets := result.PacketOffsets
+			if !slices.IsSorted(offsets) || offsets[0] != 0 {
+				t.Fatalf("PacketOffsets = %v, want them in order from 0", offsets)
+			}
+			opusSamples := 0
+			if tt.opusAt >= 0 {
+				opusSamples = offsets[tt.opusAt+1] - offsets[tt.opusAt]
+				if opusSamples == 0 {
+					t.Errorf("the Opus packet produced no audio")
+				}
+			}
+			// Both Steam packets are kept, whatever sits between them
+			if len(pcm) != 2+opusSamples || result.Samples != len(pcm) {
+				t.Fatalf("got %d samples (result says %d), want %d", len(pcm), result.Samples, 2+opusSamples)
+			}
+			if pcm[offsets[0]] <= 0 || pcm[offsets[2]] >= 0 {
+				t.Errorf("Steam samples %v and %v, want one positive and one negative", pcm[offsets[0]], pcm[offsets[2]])
+			}
+			if result.SampleRate != defaultSteamSampleRate {
+				t.Errorf("SampleRate = %d, want the Steam packets' %d", result.SampleRate, defaultSteamSampleRate)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package extract
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// chatFileName is the name of the text chat log written to the output directory.
+const chatFileName = "chat.json"
+
+// chatMessage is one text chat message sent during the demo.
+type chatMessage struct {
+	// Player is the sender's SteamID64 (empty for server messages)
+	Player string `json:"player"`
+	// Name is the sender's name exactly as the demo has it
+	Name string `json:"name"`
+	// DisplayName is Name without control or invisible characters, trimmed and length-limited
+	DisplayName string `json:"displayName"`
+	Team        string `json:"team"`
+	// Time is the demo time the message was sent, in seconds
+	Time    float64 `json:"time"`
+	Message string  `json:"message"`
+	// AllChat is false for team-only messages
+	AllChat bool `json:"allChat"`
+}
+
+// chatDocument is the top-level structure of chat.json.
+type chatDocument struct {
+	Demo     string        `json:"demo"`
+	Messages []chatMessage `json:"messages"`
+}
+
+// writeChat writes the demo's text chat, already in demo-time order, to dir with the given mode
+// and returns its path.
+func writeChat(dir, demoPath string, messages []chatMessage, mode os.FileMode) (string, error) {
+	if messages == nil {
+		messages = []chatMessage{}
+	}
+	data, err := json.MarshalIndent(chatDocument{Demo: demoPath, Messages: messages}, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode chat: %w", err)
+	}
+
+	chatPath := filepath.Join(dir, chatFileName)
+	if err := os.WriteFile(chatPath, data, mode); err != nil {
+		return "", fmt.Errorf("failed to write chat: %w", err)
+	}
+	if err := setMode(chatPath, mode); err != nil {
+		return "", err
+	}
+
+	return chatPath, nil
+}
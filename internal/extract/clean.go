@@ -0,0 +1,55 @@
+package extract
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+)
+
+// artifactAudioName matches audio files named by a voice source's xuid, as ExtractVoiceData writes
+// them, including the numbered clips written when splitting by talk-spurt or by round.
+var artifactAudioName = regexp.MustCompile(`^\d{1,20}(?:_\d{3,}|_round\d{2,})?\.([a-z0-9]+)$`)
+
+// artifactStagingName matches staging files left behind when an extraction was killed before
+// moving an output into place (see stageOutput).
+var artifactStagingName = regexp.MustCompile(`^\.\d{1,20}(?:_\d{3,}|_round\d{2,})?-\d+\.([a-z0-9]+)$`)
+
+// artifactFileNames are the non-audio files ExtractVoiceData may write to the output directory.
+var artifactFileNames = map[string]bool{
+	playlistFileName:   true,
+	timelineFileName:   true,
+	manifestFileName:   true,
+	chatFileName:       true,
+	resumeManifestName: true,
+}
+
+// FindArtifacts lists the files in dir that match the names ExtractVoiceData writes:
+// xuid-named audio files in a supported format, staging files of interrupted writes, and the
+// playlist, timeline, manifest, chat and resume files.
+// Subdirectories and any other file are never included. Paths are returned sorted.
+func FindArtifacts(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read output directory '%s': %w", dir, err)
+	}
+
+	artifacts := []string{}
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		name := entry.Name()
+		if match := artifactAudioName.FindStringSubmatch(name); match != nil && supportedFormatsMap[match[1]] {
+			artifacts = append(artifacts, filepath.Join(dir, name))
+		} else if match := artifactStagingName.FindStringSubmatch(name); match != nil && supportedFormatsMap[match[1]] {
+			artifacts = append(artifacts, filepath.Join(dir, name))
+		} else if artifactFileNames[name] {
+			artifacts = append(artifacts, filepath.Join(dir, name))
+		}
+	}
+
+	sort.Strings(artifacts)
+	return artifacts, nil
+}
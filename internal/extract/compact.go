@@ -0,0 +1,83 @@
+package extract
+
+import (
+	"sort"
+	"time"
+)
+
+const (
+	// defaultCompactGap is the silence CompactTimeline puts between talk-spurts when CompactGap is zero.
+	defaultCompactGap = 750 * time.Millisecond
+
+	// compactQuietLevel is the level, as a fraction of full scale (-60 dBFS), at or below which
+	// audio at the edges of a talk-spurt is trimmed by CompactTimeline.
+	compactQuietLevel = 0.001
+)
+
+// compactSpurt is a talk-spurt's kept audio: samples [oldStart, oldEnd) of the input, moved to newStart.
+type compactSpurt struct {
+	oldStart, oldEnd, newStart int
+}
+
+// compactBySpurt rebuilds a decoded player's audio from its talk-spurts alone, in order, with gap
+// of silence between consecutive spurts. Quiet audio (see compactQuietLevel) at each spurt's edges
+// is trimmed, and spurts left empty are dropped. Packet offsets are moved with their audio; a
+// packet whose audio was removed is placed at the start of the next kept spurt. fullScale is the
+// sample value of 0 dBFS. The player's audio is left untouched; a compacted copy is returned.
+func compactBySpurt(p decodedPlayer, spurts []timelineSpurt, gap time.Duration, fullScale int) decodedPlayer {
+	spurts = append([]timelineSpurt(nil), spurts...)
+	sort.SliceStable(spurts, func(i, j int) bool { return spurts[i].StartSample < spurts[j].StartSample })
+
+	gapSamples := int(time.Duration(p.result.SampleRate) * gap / time.Second)
+	quiet := int(float64(fullScale) * compactQuietLevel)
+	isQuiet := func(v int) bool { return v <= quiet && v >= -quiet }
+
+	pcm := make([]int, 0, len(p.pcm))
+	var kept []compactSpurt
+	prevEnd := 0
+	for _, spurt := range spurts {
+		// Overlapping spurts (from a VAD) keep each sample once
+		start, end := max(spurt.StartSample, prevEnd), min(spurt.EndSample, len(p.pcm))
+		for start < end && isQuiet(p.pcm[start]) {
+			start++
+		}
+		for end > start && isQuiet(p.pcm[end-1]) {
+			end--
+		}
+		if end <= start {
+			continue
+		}
+		prevEnd = end
+
+		if len(kept) > 0 {
+			pcm = append(pcm, make([]int, gapSamples)...)
+		}
+		kept = append(kept, compactSpurt{oldStart: start, oldEnd: end, newStart: len(pcm)})
+		pcm = append(pcm, p.pcm[start:end]...)
+	}
+
+	// Offsets never decrease, so one pass over the kept spurts maps them all
+	offsets := make([]int, len(p.result.PacketOffsets))
+	next := 0
+	for i, offset := range p.result.PacketOffsets {
+		for next < len(kept) && offset >= kept[next].oldEnd {
+			next++
+		}
+		switch {
+		case next == len(kept):
+			offsets[i] = len(pcm)
+		case offset >= kept[next].oldStart:
+			offsets[i] = kept[next].newStart + offset - kept[next].oldStart
+		default:
+			offsets[i] = kept[next].newStart
+		}
+	}
+
+	compacted := p
+	compacted.pcm = pcm
+	compacted.result.Samples = len(pcm) / defaultNumChannels
+	compacted.result.Duration = samplesDuration(len(pcm), p.result.SampleRate, defaultNumChannels)
+	compacted.result.VoicedDuration = min(p.result.VoicedDuration, compacted.result.Duration)
+	compacted.result.PacketOffsets = offsets
+	return compacted
+}
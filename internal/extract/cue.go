@@ -0,0 +1,120 @@
+package extract
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+)
+
+// cueRegion is a span of samples in a WAV file, labelled for display in audio editors.
+type cueRegion struct {
+	Start  int
+	Length int
+	Label  string
+}
+
+// packetCueRegions returns one region per input packet that produced audio, from the packet's
+// first sample up to the next packet's, labelled with the packet's index in the player's stream.
+func packetCueRegions(offsets []int, totalSamples int) []cueRegion {
+	var regions []cueRegion
+	for i, start := range offsets {
+		end := totalSamples
+		if i+1 < len(offsets) {
+			end = offsets[i+1]
+		}
+		if end <= start {
+			continue
+		}
+		regions = append(regions, cueRegion{Start: start, Length: end - start, Label: fmt.Sprintf("packet %d", i)})
+	}
+	return regions
+}
+
+// appendCueRegions appends a cue chunk and an associated data list (labl and ltxt entries) to the
+// finished WAV file at path, marking regions so editors show them, and updates the RIFF size.
+func appendCueRegions(path string, regions []cueRegion) error {
+	if len(regions) == 0 {
+		return nil
+	}
+
+	var cue bytes.Buffer
+	binary.Write(&cue, binary.LittleEndian, uint32(len(regions)))
+	for i, r := range regions {
+		binary.Write(&cue, binary.LittleEndian, uint32(i+1)) // cue point ID
+		binary.Write(&cue, binary.LittleEndian, uint32(r.Start))
+		cue.WriteString("data")
+		binary.Write(&cue, binary.LittleEndian, [2]uint32{0, 0}) // chunk start, block start
+		binary.Write(&cue, binary.LittleEndian, uint32(r.Start))
+	}
+
+	var adtl bytes.Buffer
+	adtl.WriteString("adtl")
+	for i, r := range regions {
+		// ltxt gives the region its length; country, language, dialect and code page are left zero
+		var ltxt bytes.Buffer
+		binary.Write(&ltxt, binary.LittleEndian, uint32(i+1))
+		binary.Write(&ltxt, binary.LittleEndian, uint32(r.Length))
+		ltxt.WriteString("rgn ")
+		binary.Write(&ltxt, binary.LittleEndian, [4]uint16{})
+		writeRIFFChunk(&adtl, "ltxt", ltxt.Bytes())
+
+		var labl bytes.Buffer
+		binary.Write(&labl, binary.LittleEndian, uint32(i+1))
+		labl.WriteString(r.Label)
+		labl.WriteByte(0)
+		writeRIFFChunk(&adtl, "labl", labl.Bytes())
+	}
+
+	var chunks bytes.Buffer
+	writeRIFFChunk(&chunks, "cue ", cue.Bytes())
+	writeRIFFChunk(&chunks, "LIST", adtl.Bytes())
+
+	if err := appendRIFFChunks(path, chunks.Bytes()); err != nil {
+		return fmt.Errorf("failed to append cues: %w", err)
+	}
+	return nil
+}
+
+// appendRIFFChunks appends already encoded chunks to the finished WAV file at path and updates
+// the RIFF size to cover them. A data chunk of odd length is left unpadded by the encoders, so
+// the pad byte is added first to keep the appended chunks on an even offset.
+func appendRIFFChunks(path string, chunks []byte) error {
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	size, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	if size%2 == 1 {
+		chunks = append([]byte{0}, chunks...)
+	}
+	if _, err := file.Write(chunks); err != nil {
+		return err
+	}
+
+	// The RIFF size at offset 4 covers everything after the first 8 bytes
+	riffSize := uint32(size + int64(len(chunks)) - 8)
+	if _, err := file.Seek(4, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to update RIFF size: %w", err)
+	}
+	if err := binary.Write(file, binary.LittleEndian, riffSize); err != nil {
+		return fmt.Errorf("failed to update RIFF size: %w", err)
+	}
+	return file.Close()
+}
+
+// writeRIFFChunk writes a chunk header and data to buf, padding the data to an even length.
+func writeRIFFChunk(buf *bytes.Buffer, id string, data []byte) {
+	buf.WriteString(id)
+	binary.Write(buf, binary.LittleEndian, uint32(len(data)))
+	buf.Write(data)
+	if len(data)%2 == 1 {
+		buf.WriteByte(0)
+	}
+}
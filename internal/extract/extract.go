@@ -2,22 +2,22 @@
 package extract
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"log/slog"
+	"math"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"regexp"
-	"strconv"
+	"runtime"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/DiskMethod/cs2-voice-tools/internal/decoder"
-
-	"github.com/go-audio/audio"
-	"github.com/go-audio/wav"
-	dem "github.com/markus-wa/demoinfocs-golang/v4/pkg/demoinfocs"
-	"github.com/markus-wa/demoinfocs-golang/v4/pkg/demoinfocs/msgs2"
 )
 
 // Default audio parameters for decoding CS2 demo voice data.
@@ -28,10 +28,32 @@ const (
 	defaultOpusSampleRate = 48000
 	// defaultNumChannels is the number of audio channels (mono audio).
 	defaultNumChannels = 1
-	// defaultBitDepth is the bit depth for output WAV files.
+	// defaultBitDepth is the bit depth for output WAV files, written as integer PCM rather than float.
 	defaultBitDepth = 32
-	// intPCMMaxValue is the maximum integer value for PCM normalization.
-	intPCMMaxValue = 2147483647
+	// defaultReadBufferSize is the size (bytes) of the buffer between the demo file and the parser.
+	defaultReadBufferSize = 1 << 20
+)
+
+// writerOutputPath stands in for the path of an output written to ExtractOptions.OutputWriter,
+// in logs and the result.
+const writerOutputPath = "-"
+
+// SteamID64 range for individual accounts
+const (
+	// steamID64IndividualBase is the first SteamID64 of the individual account range
+	steamID64IndividualBase = 76561197960265728
+	// steamID64IndividualSpan is the number of account IDs in the individual range
+	steamID64IndividualSpan = 1 << 32
+)
+
+// Voice data formats reported by the demo's voice messages
+const (
+	// voiceFormatSteam is Steam voice packets carrying Opus PLC frames
+	voiceFormatSteam = "VOICEDATA_FORMAT_STEAM"
+	// voiceFormatOpus is bare Opus packets
+	voiceFormatOpus = "VOICEDATA_FORMAT_OPUS"
+	// voiceFormatEngine is the engine's own voice codec, which is not decoded
+	voiceFormatEngine = "VOICEDATA_FORMAT_ENGINE"
 )
 
 // File permission constants
@@ -56,18 +78,64 @@ var (
 	// ErrOutputDirNotWritable is returned when the output directory cannot be written to
 	ErrOutputDirNotWritable = errors.New("output directory is not writable")
 
+	// ErrDemoParsePanic is returned when the demo parser panics, typically on a severely malformed demo
+	ErrDemoParsePanic = errors.New("demo parser panicked")
+
+	// ErrNoAudio is returned when a player's voice data decodes to zero samples, such as a player
+	// who only sent silence, and empty players are not kept
+	ErrNoAudio = errors.New("no decodable audio")
+
+	// ErrPartialFrame is returned when decoded PCM does not hold a whole number of frames
+	// for the channel count, which would desynchronize interleaved channels
+	ErrPartialFrame = errors.New("decoded PCM is not a whole number of frames")
+
+	// ErrNoDecodableVoice is returned when players had voice data but none of it could be decoded.
+	// It wraps each player's decode error, so the decoder's sentinel errors can be matched with errors.Is
+	ErrNoDecodableVoice = errors.New("no voice data could be decoded")
+
+	// ErrUnsafeFFmpegArg is returned when a passthrough ffmpeg argument would alter the input/output mapping
+	ErrUnsafeFFmpegArg = errors.New("unsafe ffmpeg argument")
+
+	// unsafeFFmpegArgs are ffmpeg options rejected as passthrough arguments
+	unsafeFFmpegArgs = map[string]bool{
+		"-i":              true,
+		"-map":            true,
+		"-filter_complex": true,
+		"-lavfi":          true,
+	}
+
+	// ErrOutputPathIsFile is returned when the output directory points at an existing file
+	ErrOutputPathIsFile = errors.New("output path is a file, expected a directory")
+
+	// supportedBitDepths are the integer PCM bit depths WAV files can be written with
+	supportedBitDepths = map[int]bool{16: true, 24: true, 32: true}
+
+	// opusSampleRates are the output sample rates an Opus decoder can produce
+	opusSampleRates = map[int]bool{8000: true, 12000: true, 16000: true, 24000: true, 48000: true}
+
 	// supportedFormats is the list of audio formats supported by this tool
-	supportedFormats = []string{"wav", "mp3", "ogg", "flac", "aac", "m4a"}
+	supportedFormats = []string{"wav", "mp3", "ogg", "opus", "flac", "aac", "m4a"}
 
 	// supportedFormatsMap provides O(1) lookup for format validation
 	supportedFormatsMap = map[string]bool{
 		"wav":  true,
 		"mp3":  true,
 		"ogg":  true,
+		"opus": true,
 		"flac": true,
 		"aac":  true,
 		"m4a":  true,
 	}
+
+	// formatAliases maps other names users give for a format to the supported name
+	formatAliases = map[string]string{
+		"wave":   "wav",
+		"mpeg":   "mp3",
+		"mpga":   "mp3",
+		"vorbis": "ogg",
+		"oga":    "ogg",
+		"mp4":    "m4a",
+	}
 )
 
 // GetSupportedFormats returns the list of audio formats supported by this tool.
@@ -76,32 +144,313 @@ func GetSupportedFormats() []string {
 	return supportedFormats
 }
 
+// GetNativeFormats returns the supported formats that are written without ffmpeg when the given
+// Ogg encoder is in use (see ExtractOptions.OggEncoder).
+func GetNativeFormats(oggEncoder string) []string {
+	if oggEncoder == OggEncoderNative {
+		return []string{"wav", "ogg"}
+	}
+	return []string{"wav"}
+}
+
+// HasAudioExtension reports whether path ends in the extension of a supported audio format.
+// Used to detect when an output "directory" was most likely meant as a file name.
+func HasAudioExtension(path string) bool {
+	ext := strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	return supportedFormatsMap[ext]
+}
+
 // ExtractOptions contains all configuration options for the voice data extraction process.
 type ExtractOptions struct {
-	// DemoPath is the path to the CS2 demo file
+	// Source supplies the demo bytes. If nil, it is built from DemoPath, DemoEntry and the HTTP
+	// options with NewDemoSource
+	Source DemoSource
+
+	// DemoPath is the path to the CS2 demo file, or a zip archive containing one
+	// An http:// or https:// URL is downloaded and streamed into the parser without saving to disk,
+	// and "-" reads the demo from stdin. With Source set, it only names the demo in output files
 	DemoPath string
 
+	// HTTPTimeout limits the whole download when DemoPath is a URL (zero means no limit)
+	HTTPTimeout time.Duration
+
+	// HTTPAuthHeader is an optional "Name: value" header sent when DemoPath is a URL
+	HTTPAuthHeader string
+
+	// DemoEntry selects the demo inside a zip archive by name
+	// If empty, the first .dem entry in the archive is used
+	DemoEntry string
+
 	// OutputDir is the directory where extracted audio files will be saved
 	OutputDir string
 
 	// ForceOverwrite determines whether existing files should be overwritten
 	ForceOverwrite bool
 
-	// PlayerIDs is an optional slice of SteamID64s to filter by
+	// PlayerIDs is an optional slice of SteamID64s to filter by (user IDs with KeyByUserID)
 	// If empty, all players' voice data will be extracted
 	PlayerIDs []string
 
 	// Format specifies the output audio format (wav, mp3, ogg, etc.)
 	Format string
+
+	// OutputFile is an optional explicit path for the output file
+	// Only valid when exactly one player is extracted; OutputDir is ignored when set
+	OutputFile string
+
+	// MaxPlayers, if positive, extracts only the players with the most voice packets, as a quick
+	// preview of the most active speakers. Ignored when PlayerIDs is set
+	MaxPlayers int
+
+	// IncludeBots extracts voice sources whose xuid is not an individual SteamID64
+	// (bots, SourceTV). These are skipped by default since they only produce junk files
+	IncludeBots bool
+
+	// BitDepth is the integer sample size of the WAV output: 16, 24 or 32 (zero means 32).
+	// Converted formats are encoded from this WAV
+	BitDepth int
+
+	// WAVEncoder selects the WAV writer: WAVEncoderGoAudio (default) or WAVEncoderNative, which
+	// writes the chunks directly without go-audio. Both produce the same bytes
+	WAVEncoder string
+
+	// OggEncoder selects how ogg output is produced: OggEncoderFFmpeg (default) converts to Ogg
+	// Vorbis with ffmpeg, OggEncoderNative encodes Ogg Opus with libopus and needs no ffmpeg.
+	// FFmpegExtraArgs do not apply to native output
+	OggEncoder string
+
+	// Headroom lowers every sample by this many dB, so full-scale voice ends up below the integer
+	// maximum of the output. It is a fixed reduction, unlike normalization, which would target a peak;
+	// if normalization is added, headroom should apply after it. Must not be negative
+	Headroom float64
+
+	// Gain raises every player's decoded voice by this many dB, or lowers it when negative, from
+	// decoder.MinGainDB to decoder.MaxGainDB. It is applied by the decoder, to concealed frames as
+	// well, before samples are clipped to full scale, so a large gain can clip loud voice. Headroom
+	// applies after it
+	Gain int
+
+	// LoudnessMatch gains each player so all outputs share the same measured loudness
+	// (LoudnessTarget), for files meant to be played together. Every player's decoded audio is
+	// held in memory until all are decoded, roughly 700MB per hour of speech at 24kHz, so it is
+	// opt-in. Applied after Headroom, and it may push samples back up to full scale
+	LoudnessMatch bool
+
+	// Mix writes one file with every player's talk-spurts summed at their demo time, so players
+	// who talk at the same moment overlap, instead of a file per player. It is named "mixed" with
+	// the format's extension, or OutputFile, and starts at the first spurt. Loud overlaps are
+	// soft-limited. All players are decoded at TargetSampleRate (the Steam rate if unset) and held
+	// in memory as with LoudnessMatch, which is applied before mixing. Cannot be combined with
+	// SplitBySpurt, CompactTimeline or Resume
+	Mix bool
+
+	// LoudnessTarget is the level, in dBFS, LoudnessMatch gains players to (zero means -20)
+	LoudnessTarget float64
+
+	// MergeDuplicateSources merges voice sources that resolve to the same SteamID64 (for Steam-format
+	// voice, the ID embedded in the packets) into one player, ordered by demo time. This fixes
+	// players split between a bot placeholder xuid and their real one
+	MergeDuplicateSources bool
+
+	// KeyByUserID groups and names outputs by the demo's user ID of the sender instead of the
+	// SteamID64 (the default), giving bots, which share xuid 0, a file each and matching the IDs
+	// other demoinfocs-based tools use. Cannot be combined with MergeDuplicateSources
+	KeyByUserID bool
+
+	// TargetSampleRate, if non-zero, decodes every player at this rate (Hz) so all outputs share it
+	// By default Steam-format voice is written at 24kHz and Opus-format voice at 48kHz
+	// Must be one of the rates Opus decodes to: 8000, 12000, 16000, 24000 or 48000
+	TargetSampleRate int
+
+	// ReadBufferSize is the size in bytes of the read buffer placed in front of the demo parser
+	// If zero, defaultReadBufferSize is used
+	ReadBufferSize int
+
+	// Resume records completed outputs in a manifest in the output directory and skips
+	// players whose output was already produced from identical packets with the same settings
+	// affecting the audio (format, bit depth, gain, loss concealment and so on), even with ForceOverwrite
+	Resume bool
+
+	// LossConcealment selects how frames lost between Steam-format packets are filled
+	// PLC and Silence preserve timing; Skip drops the frames, shifting later speech earlier
+	LossConcealment decoder.LossConcealment
+
+	// MaxConcealedFrames is the most lost frames per gap synthesized with PLC, the rest of a longer
+	// gap being filled with silence (zero means decoder.DefaultMaxConcealedFrames)
+	MaxConcealedFrames int
+
+	// SilenceGaps writes the frames signalled by Steam silence packets as zeros, so pauses within
+	// a transmission keep their length; by default silence packets produce no audio. Consecutive
+	// silence packets are joined into one gap
+	SilenceGaps bool
+
+	// MinDuration skips players whose decoded speech, excluding concealment and silence, is shorter
+	// With SplitBySpurt it instead drops talk-spurts shorter than this
+	MinDuration time.Duration
+
+	// KeepEmpty writes players whose packets decode to no audio at all (only silence or
+	// undecodable packets) as empty files instead of skipping them. With SplitBySpurt they still
+	// have no clips
+	KeepEmpty bool
+
+	// Preview, if set, decodes only this much audio per player and writes it as a short sample
+	// clip, skipping the rest of the player's packets. Generated output names get a ".preview"
+	// suffix before the extension, and the files are marked as previews in the result
+	Preview time.Duration
+
+	// OutputMapping, if set, gives players their own output file name in the output directory and
+	// optionally their own format (see PlayerOutput and LoadOutputMapping). It is keyed like
+	// PlayerIDs. Unmapped players are written as usual unless MappingOnly is set. Cannot be
+	// combined with OutputFile
+	OutputMapping map[string]PlayerOutput
+
+	// MappingOnly extracts only the players in OutputMapping
+	MappingOnly bool
+
+	// SplitBySpurt writes each talk-spurt of a player as its own numbered file (<player>_001.wav,
+	// <player>_002.wav, ...) instead of one file per player. Spurts are found like the timeline's:
+	// at gaps of more than 500ms between packets, or by VAD if set. Each file's demo start time is
+	// reported in ExtractResult. Cannot be combined with OutputFile or Resume
+	SplitBySpurt bool
+
+	// OutputWriter, if set, receives the single WAV output instead of it being written to a file,
+	// e.g. os.Stdout for piping into a player. Exactly one player must be selected, or Mix set.
+	// The WAV is encoded in memory first, since its header sizes are only known after the
+	// samples. Only WAV output is supported, without PacketCues, WAVInfo, Playlist or Manifest
+	OutputWriter io.Writer
+
+	// PerRound writes each player's voice from every round as its own file (<player>_round03.wav),
+	// for reviewing comms round by round. Voice between rounds (warmup, after a round ends and
+	// freeze time) goes to round 00. Each file's round and demo start time are reported in
+	// ExtractResult. Cannot be combined with SplitBySpurt, CompactTimeline, Mix, OutputFile or Resume
+	PerRound bool
+
+	// RoundFreezeTime counts freeze time as part of the round that follows when splitting by
+	// round, instead of as time between rounds
+	RoundFreezeTime bool
+
+	// CompactTimeline shortens each player's file to its talk-spurts, in order, with CompactGap of
+	// silence between them, so long recordings stay listenable. Spurts are found as for SplitBySpurt
+	// and quiet audio at their edges (concealment, silence) is trimmed. The default output keeps
+	// every decoded sample and runs spurts together with no pause, while Timeline maps spurts to
+	// their demo time without changing the audio. Cannot be combined with SplitBySpurt
+	CompactTimeline bool
+
+	// CompactGap is the silence CompactTimeline puts between talk-spurts (zero means 750ms)
+	CompactGap time.Duration
+
+	// Playlist writes an M3U8 playlist of the extracted files to the output directory
+	Playlist bool
+
+	// PlaylistOrder orders the playlist entries: "name" (default) or "duration" (longest first)
+	PlaylistOrder string
+
+	// SortBy orders players for processing and wherever they are listed (outputs, results, logs):
+	// SortBySteamID (default), SortByName or SortByTalkTime. The playlist and timeline keep their own order
+	SortBy string
+
+	// Timeline writes a timeline.json to the output directory describing every talk-spurt
+	// across all players with its demo time and sample range in the player's output file
+	Timeline bool
+
+	// Manifest writes a manifest.json to the output directory listing every file written with its
+	// player's SteamID64 and name, format, duration and packet count, plus the demo's map and
+	// voice data format
+	Manifest bool
+
+	// ManifestInlineLimit inlines each file written, base64-encoded, in manifest.json when it
+	// is at most this many bytes, so small extractions travel as one JSON document. Larger
+	// files are only referenced by path. Zero (the default) inlines nothing; requires Manifest
+	ManifestInlineLimit int64
+
+	// FFmpegExtraArgs are passed to ffmpeg before the output path when converting from WAV
+	// Options that add inputs or remap streams are rejected; other arguments are trusted as given
+	FFmpegExtraArgs []string
+
+	// PipeFFmpeg streams the WAV to ffmpeg's stdin and its output from stdout instead of writing
+	// an intermediate file. Formats that need a seekable output (m4a) still use a temporary file
+	PipeFFmpeg bool
+
+	// PacketCues marks where each input packet's samples begin and end in the output as WAV cue
+	// regions, for correlating the waveform with individual packets. WAV output only
+	PacketCues bool
+
+	// WAVInfo tags WAV outputs with a LIST/INFO chunk giving the player's SteamID64 and name, the
+	// demo name and the extraction time, so a file stays self-describing on its own. Outputs in
+	// other formats are not tagged
+	WAVInfo bool
+
+	// WithChat writes the demo's text chat (player, team, time, message) to chat.json in OutputDir
+	WithChat bool
+
+	// CacheDir, if set, caches the voice data collected from each demo on disk, keyed by a
+	// SHA-256 of the demo file's content, so repeat extractions of the same demo skip parsing.
+	// A changed demo hashes differently, so entries never go stale; delete the directory to reclaim space.
+	// Demos read from a URL are not cached
+	CacheDir string
+
+	// FileMode is the permissions of every file written to OutputDir (zero means 0644)
+	// It is applied exactly, regardless of the umask
+	FileMode os.FileMode
+
+	// DirMode is the permissions of OutputDir when it has to be created, and of the temporary
+	// directory used for conversions (zero means 0755). It is applied exactly, regardless of the umask
+	DirMode os.FileMode
+
+	// Metrics receives counters at key points of the extraction (no-op if nil)
+	Metrics Metrics
+
+	// Jobs is the number of players decoded and written at the same time (zero means one per CPU).
+	// With more than one, Metrics, VAD and UnknownFormatHandler may be called concurrently
+	Jobs int
+
+	// Progress, if set, is called while the demo is parsed with the fraction read so far, at most
+	// every 100ms, and with 1 once parsing completes. The fraction comes from the demo header's
+	// frame count when present, otherwise from the bytes read out of the demo's size. Without
+	// either (stdin, or a download without a length), or for a demo loaded from the cache, only
+	// the final call is made
+	Progress ProgressFunc
+
+	// TickRange, if set, extracts only voice packets whose arrival tick is within "START:END",
+	// both inclusive, clamped to the demo's ticks. The arrival tick is the server (in-game) tick
+	// the demo was at when the voice message was read, as used by other demo analysis tools
+	TickRange string
+
+	// AliveOnly extracts only voice sent while the player was alive. Warmup and the time
+	// between rounds count as alive
+	AliveOnly bool
+
+	// DeadOnly extracts only voice sent while the player was dead, from their death to the end
+	// of the round. Cannot be combined with AliveOnly
+	DeadOnly bool
+
+	// FromScore, if set, extracts only voice from the moment a team first reaches a number of
+	// round wins to the end of the demo, as "<team>=<wins>" where team is any, ct, t or a clan name
+	// (e.g. "any=12" for match point in MR24). ct and t refer to the side the team was on at the time
+	FromScore string
+
+	// VAD, if set, finds the speech in each player's decoded audio (mono, full scale ±1) and
+	// replaces the built-in packet-gap detection for segmentation-dependent features: currently
+	// the talk-spurts of the timeline. Segments are offsets into the audio passed in
+	VAD func(pcm []float32, sampleRate int) []Segment
+
+	// UnknownFormatHandler, if set, receives the raw payloads of players whose voice format
+	// is neither Opus nor Steam, instead of them being skipped with a warning
+	UnknownFormatHandler func(steamID string, format string, payloads [][]byte)
 }
 
-// validateFormat checks if the given format is supported using O(1) map lookup.
-// Returns nil if valid, or an error with suggestions otherwise.
-func validateFormat(format string) error {
-	if supportedFormatsMap[format] {
-		return nil
+// NormalizeFormat returns the supported format name for format, ignoring case, surrounding
+// spaces and a leading dot, and resolving aliases such as "mpeg" for mp3. An empty format is
+// returned as is. Returns ErrInvalidFormat, listing the supported formats, if there is no match.
+func NormalizeFormat(format string) (string, error) {
+	normalized := strings.TrimPrefix(strings.ToLower(strings.TrimSpace(format)), ".")
+	if alias, ok := formatAliases[normalized]; ok {
+		normalized = alias
+	}
+	if normalized == "" || supportedFormatsMap[normalized] {
+		return normalized, nil
 	}
-	return fmt.Errorf("%w: '%s' (supported formats: %s)",
+	return "", fmt.Errorf("%w: '%s' (supported formats: %s)",
 		ErrInvalidFormat, format, strings.Join(supportedFormats, ", "))
 }
 
@@ -123,25 +472,31 @@ func sanitizeFilename(name string) string {
 	return sanitized
 }
 
+// isBotXUID reports whether a voice message xuid belongs to a bot or SourceTV rather than a real player.
+// Such sources use 0 or a value outside the individual SteamID64 account range.
+func isBotXUID(xuid uint64) bool {
+	return xuid < steamID64IndividualBase || xuid >= steamID64IndividualBase+steamID64IndividualSpan
+}
+
 // checkOutputDirectory verifies that the output directory exists and is writable.
-// If the directory doesn't exist, it attempts to create it.
-func checkOutputDirectory(dir string) error {
+// If the directory doesn't exist, it attempts to create it with dirMode.
+func checkOutputDirectory(dir string, dirMode os.FileMode) error {
 	// Check if directory exists
 	info, err := os.Stat(dir)
 	if err != nil {
 		if os.IsNotExist(err) {
 			// Try to create the directory
-			if err := os.MkdirAll(dir, DirPermissions); err != nil {
+			if err := os.MkdirAll(dir, dirMode); err != nil {
 				return fmt.Errorf("failed to create output directory: %w", err)
 			}
-			return nil
+			return setMode(dir, dirMode)
 		}
 		return fmt.Errorf("failed to access output directory: %w", err)
 	}
 
 	// Check if it's a directory
 	if !info.IsDir() {
-		return fmt.Errorf("output path exists but is not a directory: %s", dir)
+		return fmt.Errorf("%w: %s (did you mean to pass a directory for the output files?)", ErrOutputPathIsFile, dir)
 	}
 
 	// Check if it's writable by creating and immediately removing a test file
@@ -154,32 +509,243 @@ func checkOutputDirectory(dir string) error {
 	return nil
 }
 
-// ExtractVoiceData parses a CS2 demo file and writes per-player audio files containing voice data.
-// Uses the provided options to configure the extraction process.
-func ExtractVoiceData(opts ExtractOptions) error {
-	// Validate required fields
-	if opts.DemoPath == "" {
-		return fmt.Errorf("demo path is required")
+// applyDefaults fills in every option left at its zero value and normalizes the rest, so the
+// effective configuration is decided here rather than at each point of use. Fields whose zero
+// value is meaningful (TargetSampleRate, Headroom) are left alone. It fails only when the demo
+// source or format is unusable; other values are validated by the caller.
+func (o *ExtractOptions) applyDefaults() error {
+	if o.Source == nil {
+		if o.DemoPath == "" {
+			return fmt.Errorf("demo path is required")
+		}
+		o.Source = NewDemoSource(o.DemoPath, o.DemoEntry, o.HTTPTimeout, o.HTTPAuthHeader)
+	}
+	if o.DemoPath == "" {
+		o.DemoPath = o.Source.Name()
 	}
 
-	if opts.OutputDir == "" {
-		// Default to current directory if not specified
+	// An explicit output file decides the directory; otherwise default to the current one
+	if o.OutputFile != "" {
+		o.OutputDir = filepath.Dir(o.OutputFile)
+	} else if o.OutputDir == "" {
 		cwd, err := os.Getwd()
 		if err != nil {
 			return fmt.Errorf("failed to get current directory: %w", err)
 		}
-		opts.OutputDir = cwd
+		o.OutputDir = cwd
 	}
 
-	// Default to WAV if no format specified
-	if opts.Format == "" {
-		opts.Format = "wav"
-	} else {
-		// Validate format
-		opts.Format = strings.ToLower(opts.Format)
-		if err := validateFormat(opts.Format); err != nil {
-			return err
+	format, err := NormalizeFormat(o.Format)
+	if err != nil {
+		return err
+	}
+	if format == "" {
+		format = "wav"
+	}
+	o.Format = format
+
+	if o.BitDepth == 0 {
+		o.BitDepth = defaultBitDepth
+	}
+	if o.FileMode == 0 {
+		o.FileMode = FilePermissions
+	}
+	if o.DirMode == 0 {
+		o.DirMode = DirPermissions
+	}
+	if o.CompactGap == 0 {
+		o.CompactGap = defaultCompactGap
+	}
+	if o.WAVEncoder == "" {
+		o.WAVEncoder = WAVEncoderGoAudio
+	}
+	if o.OggEncoder == "" {
+		o.OggEncoder = OggEncoderFFmpeg
+	}
+	if o.Jobs == 0 {
+		o.Jobs = runtime.NumCPU()
+	}
+	if o.LoudnessTarget == 0 {
+		o.LoudnessTarget = defaultLoudnessTarget
+	}
+	if o.PlaylistOrder == "" {
+		o.PlaylistOrder = PlaylistOrderName
+	}
+	if o.SortBy == "" {
+		o.SortBy = SortBySteamID
+	}
+	if o.ReadBufferSize <= 0 {
+		o.ReadBufferSize = defaultReadBufferSize
+	}
+	if o.Metrics == nil {
+		o.Metrics = noopMetrics{}
+	}
+	return nil
+}
+
+// ExtractVoiceData parses a CS2 demo file and writes per-player audio files containing voice data.
+// Uses the provided options to configure the extraction process, and returns a summary of the files written.
+func ExtractVoiceData(opts ExtractOptions) (*ExtractResult, error) {
+	return ExtractVoiceDataContext(context.Background(), opts)
+}
+
+// ExtractVoiceDataContext is ExtractVoiceData with a context. Cancelling ctx aborts a demo download,
+// stops the parser, and stops before the next player; files already written are kept.
+func ExtractVoiceDataContext(ctx context.Context, opts ExtractOptions) (*ExtractResult, error) {
+	start := time.Now()
+
+	if err := opts.applyDefaults(); err != nil {
+		return nil, err
+	}
+
+	if opts.PacketCues && opts.Format != "wav" {
+		return nil, fmt.Errorf("packet cues are only written to WAV output (format: %s)", opts.Format)
+	}
+
+	// Settle each mapped player's file name and format up front, so mistakes fail before parsing
+	var outputMapping map[string]PlayerOutput
+	if len(opts.OutputMapping) > 0 {
+		if opts.OutputFile != "" {
+			return nil, fmt.Errorf("an output mapping cannot be combined with an explicit output file")
+		}
+		mapping, err := resolveOutputMapping(opts.OutputMapping, opts.Format)
+		if err != nil {
+			return nil, err
+		}
+		for player, output := range mapping {
+			if opts.PacketCues && output.Format != "wav" {
+				return nil, fmt.Errorf("packet cues are only written to WAV output (player %s is mapped to %s)", player, output.Format)
+			}
+		}
+		outputMapping = mapping
+	} else if opts.MappingOnly {
+		return nil, fmt.Errorf("mapping-only requires an output mapping")
+	}
+
+	if err := validateFFmpegArgs(opts.FFmpegExtraArgs); err != nil {
+		return nil, err
+	}
+
+	metrics := opts.Metrics
+
+	if err := validateDecodeOptions(opts); err != nil {
+		return nil, err
+	}
+	// Mixed players are summed sample by sample, so they must all share one rate
+	if opts.Mix && opts.TargetSampleRate == 0 {
+		opts.TargetSampleRate = defaultSteamSampleRate
+	}
+
+	bitDepth := opts.BitDepth
+	if !supportedBitDepths[bitDepth] {
+		return nil, fmt.Errorf("unsupported bit depth: %d (expected 16, 24 or 32)", bitDepth)
+	}
+	if opts.WAVEncoder != WAVEncoderGoAudio && opts.WAVEncoder != WAVEncoderNative {
+		return nil, fmt.Errorf("unsupported WAV encoder: %s (expected %s or %s)", opts.WAVEncoder, WAVEncoderGoAudio, WAVEncoderNative)
+	}
+	if opts.OggEncoder != OggEncoderFFmpeg && opts.OggEncoder != OggEncoderNative {
+		return nil, fmt.Errorf("unsupported Ogg encoder: %s (expected %s or %s)", opts.OggEncoder, OggEncoderFFmpeg, OggEncoderNative)
+	}
+	if opts.OggEncoder == OggEncoderNative && opts.Format == "ogg" && len(opts.FFmpegExtraArgs) > 0 {
+		slog.Warn("Ignoring ffmpeg arguments for natively encoded Ogg output", "args", opts.FFmpegExtraArgs)
+	}
+	fullScale := float32(fullScaleValue(bitDepth))
+
+	if opts.LoudnessTarget > 0 || math.IsNaN(opts.LoudnessTarget) {
+		return nil, fmt.Errorf("invalid loudness target: %v dBFS (must be below zero)", opts.LoudnessTarget)
+	}
+
+	// Validate playlist ordering before doing any work
+	switch opts.PlaylistOrder {
+	case PlaylistOrderName, PlaylistOrderDuration:
+	default:
+		return nil, fmt.Errorf("unsupported playlist order: %s (expected %s or %s)", opts.PlaylistOrder, PlaylistOrderName, PlaylistOrderDuration)
+	}
+
+	if opts.KeyByUserID && opts.MergeDuplicateSources {
+		return nil, fmt.Errorf("keying by user ID cannot be combined with merging duplicate sources")
+	}
+
+	var fromScore scoreCondition
+	if opts.FromScore != "" {
+		condition, err := parseScoreCondition(opts.FromScore)
+		if err != nil {
+			return nil, err
+		}
+		fromScore = condition
+	}
+
+	var ticks tickRange
+	if opts.TickRange != "" {
+		r, err := parseTickRange(opts.TickRange)
+		if err != nil {
+			return nil, err
+		}
+		ticks = r
+	}
+
+	if opts.AliveOnly && opts.DeadOnly {
+		return nil, fmt.Errorf("alive-only and dead-only cannot be combined")
+	}
+
+	if opts.ManifestInlineLimit < 0 {
+		return nil, fmt.Errorf("invalid manifest inline size: %d bytes (must be zero or positive)", opts.ManifestInlineLimit)
+	}
+	if opts.ManifestInlineLimit > 0 && !opts.Manifest {
+		return nil, fmt.Errorf("inlining audio in the manifest requires writing a manifest")
+	}
+
+	if opts.MaxPlayers < 0 {
+		return nil, fmt.Errorf("invalid player limit: %d (must be zero or positive)", opts.MaxPlayers)
+	}
+
+	// An explicit output file only makes sense for a single player, or the mix of all of them
+	if opts.OutputFile != "" && len(opts.PlayerIDs) != 1 && !opts.Mix {
+		return nil, fmt.Errorf("an explicit output file requires exactly one player (got %d)", len(opts.PlayerIDs))
+	}
+
+	// Fail up front rather than per player when the binary cannot decode voice at all
+	if err := decoder.CheckOpus(); err != nil {
+		return nil, err
+	}
+
+	if opts.SplitBySpurt && opts.OutputFile != "" {
+		return nil, fmt.Errorf("splitting by talk-spurt cannot be combined with an explicit output file")
+	}
+	if opts.SplitBySpurt && opts.Resume {
+		return nil, fmt.Errorf("splitting by talk-spurt cannot be combined with resuming")
+	}
+	if opts.CompactTimeline && opts.SplitBySpurt {
+		return nil, fmt.Errorf("compacting the timeline cannot be combined with splitting by talk-spurt")
+	}
+	if opts.Mix && (opts.SplitBySpurt || opts.CompactTimeline || opts.Resume) {
+		return nil, fmt.Errorf("mixing cannot be combined with splitting by talk-spurt, compacting the timeline or resuming")
+	}
+	if opts.OutputWriter != nil {
+		if len(opts.PlayerIDs) != 1 && !opts.Mix {
+			return nil, fmt.Errorf("writing to an output writer requires exactly one player (got %d)", len(opts.PlayerIDs))
+		}
+		if opts.Format != "wav" || len(opts.OutputMapping) > 0 {
+			return nil, fmt.Errorf("only WAV output can be written to an output writer (format: %s)", opts.Format)
 		}
+		if opts.OutputFile != "" || opts.SplitBySpurt || opts.PerRound || opts.Resume {
+			return nil, fmt.Errorf("writing to an output writer cannot be combined with an explicit output file, splitting by talk-spurt or round, or resuming")
+		}
+		if opts.PacketCues || opts.WAVInfo || opts.Playlist || opts.Manifest {
+			return nil, fmt.Errorf("writing to an output writer cannot be combined with packet cues, WAV info, a playlist or a manifest")
+		}
+	}
+	if opts.PerRound && (opts.SplitBySpurt || opts.CompactTimeline || opts.Mix) {
+		return nil, fmt.Errorf("splitting by round cannot be combined with splitting by talk-spurt, compacting the timeline or mixing")
+	}
+	if opts.PerRound && (opts.OutputFile != "" || opts.Resume) {
+		return nil, fmt.Errorf("splitting by round cannot be combined with an explicit output file or resuming")
+	}
+	if opts.CompactGap < 0 {
+		return nil, fmt.Errorf("invalid compact gap: %s (expected zero or more)", opts.CompactGap)
+	}
+	if opts.Preview < 0 {
+		return nil, fmt.Errorf("invalid preview length: %s (expected zero or more)", opts.Preview)
 	}
 
 	// Convert playerIDs slice to a map for O(1) lookups
@@ -190,65 +756,209 @@ func ExtractVoiceData(opts ExtractOptions) error {
 
 	// Track which requested players were found
 	foundPlayers := make(map[string]bool)
-	voiceDataPerPlayer := map[string][][]byte{}
 
-	slog.Debug("Opening demo file", "path", opts.DemoPath)
-	file, err := os.Open(opts.DemoPath)
+	demo, err := loadDemo(ctx, opts, metrics)
 	if err != nil {
-		return fmt.Errorf("failed to open demo file '%s': %w", opts.DemoPath, err)
+		return nil, err
 	}
-	defer file.Close()
-
-	parser := dem.NewParser(file)
-	var voiceDataFormat string
-
-	parser.RegisterNetMessageHandler(func(m *msgs2.CSVCMsg_VoiceData) {
-		steamId := strconv.Itoa(int(m.GetXuid()))
-		voiceDataFormat = m.Audio.Format.String()
-		voiceDataPerPlayer[steamId] = append(voiceDataPerPlayer[steamId], m.Audio.VoiceData)
-	})
-
-	err = parser.ParseToEnd()
+	// Official match downloads come with a .dem.info naming the map, teams and players
+	matchInfo, err := loadMatchInfo(opts.Source)
 	if err != nil {
-		if errors.Is(err, dem.ErrCancelled) {
-			return fmt.Errorf("parsing was cancelled: %w", err)
-		} else if errors.Is(err, dem.ErrUnexpectedEndOfDemo) {
-			return fmt.Errorf("demo file ended unexpectedly (may be corrupt): %w", err)
-		} else if errors.Is(err, dem.ErrInvalidFileType) {
-			return fmt.Errorf("invalid demo file type: %w", err)
+		// The demo can still be extracted without it
+		slog.Warn("Ignoring unreadable match info", "error", err)
+	} else if matchInfo != nil {
+		demo = withMatchInfoNames(demo, matchInfo)
+	}
+	if opts.TickRange != "" {
+		if demo.TickRate <= 0 {
+			return nil, fmt.Errorf("cannot filter by tick range: the demo does not report its tick rate")
+		}
+		clamped, ok := ticks.clamp(demo.LastTick)
+		if !ok {
+			return nil, fmt.Errorf("tick range %s is outside the demo (last tick: %d)", opts.TickRange, demo.LastTick)
+		}
+		if clamped != ticks {
+			slog.Debug("Clamped tick range to the demo", "start", clamped.Start, "end", clamped.End)
+		}
+		demo = packetsInTickRange(demo, clamped)
+	}
+	// Life state is matched against the sources as parsed, before they are merged or re-keyed
+	if opts.AliveOnly || opts.DeadOnly {
+		demo = packetsByLifeState(demo, opts.DeadOnly)
+	}
+	if opts.MergeDuplicateSources {
+		demo = mergeDuplicateSources(demo)
+	}
+	if opts.KeyByUserID {
+		demo = keyByUserID(demo)
+	}
+	if opts.FromScore != "" {
+		start, ok := scoreConditionTime(demo.Scores, fromScore)
+		if !ok {
+			return nil, fmt.Errorf("score condition %s never held in the demo", opts.FromScore)
 		}
-		return fmt.Errorf("unknown error parsing demo: %w", err)
+		slog.Debug("Extracting from score condition", "condition", opts.FromScore, "time", start)
+		demo = packetsFrom(demo, start)
 	}
+	voiceDataPerPlayer := demo.VoiceData
+	packetTimesPerPlayer := demo.PacketTimes
+	packetFormatsPerPlayer := demo.PacketFormats
+	sampleRatesPerPlayer := demo.SampleRates
+	botSources := demo.Bots
+	parseDuration := demo.parseDuration
+
+	// Map order is random; process and list players in a stable order instead
+	playerIDs := make([]string, 0, len(voiceDataPerPlayer))
+	for id := range voiceDataPerPlayer {
+		playerIDs = append(playerIDs, id)
+	}
+	sortPlayerIDs(playerIDs, opts.SortBy, demo, opts.KeyByUserID)
 
 	slog.Debug("Found players with voice data", "count", len(voiceDataPerPlayer))
+	for _, id := range playerIDs {
+		payloads := voiceDataPerPlayer[id]
+		kind := "player"
+		if botSources[id] {
+			kind = "bot"
+		}
+		slog.Debug("Voice source", "id", id, "kind", kind, "format", voiceFormat(packetFormatsPerPlayer[id]), "packets", len(payloads))
+	}
 
 	// Check if no voice data was found
 	if len(voiceDataPerPlayer) == 0 {
-		return ErrNoVoiceData
+		return nil, ErrNoVoiceData
 	}
 
 	// Check if the output directory exists and is writable
-	if err := checkOutputDirectory(opts.OutputDir); err != nil {
-		return fmt.Errorf("output directory issue: %w", err)
+	if err := checkOutputDirectory(opts.OutputDir, opts.DirMode); err != nil {
+		return nil, fmt.Errorf("output directory issue: %w", err)
 	}
 
-	// Create a temporary directory for intermediate WAV files
-	tempDir, err := os.MkdirTemp("", "cs2voice-tmp-*")
-	if err != nil {
-		return fmt.Errorf("failed to create temporary directory: %w", err)
+	if opts.PipeFFmpeg && needsTempWav(opts, opts.Format) {
+		slog.Debug("Format needs a seekable output, converting through a temporary file", "format", opts.Format)
+	}
+
+	// Create a temporary directory for intermediate WAV files; WAV output is written in place
+	// and piped conversion needs none. It is removed on every return after this point, including errors
+	tempWavNeeded := needsTempWav(opts, opts.Format)
+	for _, output := range outputMapping {
+		tempWavNeeded = tempWavNeeded || needsTempWav(opts, output.Format)
+	}
+	var tempDir string
+	if tempWavNeeded {
+		tempDir, err = os.MkdirTemp("", "cs2voice-tmp-*")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create temporary directory: %w", err)
+		}
+		defer os.RemoveAll(tempDir)
+		if err := setMode(tempDir, opts.DirMode); err != nil {
+			return nil, err
+		}
+
+		slog.Debug("Created temporary directory for processing", "path", tempDir)
+	}
+
+	// Load the manifest of previously completed outputs when resuming
+	var resume *resumeManifest
+	if opts.Resume {
+		resume, err = loadResumeManifest(opts.OutputDir, opts.FileMode)
+		if err != nil {
+			return nil, err
+		}
+		slog.Debug("Loaded resume manifest", "entries", len(resume.Outputs))
+	}
+
+	// Accumulated time spent decoding and converting across all players
+	var decodeDuration, convertDuration time.Duration
+
+	// Files written in this run, for the optional playlist
+	var playlist []playlistEntry
+
+	extractResult := &ExtractResult{
+		Demo:      opts.DemoPath,
+		OutputDir: opts.OutputDir,
+		Format:    opts.Format,
+		Files:     []ExtractedFile{},
+		MatchInfo: matchInfo,
 	}
-	// Ensure temporary directory cleanup on function exit
-	defer os.RemoveAll(tempDir)
 
-	slog.Debug("Created temporary directory for processing", "path", tempDir)
+	// Talk-spurts across all players, for the optional timeline
+	var timeline []timelineSpurt
+
+	// Files written in this run, for the optional manifest
+	var manifest []manifestEntry
+
+	// w writes every decoded player, including those held back for loudness matching or mixing
+	w := &playerWriter{
+		opts:     opts,
+		demo:     demo,
+		metrics:  metrics,
+		bitDepth: bitDepth,
+		tempDir:  tempDir,
+		resume:   resume,
+		start:    start,
+	}
+
+	// Players held back until all are decoded, when loudness matching or mixing
+	var pending []decodedPlayer
+
+	// Per-player decode failures, reported in the result rather than stopping the extraction
+	var decodeErrs []error
+
+	// Players to decode and write, in the order they are listed in the result
+	var jobs []playerJob
+
+	// Narrow to the most active players when limited; an explicit player filter wins
+	var limitFilter map[string]bool
+	if opts.MaxPlayers > 0 && len(playerFilter) > 0 {
+		slog.Warn("Ignoring player limit since specific players were requested", "limit", opts.MaxPlayers)
+	} else if opts.MaxPlayers > 0 {
+		included, omitted := limitPlayers(voiceDataPerPlayer, botSources, opts.IncludeBots, opts.MaxPlayers)
+		sortPlayerIDs(included, opts.SortBy, demo, opts.KeyByUserID)
+		sortPlayerIDs(omitted, opts.SortBy, demo, opts.KeyByUserID)
+		limitFilter = make(map[string]bool, len(included))
+		for _, id := range included {
+			limitFilter[id] = true
+		}
+		extractResult.OmittedPlayers = omitted
+		slog.Info("Limiting to the players with the most voice packets", "limit", opts.MaxPlayers, "included", included, "omitted", omitted)
+	}
+	if opts.PerRound && len(demo.Rounds) == 0 {
+		slog.Warn("No rounds found in the demo, all voice goes to round 00")
+	}
+	if opts.Preview > 0 {
+		slog.Info("Writing previews: only the start of each player's audio is decoded", "length", opts.Preview)
+	}
+
+	for _, playerId := range playerIDs {
+		voiceData := voiceDataPerPlayer[playerId]
+		if err := ctx.Err(); err != nil {
+			return nil, fmt.Errorf("extraction was cancelled: %w", err)
+		}
 
-	for playerId, voiceData := range voiceDataPerPlayer {
 		// Apply player filter if provided
 		if len(playerFilter) > 0 && !playerFilter[playerId] {
 			slog.Debug("Skipping player (not in filter)", "player", playerId)
 			continue
 		}
 
+		if limitFilter != nil && !limitFilter[playerId] {
+			slog.Debug("Skipping player (outside player limit)", "player", playerId)
+			continue
+		}
+
+		// Skip bots and SourceTV unless explicitly requested
+		if botSources[playerId] && !opts.IncludeBots {
+			slog.Debug("Skipping bot voice source", "id", playerId)
+			continue
+		}
+
+		mapped, isMapped := outputMapping[playerId]
+		if opts.MappingOnly && !isMapped {
+			slog.Debug("Skipping player (not in output mapping)", "player", playerId)
+			continue
+		}
+
 		// Mark this player as found if it was in the filter
 		if playerFilter[playerId] {
 			foundPlayers[playerId] = true
@@ -259,20 +969,50 @@ func ExtractVoiceData(opts ExtractOptions) error {
 
 		// Set up paths
 		var tempWavPath, finalOutputPath string
+		format := opts.Format
+		if isMapped {
+			format = mapped.Format
+		}
 
-		// For WAV format, optimize by writing directly to the final path
-		if opts.Format == "wav" {
-			// Write directly to the output directory, skipping the temporary file
+		// For WAV format, optimize by writing the output directly, skipping the temporary file
+		if format == "wav" {
 			finalOutputPath = filepath.Join(opts.OutputDir, fmt.Sprintf("%s.wav", safePlayerId))
-			tempWavPath = finalOutputPath // Both point to the same location
 		} else {
 			// For other formats, use the temporary directory for WAV files
 			tempWavPath = filepath.Join(tempDir, fmt.Sprintf("%s.wav", safePlayerId))
-			finalOutputPath = filepath.Join(opts.OutputDir, fmt.Sprintf("%s.%s", safePlayerId, opts.Format))
+			finalOutputPath = filepath.Join(opts.OutputDir, fmt.Sprintf("%s.%s", safePlayerId, format))
+		}
+
+		// A mapped player gets the file name from the mapping
+		if isMapped {
+			finalOutputPath = filepath.Join(opts.OutputDir, mapped.File)
+		}
+
+		// Previews are named so they are never mistaken for a full extraction
+		if opts.Preview > 0 {
+			finalOutputPath = previewPath(finalOutputPath)
+		}
+
+		// An explicit output file replaces the generated name
+		if opts.OutputFile != "" {
+			finalOutputPath = opts.OutputFile
+		}
+		if opts.OutputWriter != nil {
+			finalOutputPath = writerOutputPath
 		}
 
-		// Check if file already exists and respect ForceOverwrite flag
-		if _, err := os.Stat(finalOutputPath); err == nil && !opts.ForceOverwrite {
+		// Skip players whose output already matches this demo's packets and the output settings
+		var outputHash string
+		if resume != nil {
+			outputHash = hashOutput(voiceData, newOutputSettings(opts, format))
+			if resume.isComplete(finalOutputPath, playerId, outputHash) {
+				slog.Debug("Output already complete, skipping", "player", playerId, "path", finalOutputPath)
+				continue
+			}
+		}
+
+		// Check if file already exists and respect ForceOverwrite flag (clips are checked as they are written)
+		if _, err := os.Stat(finalOutputPath); err == nil && !opts.ForceOverwrite && !opts.SplitBySpurt && !opts.PerRound && !opts.Mix && opts.OutputWriter == nil {
 			slog.Warn("File already exists, skipping", "path", finalOutputPath)
 			continue
 		} else if !os.IsNotExist(err) && err != nil {
@@ -281,42 +1021,149 @@ func ExtractVoiceData(opts ExtractOptions) error {
 			continue
 		}
 
-		var err error
-		// Generate the WAV file (either temporary or final for WAV format)
-		if voiceDataFormat == "VOICEDATA_FORMAT_OPUS" {
-			err = opusToWav(voiceData, tempWavPath)
-			if err != nil {
-				slog.Error("Failed to initialize OpusDecoder", "error", err)
-				continue
-			}
-		} else if voiceDataFormat == "VOICEDATA_FORMAT_STEAM" {
-			err = convertAudioDataToWavFiles(voiceData, tempWavPath)
-			if err != nil {
-				slog.Error("Failed to write WAV file", "player", playerId, "error", err)
-				continue
-			}
-		} else {
-			slog.Warn("Unknown voice data format", "format", voiceDataFormat)
-			continue
+		jobs = append(jobs, playerJob{
+			id:              playerId,
+			voiceData:       voiceData,
+			tempWavPath:     tempWavPath,
+			finalOutputPath: finalOutputPath,
+			outputHash:      outputHash,
+			format:          format,
+		})
+	}
+
+	// Decode and write up to opts.Jobs players at once; each records into its own outputs
+	outputs := make([]playerOutputs, len(jobs))
+	forEachParallel(len(jobs), opts.Jobs, func(i int) {
+		job, out := jobs[i], &outputs[i]
+		if ctx.Err() != nil {
+			return
 		}
 
-		// If format is wav, we've already written the final file - no conversion needed
-		if opts.Format == "wav" {
-			slog.Debug("Audio file created successfully", "player", playerId, "path", finalOutputPath)
-			continue
+		decodeStart := time.Now()
+		// Decode the player's voice data to PCM, each run of packets with its own format's decoder
+		samples, result, err := decodePlayerVoice(job.id, job.voiceData, packetFormatsPerPlayer[job.id], sampleRatesPerPlayer[job.id], opts)
+		// Skip players without any audio, or without enough actual speech
+		if errors.Is(err, ErrNoAudio) {
+			slog.Debug("No decodable audio, skipping player", "player", job.id)
+			return
+		}
+		if err != nil {
+			slog.Error("Failed to decode voice data", "player", job.id, "error", err)
+			metrics.Inc(MetricDecodeErrors, 1)
+			out.decodeErr = fmt.Errorf("player %s: %w", job.id, err)
+			return
+		}
+		if opts.MinDuration > 0 && result.VoicedDuration < opts.MinDuration && !opts.SplitBySpurt {
+			slog.Info("Skipping player below minimum speech duration",
+				"player", job.id, "voiced", result.VoicedDuration, "minimum", opts.MinDuration)
+			return
+		}
+		// Writers take integer samples at the output bit depth
+		pcm, err := appendIntPCM(nil, samples, defaultNumChannels, fullScale)
+		if err != nil {
+			out.decodeErr = fmt.Errorf("player %s: %w", job.id, err)
+			return
+		}
+
+		player := decodedPlayer{
+			id:              job.id,
+			pcm:             pcm,
+			result:          result,
+			tempWavPath:     job.tempWavPath,
+			finalOutputPath: job.finalOutputPath,
+			outputHash:      job.outputHash,
+			format:          job.format,
+			packetTimes:     packetTimesPerPlayer[job.id],
+			packets:         len(job.voiceData),
+			decodeTime:      time.Since(decodeStart),
+		}
+
+		// Loudness matching needs every player's audio before any gain can be chosen, and a mix
+		// every player's audio before any can be written
+		if opts.LoudnessMatch || opts.Mix {
+			out.pending = &player
+			return
+		}
+		w.writePlayer(player, out)
+	})
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("extraction was cancelled: %w", err)
+	}
+
+	// recordOutputs merges a player's outputs into the result
+	recordOutputs := func(out playerOutputs) {
+		extractResult.Files = append(extractResult.Files, out.files...)
+		playlist = append(playlist, out.playlist...)
+		timeline = append(timeline, out.timeline...)
+		manifest = append(manifest, out.manifest...)
+		decodeDuration += out.decodeTime
+		convertDuration += out.convertTime
+		if out.decodeErr != nil {
+			decodeErrs = append(decodeErrs, out.decodeErr)
+		}
+		if out.pending != nil {
+			pending = append(pending, *out.pending)
+		}
+	}
+	for _, out := range outputs {
+		recordOutputs(out)
+	}
+
+	if opts.LoudnessMatch {
+		matchLoudness(pending, opts.LoudnessTarget, fullScaleValue(bitDepth))
+	}
+	var held playerOutputs
+	if opts.Mix {
+		w.writeMix(pending, &held)
+	} else {
+		for _, player := range pending {
+			w.writePlayer(player, &held)
 		}
+	}
+	recordOutputs(held)
+
+	// Other players' files are still written when some fail to decode; fail only when none could be
+	extractResult.DecodeErr = errors.Join(decodeErrs...)
+	if len(extractResult.Files) == 0 && extractResult.DecodeErr != nil {
+		return nil, fmt.Errorf("%w: %w", ErrNoDecodableVoice, extractResult.DecodeErr)
+	}
 
-		// Convert to the desired format if needed
-		err = convertAudioToFormat(tempWavPath, finalOutputPath, opts.Format)
+	if opts.Playlist && len(playlist) > 0 {
+		playlistPath, err := writePlaylist(opts.OutputDir, playlist, opts.PlaylistOrder, opts.FileMode)
 		if err != nil {
-			slog.Error("Failed to convert audio format", "player", playerId, "format", opts.Format, "error", err)
-			continue
+			return nil, err
+		}
+		slog.Debug("Wrote playlist", "path", playlistPath, "entries", len(playlist))
+	}
+
+	if opts.Timeline {
+		timelinePath, err := writeTimeline(opts.OutputDir, opts.DemoPath, timeline, opts.FileMode)
+		if err != nil {
+			return nil, err
 		}
+		slog.Debug("Wrote timeline", "path", timelinePath, "spurts", len(timeline))
+	}
 
-		slog.Debug("Audio file created successfully", "player", playerId, "path", finalOutputPath)
+	if opts.Manifest {
+		mapName := demo.MapName
+		if mapName == "" && matchInfo != nil {
+			mapName = matchInfo.Map
+		}
+		doc := manifestDocument{Demo: opts.DemoPath, Map: mapName, Players: manifest}
+		manifestPath, err := writeManifest(opts.OutputDir, doc, opts.FileMode, opts.ManifestInlineLimit)
+		if err != nil {
+			return nil, err
+		}
+		slog.Debug("Wrote manifest", "path", manifestPath, "files", len(manifest))
 	}
 
-	defer parser.Close()
+	if opts.WithChat {
+		chatPath, err := writeChat(opts.OutputDir, opts.DemoPath, demo.Chat, opts.FileMode)
+		if err != nil {
+			return nil, err
+		}
+		slog.Debug("Wrote chat", "path", chatPath, "messages", len(demo.Chat))
+	}
 
 	// Log information about player filter results
 	if len(playerFilter) > 0 {
@@ -324,9 +1171,10 @@ func ExtractVoiceData(opts ExtractOptions) error {
 
 		// Check if any requested players were not found
 		if len(foundPlayers) < len(playerFilter) {
-			for id := range playerFilter {
-				if !foundPlayers[id] {
+			for _, id := range opts.PlayerIDs {
+				if !foundPlayers[id] && !slices.Contains(extractResult.MissingPlayers, id) {
 					slog.Warn("Requested player not found in demo", "player", id)
+					extractResult.MissingPlayers = append(extractResult.MissingPlayers, id)
 				}
 			}
 		}
@@ -336,24 +1184,63 @@ func ExtractVoiceData(opts ExtractOptions) error {
 		"demo", opts.DemoPath,
 		"outputDir", opts.OutputDir,
 		"format", opts.Format)
+	slog.Debug("Extraction timing",
+		"total", time.Since(start),
+		"parse", parseDuration,
+		"decode", decodeDuration,
+		"convert", convertDuration)
+	// Missing players have no packets or name to go by
+	sortPlayerIDs(extractResult.MissingPlayers, SortBySteamID, demo, opts.KeyByUserID)
+	return extractResult, nil
+}
+
+// validateGain rejects a decoder gain outside the range OpusDecoder.SetGainDB accepts.
+func validateGain(gainDB int) error {
+	if gainDB < decoder.MinGainDB || gainDB > decoder.MaxGainDB {
+		return fmt.Errorf("%w: %d dB (expected %d to %d)", decoder.ErrInvalidGain, gainDB, decoder.MinGainDB, decoder.MaxGainDB)
+	}
+	return nil
+}
+
+// validateMaxConcealedFrames rejects a negative number of frames to conceal per gap.
+func validateMaxConcealedFrames(frames int) error {
+	if frames < 0 {
+		return fmt.Errorf("%w: %d (expected zero or more)", decoder.ErrInvalidMaxConcealedFrames, frames)
+	}
+	return nil
+}
+
+// validateFFmpegArgs rejects passthrough arguments that would change ffmpeg's input/output mapping,
+// such as extra inputs or stream maps. Other arguments are passed through as given.
+func validateFFmpegArgs(args []string) error {
+	for _, arg := range args {
+		name := strings.SplitN(arg, ":", 2)[0]
+		if unsafeFFmpegArgs[name] {
+			return fmt.Errorf("%w: %s (changes the input/output mapping)", ErrUnsafeFFmpegArg, arg)
+		}
+	}
 	return nil
 }
 
 // convertAudioToFormat uses ffmpeg to convert a WAV file to the specified format
 // Takes source WAV path, destination path, and format as parameters
-func convertAudioToFormat(wavPath string, outputPath string, format string) error {
+// Extra arguments are inserted just before the output path.
+func convertAudioToFormat(wavPath string, outputPath string, format string, extraArgs []string) error {
 	// Check if ffmpeg is available
 	if _, err := exec.LookPath("ffmpeg"); err != nil {
-		return fmt.Errorf("%w: %v", ErrFFMPEGNotFound, err)
+		return fmt.Errorf("%w: %w", ErrFFMPEGNotFound, err)
 	}
 
 	// Build the ffmpeg command
-	cmd := exec.Command("ffmpeg",
+	args := []string{
 		"-i", wavPath, // Input file
 		"-y",                 // Overwrite output file
 		"-loglevel", "error", // Only show errors
 		"-hide_banner", // Hide the banner
-		outputPath)     // Output file
+	}
+	args = append(args, extraArgs...)
+	args = append(args, outputPath) // Output file
+	cmd := exec.Command("ffmpeg", args...)
 
 	// Capture stderr for error reporting
 	var stderr strings.Builder
@@ -368,88 +1255,84 @@ func convertAudioToFormat(wavPath string, outputPath string, format string) erro
 	return nil
 }
 
-// convertAudioDataToWavFiles decodes Steam-format voice data payloads and writes them to a WAV file.
-// It uses the Opus decoder for each chunk and encodes the PCM output as a WAV file. Returns an error if any operation fails.
-func convertAudioDataToWavFiles(payloads [][]byte, fileName string) error {
-	voiceDecoder, err := decoder.NewOpusDecoder(defaultSteamSampleRate, defaultNumChannels)
+// pipeMuxers maps formats that can be written to a non-seekable pipe to ffmpeg's muxer name.
+// m4a is missing since MP4 seeks back to write its index, so it always goes through a temporary file.
+var pipeMuxers = map[string]string{
+	"mp3":  "mp3",
+	"ogg":  "ogg",
+	"opus": "opus",
+	"flac": "flac",
+	"aac":  "adts",
+}
+
+// convertPCMViaPipe encodes pcm as WAV in memory, feeds it to ffmpeg on stdin and writes
+// ffmpeg's stdout to outputPath, so no intermediate file is needed. The format must be in
+// pipeMuxers. On failure the partial output is removed.
+func convertPCMViaPipe(pcm []int, sampleRate, bitDepth int, encoder, outputPath, format string, extraArgs []string) (err error) {
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		return fmt.Errorf("%w: %w", ErrFFMPEGNotFound, err)
+	}
+
+	wavData := &memWriteSeeker{}
+	if err := encodeWav(wavData, pcm, sampleRate, bitDepth, encoder); err != nil {
+		return err
+	}
+
+	output, err := os.Create(outputPath)
 	if err != nil {
-		return fmt.Errorf("failed to initialize OpusDecoder: %w", err)
+		return fmt.Errorf("failed to create output file: %w", err)
 	}
-	o := make([]int, 0, 1024)
-	for _, payload := range payloads {
-		c, err := decoder.DecodeChunk(payload)
-		if err != nil {
-			return fmt.Errorf("failed to decode chunk: %w", err)
+	defer func() {
+		if closeErr := output.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("failed to close output file: %w", closeErr)
 		}
-		if c != nil && len(c.Data) > 0 {
-			pcm, err := voiceDecoder.Decode(c.Data)
-			if err != nil {
-				return fmt.Errorf("failed to decode Opus frame: %w", err)
-			}
-			converted := make([]int, len(pcm))
-			for i, v := range pcm {
-				converted[i] = int(v * intPCMMaxValue)
-			}
-			o = append(o, converted...)
+		if err != nil {
+			os.Remove(outputPath)
 		}
+	}()
+
+	args := []string{
+		"-f", "wav", "-i", "pipe:0", // WAV on stdin
+		"-loglevel", "error",
+		"-hide_banner",
 	}
-	outFile, err := os.Create(fileName)
+	args = append(args, extraArgs...)
+	args = append(args, "-f", pipeMuxers[format], "pipe:1")
+	cmd := exec.Command("ffmpeg", args...)
+	cmd.Stdout = output
+
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+
+	stdin, err := cmd.StdinPipe()
 	if err != nil {
-		return fmt.Errorf("failed to create wav file: %w", err)
-	}
-	defer outFile.Close()
-	enc := wav.NewEncoder(outFile, defaultSteamSampleRate, defaultBitDepth, defaultNumChannels, 1)
-	buf := &audio.IntBuffer{
-		Data: o,
-		Format: &audio.Format{
-			SampleRate:  defaultSteamSampleRate,
-			NumChannels: defaultNumChannels,
-		},
+		return fmt.Errorf("failed to open ffmpeg stdin: %w", err)
 	}
-	if err := enc.Write(buf); err != nil {
-		return fmt.Errorf("failed to write WAV data: %w", err)
-	}
-	enc.Close()
-	return nil
-}
 
-// opusToWav decodes Opus-format voice data and writes the result to a WAV file.
-// Returns an error if decoding or file writing fails.
-func opusToWav(data [][]byte, wavName string) error {
-	opusDecoder, err := decoder.NewDecoder(defaultOpusSampleRate, defaultNumChannels)
-	if err != nil {
-		return fmt.Errorf("failed to initialize OpusDecoder: %w", err)
+	slog.Debug("Converting audio through a pipe", "to", outputPath)
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start ffmpeg: %w", err)
 	}
-	var pcmBuffer []int
-	for _, d := range data {
-		pcm, err := decoder.Decode(opusDecoder, d)
-		if err != nil {
-			slog.Warn("Failed to decode Opus data", "error", err)
-			continue
-		}
-		pp := make([]int, len(pcm))
-		for i, p := range pcm {
-			pp[i] = int(p * intPCMMaxValue)
+
+	// Feed stdin from its own goroutine while waiting for ffmpeg. cmd.Stdout is an *os.File, so
+	// ffmpeg inherits it and writes the output file directly; there is no stdout pipe to drain,
+	// and only stderr is copied by os/exec
+	writeErr := make(chan error, 1)
+	go func() {
+		_, err := stdin.Write(wavData.Bytes())
+		if closeErr := stdin.Close(); err == nil {
+			err = closeErr
 		}
-		pcmBuffer = append(pcmBuffer, pp...)
+		writeErr <- err
+	}()
+
+	waitErr := cmd.Wait()
+	if err := <-writeErr; err != nil && waitErr == nil {
+		return fmt.Errorf("failed to write audio to ffmpeg: %w", err)
 	}
-	file, err := os.Create(wavName)
-	if err != nil {
-		return fmt.Errorf("failed to create wav file: %w", err)
-	}
-	defer file.Close()
-	enc := wav.NewEncoder(file, defaultOpusSampleRate, defaultBitDepth, defaultNumChannels, 1)
-	defer enc.Close()
-	buffer := &audio.IntBuffer{
-		Data: pcmBuffer,
-		Format: &audio.Format{
-			SampleRate:  defaultOpusSampleRate,
-			NumChannels: defaultNumChannels,
-		},
-	}
-	err = enc.Write(buffer)
-	if err != nil {
-		return fmt.Errorf("failed to write WAV data: %w", err)
+	if waitErr != nil {
+		return fmt.Errorf("ffmpeg conversion failed: %w: %s", waitErr, stderr.String())
 	}
+
 	return nil
 }
@@ -0,0 +1,274 @@
+package extract
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// cachedDemo writes a stand-in demo file and a cache entry holding demo for it, so extraction
+// runs on demo's voice data without parsing a real demo. It returns the demo path and cache dir.
+func cachedDemo(t *testing.T, demo *parsedDemo) (demoPath, cacheDir string) {
+	t.Helper()
+	dir := t.TempDir()
+	demoPath = filepath.Join(dir, "match.dem")
+	if err := os.WriteFile(demoPath, []byte("stand-in for "+t.Name()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	hash, err := hashFile(demoPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cacheDir = filepath.Join(dir, "cache")
+	if err := os.Mkdir(cacheDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeDemoCache(filepath.Join(cacheDir, fmt.Sprintf("%s-v%d.gob", hash, cacheVersion)), demo); err != nil {
+		t.Fatal(err)
+	}
+	return demoPath, cacheDir
+}
+
+// rawVoiceDemo returns a demo in which the test player sends the given raw PCM packets, one
+// every 20ms.
+func rawVoiceDemo(packets ...[]byte) *parsedDemo {
+	id := strconv.FormatUint(testSteamID, 10)
+	demo := &parsedDemo{
+		VoiceData:     map[string][][]byte{id: packets},
+		PacketTimes:   map[string][]time.Duration{},
+		PacketFormats: map[string][]string{},
+		PacketUserIDs: map[string][]int{},
+		SampleRates:   map[string]int{},
+		Bots:          map[string]bool{},
+		Roster:        []rosterEntry{{SteamID: testSteamID, UserID: 2, Name: "tester", Team: "CT"}},
+	}
+	for i := range packets {
+		demo.PacketTimes[id] = append(demo.PacketTimes[id], time.Duration(i)*20*time.Millisecond)
+		demo.PacketFormats[id] = append(demo.PacketFormats[id], voiceFormatSteam)
+		demo.PacketUserIDs[id] = append(demo.PacketUserIDs[id], 2)
+	}
+	return demo
+}
+
+func TestExtractVoiceDataRemovesTempFiles(t *testing.T) {
+	requireOpus(t)
+	demoPath, cacheDir := cachedDemo(t, rawVoiceDemo(rawPacket(1000, -1000), rawPacket(500, -500)))
+
+	for _, tt := range []struct {
+		name string
+		// corruptResume leaves an unreadable resume manifest, failing after the temp dir is made
+		corruptResume bool
+	}{
+		{"successful return", false},
+		{"error return", true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			tempRoot := t.TempDir()
+			t.Setenv("TMPDIR", tempRoot)
+			outputDir := t.TempDir()
+			if tt.corruptResume {
+				if err := os.WriteFile(filepath.Join(outputDir, resumeManifestName), []byte("{"), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// FLAC goes through a temporary WAV file
+			_, err := ExtractVoiceData(ExtractOptions{
+				DemoPath:  demoPath,
+				CacheDir:  cacheDir,
+				OutputDir: outputDir,
+				Format:    "flac",
+				Resume:    tt.corruptResume,
+			})
+			if (err != nil) != tt.corruptResume {
+				t.Fatalf("ExtractVoiceData: err = %v, want error: %v", err, tt.corruptResume)
+			}
+			if names := dirNames(t, tempRoot); len(names) != 0 {
+				t.Errorf("temporary files left behind: %q", names)
+			}
+		})
+	}
+}
+
+func TestCheckOutputDirectory(t *testing.T) {
+	dir := t.TempDir()
+	existingFile := filepath.Join(dir, "comms.wav")
+	if err := os.WriteFile(existingFile, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name string
+		path string
+		// want is the error expected, nil when the directory is usable
+		want error
+	}{
+		{"existing directory", dir, nil},
+		{"missing directory is created", filepath.Join(dir, "new", "nested"), nil},
+		{"file exists", existingFile, ErrOutputPathIsFile},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkOutputDirectory(tt.path, DirPermissions)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("err = %v, want %v", err, tt.want)
+			}
+			if tt.want != nil {
+				if !strings.Contains(err.Error(), "did you mean to pass a directory") {
+					t.Errorf("error %q does not suggest passing a directory", err)
+				}
+				return
+			}
+			if info, err := os.Stat(tt.path); err != nil || !info.IsDir() {
+				t.Errorf("%s is not a directory afterwards: %v", tt.path, err)
+			}
+		})
+	}
+}
+
+func TestHasAudioExtension(t *testing.T) {
+	for _, tt := range []struct {
+		path string
+		want bool
+	}{
+		{"out/comms.wav", true},
+		{"comms.MP3", true},
+		{"mix.flac", true},
+		{"out", false},
+		{"out.d", false},
+		{"clips.2024", false},
+		{"", false},
+	} {
+		if got := HasAudioExtension(tt.path); got != tt.want {
+			t.Errorf("HasAudioExtension(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeFormat(t *testing.T) {
+	for _, tt := range []struct {
+		format string
+		want   string
+	}{
+		{"wav", "wav"},
+		{"MP3", "mp3"},
+		{".flac", "flac"},
+		{" .OGG ", "ogg"},
+		{"opus", "opus"},
+		{"mpeg", "mp3"},
+		{"MPGA", "mp3"},
+		{"wave", "wav"},
+		{"vorbis", "ogg"},
+		{".oga", "ogg"},
+		{"mp4", "m4a"},
+		{"", ""},
+	} {
+		got, err := NormalizeFormat(tt.format)
+		if err != nil || got != tt.want {
+			t.Errorf("NormalizeFormat(%q) = %q, %v; want %q", tt.format, got, err, tt.want)
+		}
+	}
+
+	for _, format := range []string{"xyz", "..mp3", "mp3.", "wma"} {
+		_, err := NormalizeFormat(format)
+		if !errors.Is(err, ErrInvalidFormat) {
+			t.Errorf("NormalizeFormat(%q): err = %v, want ErrInvalidFormat", format, err)
+			continue
+		}
+		// The error lists what would have been accepted
+		if !strings.Contains(err.Error(), strings.Join(GetSupportedFormats(), ", ")) {
+			t.Errorf("NormalizeFormat(%q): error %q does not list the supported formats", format, err)
+		}
+	}
+}
+
+func TestApplyDefaults(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name  string
+		opts  ExtractOptions
+		check func(*testing.T, ExtractOptions)
+	}{
+		{
+			name: "zero values",
+			opts: ExtractOptions{DemoPath: "match.dem"},
+			check: func(t *testing.T, o ExtractOptions) {
+				if o.Source == nil || o.Source.Name() != "match.dem" {
+					t.Errorf("Source = %v, want the demo file", o.Source)
+				}
+				if o.OutputDir != cwd || o.Format != "wav" || o.BitDepth != defaultBitDepth {
+					t.Errorf("OutputDir %q, Format %q, BitDepth %d; want %q, wav, %d", o.OutputDir, o.Format, o.BitDepth, cwd, defaultBitDepth)
+				}
+				if o.FileMode != FilePermissions || o.DirMode != DirPermissions {
+					t.Errorf("FileMode %v, DirMode %v", o.FileMode, o.DirMode)
+				}
+				if o.WAVEncoder != WAVEncoderGoAudio || o.OggEncoder != OggEncoderFFmpeg {
+					t.Errorf("WAVEncoder %q, OggEncoder %q", o.WAVEncoder, o.OggEncoder)
+				}
+				if o.Jobs != runtime.NumCPU() || o.CompactGap != defaultCompactGap || o.ReadBufferSize != defaultReadBufferSize {
+					t.Errorf("Jobs %d, CompactGap %v, ReadBufferSize %d", o.Jobs, o.CompactGap, o.ReadBufferSize)
+				}
+				if o.LoudnessTarget != defaultLoudnessTarget || o.PlaylistOrder != PlaylistOrderName || o.SortBy != SortBySteamID {
+					t.Errorf("LoudnessTarget %v, PlaylistOrder %q, SortBy %q", o.LoudnessTarget, o.PlaylistOrder, o.SortBy)
+				}
+				if o.Metrics == nil {
+					t.Errorf("Metrics is nil")
+				}
+				// Zero is meaningful for these, so they stay zero
+				if o.TargetSampleRate != 0 || o.Headroom != 0 || o.MaxConcealedFrames != 0 {
+					t.Errorf("TargetSampleRate %d, Headroom %v, MaxConcealedFrames %d", o.TargetSampleRate, o.Headroom, o.MaxConcealedFrames)
+				}
+			},
+		},
+		{
+			name: "explicit values are kept and normalized",
+			opts: ExtractOptions{DemoPath: "match.dem", OutputDir: "out", Format: ".MP3", BitDepth: 24, Jobs: 3, SortBy: SortByName},
+			check: func(t *testing.T, o ExtractOptions) {
+				if o.OutputDir != "out" || o.Format != "mp3" || o.BitDepth != 24 || o.Jobs != 3 || o.SortBy != SortByName {
+					t.Errorf("OutputDir %q, Format %q, BitDepth %d, Jobs %d, SortBy %q", o.OutputDir, o.Format, o.BitDepth, o.Jobs, o.SortBy)
+				}
+			},
+		},
+		{
+			name: "output file decides the directory",
+			opts: ExtractOptions{DemoPath: "match.dem", OutputDir: "ignored", OutputFile: filepath.Join("clips", "player.wav")},
+			check: func(t *testing.T, o ExtractOptions) {
+				if o.OutputDir != "clips" {
+					t.Errorf("OutputDir = %q, want clips", o.OutputDir)
+				}
+			},
+		},
+		{
+			name: "source names the demo",
+			opts: ExtractOptions{Source: ReaderSource{Label: "upload"}},
+			check: func(t *testing.T, o ExtractOptions) {
+				if o.DemoPath != "upload" {
+					t.Errorf("DemoPath = %q, want upload", o.DemoPath)
+				}
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := tt.opts
+			if err := opts.applyDefaults(); err != nil {
+				t.Fatalf("applyDefaults: %v", err)
+			}
+			tt.check(t, opts)
+		})
+	}
+
+	for _, opts := range []ExtractOptions{{}, {DemoPath: "match.dem", Format: "xyz"}} {
+		if err := opts.applyDefaults(); err == nil {
+			t.Errorf("applyDefaults(%+v) succeeded, want an error", opts)
+		}
+	}
+}
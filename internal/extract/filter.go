@@ -0,0 +1,40 @@
+package extract
+
+import "time"
+
+// filterPackets keeps only the voice packets for which keep returns true, given the source key
+// and the packet's index, dropping sources left with none. The parsed demo is shared and left
+// untouched; a filtered copy is returned.
+func filterPackets(demo *parsedDemo, keep func(key string, i int) bool) *parsedDemo {
+	voiceData := make(map[string][][]byte, len(demo.VoiceData))
+	packetTimes := make(map[string][]time.Duration, len(demo.PacketTimes))
+	packetFormats := make(map[string][]string, len(demo.PacketFormats))
+	packetUserIDs := make(map[string][]int, len(demo.PacketUserIDs))
+
+	for key, payloads := range demo.VoiceData {
+		times, formats, userIDs := demo.PacketTimes[key], demo.PacketFormats[key], demo.PacketUserIDs[key]
+		if len(times) != len(payloads) {
+			continue
+		}
+		for i, payload := range payloads {
+			if !keep(key, i) {
+				continue
+			}
+			voiceData[key] = append(voiceData[key], payload)
+			packetTimes[key] = append(packetTimes[key], times[i])
+			if len(formats) == len(payloads) {
+				packetFormats[key] = append(packetFormats[key], formats[i])
+			}
+			if len(userIDs) == len(payloads) {
+				packetUserIDs[key] = append(packetUserIDs[key], userIDs[i])
+			}
+		}
+	}
+
+	filtered := *demo
+	filtered.VoiceData = voiceData
+	filtered.PacketTimes = packetTimes
+	filtered.PacketFormats = packetFormats
+	filtered.PacketUserIDs = packetUserIDs
+	return &filtered
+}
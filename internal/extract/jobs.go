@@ -0,0 +1,64 @@
+package extract
+
+import (
+	"sync"
+	"time"
+)
+
+// playerJob is a player whose output paths are set up and who is ready to be decoded and written.
+type playerJob struct {
+	id              string
+	voiceData       [][]byte
+	tempWavPath     string
+	finalOutputPath string
+	outputHash      string
+	format          string
+}
+
+// playerOutputs collects what decoding and writing one player produced. Players processed
+// concurrently each fill their own, which are then merged into the result in player order so
+// the result does not depend on which player finished first.
+type playerOutputs struct {
+	files    []ExtractedFile
+	playlist []playlistEntry
+	timeline []timelineSpurt
+	manifest []manifestEntry
+
+	// decodeTime and convertTime are the time spent decoding and converting the player's audio
+	decodeTime, convertTime time.Duration
+
+	// decodeErr is set when the player's voice failed to decode
+	decodeErr error
+
+	// pending is the decoded player, when it is held back until every player is decoded
+	pending *decodedPlayer
+}
+
+// forEachParallel calls fn for every index below n on up to jobs goroutines at once, handing
+// indexes out in order, and returns once every call has finished. With one job, fn runs on the
+// calling goroutine.
+func forEachParallel(n, jobs int, fn func(i int)) {
+	if jobs <= 1 || n <= 1 {
+		for i := range n {
+			fn(i)
+		}
+		return
+	}
+
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for range min(jobs, n) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				fn(i)
+			}
+		}()
+	}
+	for i := range n {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+}
@@ -0,0 +1,31 @@
+package extract
+
+import "sort"
+
+// limitPlayers picks the n voice sources with the most packets, a proxy for talk time that is
+// known before decoding. Bots are only ranked when includeBots is set. Ties go to the lower ID
+// so the choice is stable. It returns the chosen sources and the ones left out, both sorted by ID.
+func limitPlayers(voiceData map[string][][]byte, bots map[string]bool, includeBots bool, n int) (included, omitted []string) {
+	var ids []string
+	for id := range voiceData {
+		if bots[id] && !includeBots {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if len(voiceData[ids[i]]) != len(voiceData[ids[j]]) {
+			return len(voiceData[ids[i]]) > len(voiceData[ids[j]])
+		}
+		return ids[i] < ids[j]
+	})
+
+	if n < len(ids) {
+		included, omitted = ids[:n], ids[n:]
+	} else {
+		included = ids
+	}
+	sort.Strings(included)
+	sort.Strings(omitted)
+	return included, omitted
+}
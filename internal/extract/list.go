@@ -0,0 +1,110 @@
+package extract
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/DiskMethod/cs2-voice-tools/internal/decoder"
+)
+
+// ListedPlayer is one voice source found in a demo, as reported by ListPlayers.
+type ListedPlayer struct {
+	Player string `json:"player"`
+	// Name is the player's name at the end of the demo, when known
+	Name string `json:"name,omitempty"`
+	// Team is the side the player was on last: "T", "CT", "spectator" or "unassigned"
+	Team    string `json:"team,omitempty"`
+	Bot     bool   `json:"bot,omitempty"`
+	Packets int    `json:"packets"`
+	// TalkTime approximates how long the player spoke, in seconds, from packet times alone
+	TalkTime float64 `json:"talkTime"`
+}
+
+// ListResult lists the players with voice data in a demo.
+type ListResult struct {
+	Demo    string         `json:"demo"`
+	Map     string         `json:"map,omitempty"`
+	Players []ListedPlayer `json:"players"`
+}
+
+// ListPlayers parses a demo and lists every voice source in it without decoding any voice or
+// writing files, so it is much faster than an extraction. The demo is loaded as for extraction
+// (honouring the cache), and PlayerIDs, IncludeBots and SortBy apply; other options are ignored.
+func ListPlayers(ctx context.Context, opts ExtractOptions) (*ListResult, error) {
+	if err := opts.applyDefaults(); err != nil {
+		return nil, err
+	}
+	if err := validateSortBy(opts.SortBy); err != nil {
+		return nil, err
+	}
+
+	demo, err := loadDemo(ctx, opts, opts.Metrics)
+	if err != nil {
+		return nil, err
+	}
+	mapName := demo.MapName
+	matchInfo, err := loadMatchInfo(opts.Source)
+	if err != nil {
+		slog.Warn("Ignoring unreadable match info", "error", err)
+	} else if matchInfo != nil {
+		demo = withMatchInfoNames(demo, matchInfo)
+		if mapName == "" {
+			mapName = matchInfo.Map
+		}
+	}
+
+	playerFilter := make(map[string]bool)
+	for _, id := range opts.PlayerIDs {
+		playerFilter[id] = true
+	}
+
+	ids := make([]string, 0, len(demo.VoiceData))
+	for id := range demo.VoiceData {
+		if len(playerFilter) > 0 && !playerFilter[id] {
+			continue
+		}
+		if demo.Bots[id] && !opts.IncludeBots {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sortPlayerIDs(ids, opts.SortBy, demo, false)
+
+	result := &ListResult{Demo: opts.DemoPath, Map: mapName, Players: []ListedPlayer{}}
+	for _, id := range ids {
+		entry, _ := demo.rosterEntry(id, false)
+		result.Players = append(result.Players, ListedPlayer{
+			Player:   id,
+			Name:     entry.Name,
+			Team:     entry.Team,
+			Bot:      demo.Bots[id],
+			Packets:  len(demo.VoiceData[id]),
+			TalkTime: approximateTalkTime(demo.PacketTimes[id]).Seconds(),
+		})
+	}
+	slog.Debug("Listed players with voice data", "count", len(result.Players))
+	return result, nil
+}
+
+// approximateTalkTime estimates how long a player spoke from the demo times of their packets:
+// packets no more than spurtGap apart form a talk-spurt, which lasts from its first packet to its
+// last plus one frame. Pauses within a spurt count as speech, so this is an upper bound on the
+// decoded speech, not a measurement of it.
+func approximateTalkTime(packetTimes []time.Duration) time.Duration {
+	if len(packetTimes) == 0 {
+		return 0
+	}
+	var total time.Duration
+	first := packetTimes[0]
+	for i := 1; i <= len(packetTimes); i++ {
+		if i < len(packetTimes) && packetTimes[i]-packetTimes[i-1] <= spurtGap {
+			continue
+		}
+		total += packetTimes[i-1] - first + decoder.SteamFrameDuration
+		if i < len(packetTimes) {
+			first = packetTimes[i]
+		}
+	}
+	return total
+}
@@ -0,0 +1,110 @@
+package extract
+
+import (
+	"log/slog"
+	"math"
+	"time"
+)
+
+const (
+	// defaultLoudnessTarget is the level (dBFS) players are matched to when no target is given
+	defaultLoudnessTarget = -20.0
+
+	// loudnessBlock is the block length loudness is measured over
+	loudnessBlock = 400 * time.Millisecond
+
+	// loudnessAbsoluteGate drops blocks quieter than this (dBFS) as silence
+	loudnessAbsoluteGate = -70.0
+
+	// loudnessRelativeGate drops blocks this far (dB) below the level of the blocks that remain
+	loudnessRelativeGate = -10.0
+)
+
+// decodedPlayer is a player's decoded audio waiting to be written, with where it goes.
+type decodedPlayer struct {
+	id              string
+	pcm             []int
+	result          decodeResult
+	tempWavPath     string
+	finalOutputPath string
+	outputHash      string
+	// format is the output format of the player's file
+	format string
+	// packetTimes holds the demo time of each packet in result.PacketOffsets
+	packetTimes []time.Duration
+	// packets is the number of voice packets the audio was decoded from
+	packets int
+	// clip is the 1-based talk-spurt number when split by spurt, otherwise 0
+	clip int
+	// round is the round number when split by round (0 for voice between rounds)
+	round int
+	// start is the demo time a clip starts at
+	start time.Duration
+	// decodeTime is how long decoding took, excluding any wait before writing
+	decodeTime time.Duration
+}
+
+// measureLoudness returns the gated mean level of pcm in dBFS, modelled on the ITU-R BS.1770
+// integrated loudness gating without its frequency weighting: the mean square is taken over
+// 400ms blocks, ignoring near-silent blocks and blocks well below the rest. It reports false
+// if no block passes the gates. fullScale is the sample value of 0 dBFS.
+func measureLoudness(pcm []int, sampleRate, fullScale int) (float64, bool) {
+	blockSize := int(time.Duration(sampleRate) * loudnessBlock / time.Second)
+	if blockSize <= 0 {
+		return 0, false
+	}
+
+	var blocks []float64
+	for start := 0; start+blockSize <= len(pcm); start += blockSize {
+		var sum float64
+		for _, v := range pcm[start : start+blockSize] {
+			x := float64(v) / float64(fullScale)
+			sum += x * x
+		}
+		meanSquare := sum / float64(blockSize)
+		if 10*math.Log10(meanSquare) > loudnessAbsoluteGate {
+			blocks = append(blocks, meanSquare)
+		}
+	}
+	if len(blocks) == 0 {
+		return 0, false
+	}
+
+	relativeGate := 10*math.Log10(mean(blocks)) + loudnessRelativeGate
+	var gated []float64
+	for _, meanSquare := range blocks {
+		if 10*math.Log10(meanSquare) > relativeGate {
+			gated = append(gated, meanSquare)
+		}
+	}
+	return 10 * math.Log10(mean(gated)), true
+}
+
+// mean returns the arithmetic mean of values, which must not be empty.
+func mean(values []float64) float64 {
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+// matchLoudness applies a gain to each player so their measured loudness equals target (dBFS).
+// Samples pushed past fullScale are clamped. Players whose loudness cannot be measured are left unchanged.
+func matchLoudness(players []decodedPlayer, target float64, fullScale int) {
+	for _, p := range players {
+		loudness, ok := measureLoudness(p.pcm, p.result.SampleRate, fullScale)
+		if !ok {
+			slog.Debug("Too quiet to measure loudness, leaving level unchanged", "player", p.id)
+			continue
+		}
+
+		gainDB := target - loudness
+		slog.Debug("Matching player loudness", "player", p.id, "loudness", loudness, "target", target, "gain", gainDB)
+		gain := math.Pow(10, gainDB/20)
+		limit := float64(fullScale)
+		for i, v := range p.pcm {
+			p.pcm[i] = int(math.Max(-limit, math.Min(limit, float64(v)*gain)))
+		}
+	}
+}
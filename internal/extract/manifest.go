@@ -0,0 +1,92 @@
+package extract
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+// manifestFileName is the name of the extraction manifest written to the output directory.
+const manifestFileName = "manifest.json"
+
+// manifestEntry describes one extracted file in manifest.json.
+type manifestEntry struct {
+	// SteamID is the SteamID64 of the player, empty for the mix
+	SteamID string `json:"steamId,omitempty"`
+	Name    string `json:"name,omitempty"`
+	// File is the output file, relative to the output directory
+	File   string `json:"file"`
+	Format string `json:"format"`
+	// VoiceFormat is the voice data format of most of the player's packets, empty for the mix
+	VoiceFormat string `json:"voiceFormat,omitempty"`
+	// Duration is the length of the decoded audio, in seconds
+	Duration float64 `json:"duration"`
+	// Packets is the number of voice packets the file was decoded from
+	Packets int `json:"packets"`
+	// Audio is the file's content, base64-encoded, when it was small enough to inline
+	Audio string `json:"audio,omitempty"`
+}
+
+// manifestDocument is the top-level structure of manifest.json.
+type manifestDocument struct {
+	Demo    string          `json:"demo"`
+	Map     string          `json:"map,omitempty"`
+	Players []manifestEntry `json:"players"`
+}
+
+// writeManifest writes doc to dir with the given mode and returns its path. File paths are made
+// relative to dir so the manifest keeps working if the directory is moved. Files of at most
+// inlineMaxBytes bytes are inlined as base64 (zero inlines none).
+func writeManifest(dir string, doc manifestDocument, mode os.FileMode, inlineMaxBytes int64) (string, error) {
+	if doc.Players == nil {
+		doc.Players = []manifestEntry{}
+	}
+	for i := range doc.Players {
+		if inlineMaxBytes > 0 {
+			audio, err := inlineAudio(doc.Players[i].File, inlineMaxBytes)
+			if err != nil {
+				return "", err
+			}
+			doc.Players[i].Audio = audio
+		}
+		if rel, err := filepath.Rel(dir, doc.Players[i].File); err == nil {
+			doc.Players[i].File = filepath.ToSlash(rel)
+		}
+	}
+
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode manifest: %w", err)
+	}
+
+	manifestPath := filepath.Join(dir, manifestFileName)
+	if err := os.WriteFile(manifestPath, data, mode); err != nil {
+		return "", fmt.Errorf("failed to write manifest: %w", err)
+	}
+	if err := setMode(manifestPath, mode); err != nil {
+		return "", err
+	}
+
+	return manifestPath, nil
+}
+
+// inlineAudio returns the content of the file at path, base64-encoded, or "" when the file is
+// larger than maxBytes.
+func inlineAudio(path string, maxBytes int64) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to inline audio in manifest: %w", err)
+	}
+	if info.Size() > maxBytes {
+		slog.Debug("Not inlining audio larger than the manifest limit", "path", path, "size", info.Size(), "limit", maxBytes)
+		return "", nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to inline audio in manifest: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(data), nil
+}
@@ -0,0 +1,94 @@
+package extract
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestManifestInlinesSmallFiles(t *testing.T) {
+	requireOpus(t)
+	demoPath, cacheDir := cachedDemo(t, rawVoiceDemo(rawPacket(1000, -1000), rawPacket(500, -500)))
+
+	for _, tt := range []struct {
+		name  string
+		limit int64
+		// inlined reports whether the player's file is expected in the manifest
+		inlined bool
+	}{
+		{"off by default", 0, false},
+		{"file within the limit", 1 << 20, true},
+		{"file over the limit", 10, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			outputDir := t.TempDir()
+			result, err := ExtractVoiceData(ExtractOptions{
+				DemoPath:            demoPath,
+				CacheDir:            cacheDir,
+				OutputDir:           outputDir,
+				Manifest:            true,
+				ManifestInlineLimit: tt.limit,
+			})
+			if err != nil {
+				t.Fatalf("ExtractVoiceData: %v", err)
+			}
+			if len(result.Files) != 1 {
+				t.Fatalf("got %d files, want 1", len(result.Files))
+			}
+
+			data, err := os.ReadFile(filepath.Join(outputDir, manifestFileName))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var doc manifestDocument
+			if err := json.Unmarshal(data, &doc); err != nil {
+				t.Fatalf("decoding manifest: %v", err)
+			}
+			if len(doc.Players) != 1 {
+				t.Fatalf("manifest lists %d players, want 1", len(doc.Players))
+			}
+			entry := doc.Players[0]
+			if !tt.inlined {
+				if entry.Audio != "" || strings.Contains(string(data), `"audio"`) {
+					t.Errorf("audio inlined with limit %d", tt.limit)
+				}
+				return
+			}
+			audio, err := base64.StdEncoding.DecodeString(entry.Audio)
+			if err != nil {
+				t.Fatalf("decoding inlined audio: %v", err)
+			}
+			file, err := os.ReadFile(filepath.Join(outputDir, entry.File))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(audio) != string(file) {
+				t.Errorf("inlined audio (%d bytes) differs from %s (%d bytes)", len(audio), entry.File, len(file))
+			}
+		})
+	}
+}
+
+func TestManifestInlineLimitValidation(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		opts ExtractOptions
+		want string
+	}{
+		{"negative limit", ExtractOptions{Manifest: true, ManifestInlineLimit: -1}, "invalid manifest inline size"},
+		{"limit without a manifest", ExtractOptions{ManifestInlineLimit: 1024}, "requires writing a manifest"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := tt.opts
+			opts.DemoPath = filepath.Join(t.TempDir(), "missing.dem")
+			opts.OutputDir = t.TempDir()
+			_, err := ExtractVoiceData(opts)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package extract
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// PlayerOutput is where and how one player's audio is written, as given by an output mapping.
+type PlayerOutput struct {
+	// File is the output file name within the output directory. Unless it ends in a supported
+	// format's extension, the format's is added
+	File string `json:"file"`
+	// Format overrides the output format for this player. If empty, the file's extension is used
+	// when it names a supported format, otherwise ExtractOptions.Format
+	Format string `json:"format,omitempty"`
+}
+
+// LoadOutputMapping reads an output mapping from a JSON or CSV file, chosen by its extension.
+//
+// JSON maps each player to an object with "file" and optional "format", or just to a file name:
+//
+//	{"76561198123456789": {"file": "igl", "format": "mp3"}, "76561198987654321": "entry.wav"}
+//
+// CSV has one player per row as player,file[,format]. Blank lines and lines starting with # are
+// skipped, as is a first row whose first column is "player" or "steamid64".
+func LoadOutputMapping(path string) (map[string]PlayerOutput, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("output mapping not found: %s", path)
+		}
+		return nil, fmt.Errorf("failed to open output mapping '%s': %w", path, err)
+	}
+	defer file.Close()
+
+	var mapping map[string]PlayerOutput
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		mapping, err = readJSONMapping(file)
+	case ".csv":
+		mapping, err = readCSVMapping(file)
+	default:
+		return nil, fmt.Errorf("unsupported output mapping file: %s (expected .json or .csv)", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse output mapping '%s': %w", path, err)
+	}
+	return mapping, nil
+}
+
+// readJSONMapping reads a JSON output mapping, accepting a bare file name in place of an object.
+func readJSONMapping(r io.Reader) (map[string]PlayerOutput, error) {
+	var raw map[string]json.RawMessage
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, err
+	}
+
+	mapping := make(map[string]PlayerOutput, len(raw))
+	for player, value := range raw {
+		var output PlayerOutput
+		var name string
+		if err := json.Unmarshal(value, &name); err == nil {
+			output.File = name
+		} else if err := json.Unmarshal(value, &output); err != nil {
+			return nil, fmt.Errorf("player %s: expected a file name or an object with \"file\" and \"format\"", player)
+		}
+		mapping[player] = output
+	}
+	return mapping, nil
+}
+
+// readCSVMapping reads a CSV output mapping of player,file[,format] rows.
+func readCSVMapping(r io.Reader) (map[string]PlayerOutput, error) {
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	mapping := make(map[string]PlayerOutput)
+	for row := 1; ; row++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		player := strings.TrimSpace(record[0])
+		if row == 1 && (strings.EqualFold(player, "player") || strings.EqualFold(player, "steamid64")) {
+			continue
+		}
+		if len(record) < 2 || len(record) > 3 {
+			line, _ := reader.FieldPos(0)
+			return nil, fmt.Errorf("line %d: expected player,file[,format] (got %d columns)", line, len(record))
+		}
+
+		output := PlayerOutput{File: strings.TrimSpace(record[1])}
+		if len(record) == 3 {
+			output.Format = strings.TrimSpace(record[2])
+		}
+		mapping[player] = output
+	}
+	return mapping, nil
+}
+
+// resolveOutputMapping validates a mapping and settles each entry's format and full file name,
+// falling back to defaultFormat. File names must be plain names in the output directory, and no
+// two players may share one.
+func resolveOutputMapping(mapping map[string]PlayerOutput, defaultFormat string) (map[string]PlayerOutput, error) {
+	resolved := make(map[string]PlayerOutput, len(mapping))
+	owners := make(map[string]string, len(mapping))
+
+	for player, output := range mapping {
+		name := strings.TrimSpace(output.File)
+		if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+			return nil, fmt.Errorf("invalid output file for player %s: %q (expected a file name without directories)", player, output.File)
+		}
+
+		format, err := NormalizeFormat(output.Format)
+		if err != nil {
+			return nil, fmt.Errorf("invalid format for player %s: %w", player, err)
+		}
+		// A supported extension doubles as the format; anything else is part of the name
+		extFormat, err := NormalizeFormat(filepath.Ext(name))
+		if err != nil {
+			extFormat = ""
+		}
+		if format == "" {
+			format = extFormat
+		}
+		if format == "" {
+			format = defaultFormat
+		}
+		if extFormat == "" {
+			name += "." + format
+		}
+
+		key := strings.ToLower(name)
+		if other, ok := owners[key]; ok {
+			return nil, fmt.Errorf("players %s and %s are both mapped to the output file %s", other, player, name)
+		}
+		owners[key] = player
+		resolved[player] = PlayerOutput{File: name, Format: format}
+	}
+	return resolved, nil
+}
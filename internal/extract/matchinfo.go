@@ -0,0 +1,154 @@
+package extract
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/markus-wa/demoinfocs-golang/v4/pkg/demoinfocs/msgs2"
+	"google.golang.org/protobuf/proto"
+)
+
+// matchInfoSuffix is appended to a demo's path to find the .dem.info companion file that
+// official match downloads come with.
+const matchInfoSuffix = ".info"
+
+// MatchInfo is the official match metadata from a demo's .dem.info companion file. Fields the
+// file does not have are left empty.
+type MatchInfo struct {
+	// Path is the .dem.info file the information was read from
+	Path    string `json:"path"`
+	MatchID uint64 `json:"matchId,omitempty"`
+	// MatchTime is when the match was played, in RFC 3339
+	MatchTime string `json:"matchTime,omitempty"`
+	Map       string `json:"map,omitempty"`
+	// Event is the tournament the match was part of
+	Event string `json:"event,omitempty"`
+	// Teams lists the tournament teams, in the order of TeamScores
+	Teams []MatchTeam `json:"teams,omitempty"`
+	// TeamScores is the score of each team after the last round
+	TeamScores []int `json:"teamScores,omitempty"`
+	// Duration is the length of the match, in seconds
+	Duration float64 `json:"duration,omitempty"`
+	// Players lists the SteamID64 of every player the match was reserved for
+	Players []string `json:"players,omitempty"`
+}
+
+// MatchTeam is a tournament team named in the match info.
+type MatchTeam struct {
+	Name string `json:"name,omitempty"`
+	Tag  string `json:"tag,omitempty"`
+	// Players maps the team's players' SteamID64s to their nicknames
+	Players map[string]string `json:"players,omitempty"`
+}
+
+// loadMatchInfo reads the .dem.info file next to the demo, if the demo is a file on disk and the
+// companion exists. It returns nil without an error when there is no companion to read.
+func loadMatchInfo(src DemoSource) (*MatchInfo, error) {
+	demoPath, _, ok := sourceFile(src)
+	if !ok {
+		return nil, nil
+	}
+
+	// The companion of a compressed match.dem.gz is still match.dem.info
+	path := trimCompressionExt(demoPath) + matchInfoSuffix
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read match info '%s': %w", path, err)
+	}
+
+	m := new(msgs2.CDataGCCStrike15V2_MatchInfo)
+	if err := proto.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("failed to parse match info '%s': %w", path, err)
+	}
+
+	info := &MatchInfo{
+		Path:    path,
+		MatchID: m.GetMatchid(),
+		Map:     m.GetWatchablematchinfo().GetGameMap(),
+	}
+	if t := m.GetMatchtime(); t != 0 {
+		info.MatchTime = time.Unix(int64(t), 0).UTC().Format(time.RFC3339)
+	}
+
+	// The last round's stats hold the final score and the match reservation
+	rounds := m.GetRoundstatsall()
+	if len(rounds) == 0 && m.GetRoundstatsLegacy() != nil {
+		rounds = append(rounds, m.GetRoundstatsLegacy())
+	}
+	if len(rounds) > 0 {
+		last := rounds[len(rounds)-1]
+		if info.Map == "" {
+			info.Map = last.GetMap()
+		}
+		for _, score := range last.GetTeamScores() {
+			info.TeamScores = append(info.TeamScores, int(score))
+		}
+		info.Duration = float64(last.GetMatchDuration())
+
+		reservation := last.GetReservation()
+		for _, accountID := range reservation.GetAccountIds() {
+			info.Players = append(info.Players, strconv.FormatUint(steamID64IndividualBase+uint64(accountID), 10))
+		}
+		info.Event = reservation.GetTournamentEvent().GetEventName()
+		for _, t := range reservation.GetTournamentTeams() {
+			team := MatchTeam{Name: t.GetTeamName(), Tag: t.GetTeamTag()}
+			for _, p := range t.GetPlayers() {
+				if team.Players == nil {
+					team.Players = make(map[string]string)
+				}
+				team.Players[strconv.FormatUint(steamID64IndividualBase+uint64(p.GetAccountId()), 10)] = p.GetPlayerNick()
+			}
+			info.Teams = append(info.Teams, team)
+		}
+	}
+
+	slog.Debug("Read match info", "path", path, "matchId", info.MatchID, "map", info.Map, "teams", len(info.Teams))
+	return info, nil
+}
+
+// withMatchInfoNames returns a copy of demo whose roster also names the tournament players from
+// info that the demo itself did not name, so their outputs still get a name. Players the demo
+// names keep the demo's name.
+func withMatchInfoNames(demo *parsedDemo, info *MatchInfo) *parsedDemo {
+	roster := append([]rosterEntry(nil), demo.Roster...)
+	index := make(map[string]int, len(roster))
+	for i, entry := range roster {
+		index[strconv.FormatUint(entry.SteamID, 10)] = i
+	}
+
+	changed := false
+	for _, team := range info.Teams {
+		for id, nick := range team.Players {
+			steamID, err := strconv.ParseUint(id, 10, 64)
+			if err != nil || nick == "" {
+				continue
+			}
+			i, ok := index[id]
+			switch {
+			case !ok:
+				// No user ID is known from the match info
+				index[id] = len(roster)
+				roster = append(roster, rosterEntry{SteamID: steamID, UserID: -1, Name: nick})
+			case roster[i].Name == "":
+				roster[i].Name = nick
+			default:
+				continue
+			}
+			changed = true
+		}
+	}
+	if !changed {
+		return demo
+	}
+
+	enriched := *demo
+	enriched.Roster = roster
+	return &enriched
+}
@@ -0,0 +1,172 @@
+package extract
+
+import (
+	"log/slog"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/DiskMethod/cs2-voice-tools/internal/voicepacket"
+)
+
+// resolveSourceID returns the SteamID64 a voice source really belongs to. Steam-format packets
+// embed the speaker's SteamID, which is used when the message xuid is a bot placeholder or
+// otherwise differs; when no Steam-format packet parses, the xuid key is returned.
+func resolveSourceID(key string, payloads [][]byte, formats []string) string {
+	for i, payload := range payloads {
+		if i >= len(formats) || formats[i] != voiceFormatSteam {
+			continue
+		}
+		if c, err := voicepacket.DecodeChunk(payload); err == nil {
+			return strconv.FormatUint(c.SteamID, 10)
+		}
+	}
+	return key
+}
+
+// mergeDuplicateSources merges voice sources whose resolved SteamID64 is identical, so one
+// player split across several xuids produces a single file. Merged packets are ordered by
+// demo time. The parsed demo is shared and left untouched; a merged copy is returned.
+func mergeDuplicateSources(demo *parsedDemo) *parsedDemo {
+	voiceData := make(map[string][][]byte, len(demo.VoiceData))
+	packetTimes := make(map[string][]time.Duration, len(demo.PacketTimes))
+	packetFormats := make(map[string][]string, len(demo.PacketFormats))
+	packetUserIDs := make(map[string][]int, len(demo.PacketUserIDs))
+	sampleRates := make(map[string]int, len(demo.SampleRates))
+	bots := make(map[string]bool, len(demo.Bots))
+	sources := make(map[string][]string)
+
+	for key, payloads := range demo.VoiceData {
+		id := resolveSourceID(key, payloads, demo.PacketFormats[key])
+		sources[id] = append(sources[id], key)
+		voiceData[id] = append(voiceData[id], payloads...)
+		packetTimes[id] = append(packetTimes[id], demo.PacketTimes[key]...)
+		packetFormats[id] = append(packetFormats[id], demo.PacketFormats[key]...)
+		packetUserIDs[id] = append(packetUserIDs[id], demo.PacketUserIDs[key]...)
+		if rate, ok := demo.SampleRates[key]; ok && sampleRates[id] == 0 {
+			sampleRates[id] = rate
+		}
+		if xuid, err := strconv.ParseUint(id, 10, 64); err == nil && isBotXUID(xuid) {
+			bots[id] = true
+		}
+	}
+
+	for id, keys := range sources {
+		if len(keys) < 2 {
+			continue
+		}
+		sort.Strings(keys)
+		slog.Debug("Merging voice sources that resolve to one player", "player", id, "sources", keys)
+		sortSourceByTime(id, voiceData, packetTimes, packetFormats, packetUserIDs)
+	}
+
+	merged := *demo
+	merged.VoiceData = voiceData
+	merged.PacketTimes = packetTimes
+	merged.PacketFormats = packetFormats
+	merged.PacketUserIDs = packetUserIDs
+	merged.SampleRates = sampleRates
+	merged.Bots = bots
+	return &merged
+}
+
+// keyByUserID regroups voice sources by the demo user ID of each packet's sender instead of
+// the message xuid, so bots, which all share xuid 0, get one source each. A source is marked
+// as a bot when any of its packets came from a bot xuid. Packets whose sender is unknown are
+// dropped with a warning. The parsed demo is shared and left untouched; a copy is returned.
+func keyByUserID(demo *parsedDemo) *parsedDemo {
+	voiceData := make(map[string][][]byte, len(demo.VoiceData))
+	packetTimes := make(map[string][]time.Duration, len(demo.PacketTimes))
+	packetFormats := make(map[string][]string, len(demo.PacketFormats))
+	packetUserIDs := make(map[string][]int, len(demo.PacketUserIDs))
+	sampleRates := make(map[string]int, len(demo.SampleRates))
+	bots := make(map[string]bool, len(demo.Bots))
+	sourceCounts := make(map[string]int)
+
+	var unknown int
+	for key, payloads := range demo.VoiceData {
+		times, formats, userIDs := demo.PacketTimes[key], demo.PacketFormats[key], demo.PacketUserIDs[key]
+		if len(userIDs) != len(payloads) || len(times) != len(payloads) || len(formats) != len(payloads) {
+			unknown += len(payloads)
+			continue
+		}
+
+		seen := make(map[string]bool)
+		for i, payload := range payloads {
+			if userIDs[i] < 0 {
+				unknown++
+				continue
+			}
+			id := strconv.Itoa(userIDs[i])
+			if !seen[id] {
+				seen[id] = true
+				sourceCounts[id]++
+			}
+			voiceData[id] = append(voiceData[id], payload)
+			packetTimes[id] = append(packetTimes[id], times[i])
+			packetFormats[id] = append(packetFormats[id], formats[i])
+			packetUserIDs[id] = append(packetUserIDs[id], userIDs[i])
+			if demo.Bots[key] {
+				bots[id] = true
+			}
+			if rate, ok := demo.SampleRates[key]; ok && sampleRates[id] == 0 {
+				sampleRates[id] = rate
+			}
+		}
+	}
+	if unknown > 0 {
+		slog.Warn("Dropping voice packets whose sender has no known user ID", "packets", unknown)
+	}
+
+	for id, count := range sourceCounts {
+		if count > 1 {
+			sortSourceByTime(id, voiceData, packetTimes, packetFormats, packetUserIDs)
+		}
+	}
+
+	keyed := *demo
+	keyed.VoiceData = voiceData
+	keyed.PacketTimes = packetTimes
+	keyed.PacketFormats = packetFormats
+	keyed.PacketUserIDs = packetUserIDs
+	keyed.SampleRates = sampleRates
+	keyed.Bots = bots
+	return &keyed
+}
+
+// sourceUserID returns the first known sender user ID among a source's packets, or "" if none is known.
+func sourceUserID(userIDs []int) string {
+	for _, id := range userIDs {
+		if id >= 0 {
+			return strconv.Itoa(id)
+		}
+	}
+	return ""
+}
+
+// sortSourceByTime restores demo-time order across the packets of source id after several
+// sources were concatenated into it. Sources whose per-packet slices disagree in length are left as they are.
+func sortSourceByTime(id string, voiceData map[string][][]byte, packetTimes map[string][]time.Duration,
+	packetFormats map[string][]string, packetUserIDs map[string][]int) {
+	payloads, times, formats, userIDs := voiceData[id], packetTimes[id], packetFormats[id], packetUserIDs[id]
+	if len(payloads) != len(times) || len(payloads) != len(formats) || len(payloads) != len(userIDs) {
+		return
+	}
+	order := make([]int, len(payloads))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return times[order[a]] < times[order[b]] })
+
+	sortedPayloads := make([][]byte, len(order))
+	sortedTimes := make([]time.Duration, len(order))
+	sortedFormats := make([]string, len(order))
+	sortedUserIDs := make([]int, len(order))
+	for i, j := range order {
+		sortedPayloads[i] = payloads[j]
+		sortedTimes[i] = times[j]
+		sortedFormats[i] = formats[j]
+		sortedUserIDs[i] = userIDs[j]
+	}
+	voiceData[id], packetTimes[id], packetFormats[id], packetUserIDs[id] = sortedPayloads, sortedTimes, sortedFormats, sortedUserIDs
+}
@@ -0,0 +1,110 @@
+package extract
+
+import (
+	"maps"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// testSource is one voice packet of a source in a demo built by testDemo.
+type testSource struct {
+	payload []byte
+	at      time.Duration
+	format  string
+}
+
+// testDemo returns a parsed demo holding the given sources' packets, marking bot xuids.
+func testDemo(sources map[string][]testSource) *parsedDemo {
+	demo := &parsedDemo{
+		VoiceData:     map[string][][]byte{},
+		PacketTimes:   map[string][]time.Duration{},
+		PacketFormats: map[string][]string{},
+		PacketUserIDs: map[string][]int{},
+		SampleRates:   map[string]int{},
+		Bots:          map[string]bool{},
+	}
+	for id, packets := range sources {
+		for _, p := range packets {
+			demo.VoiceData[id] = append(demo.VoiceData[id], p.payload)
+			demo.PacketTimes[id] = append(demo.PacketTimes[id], p.at)
+			demo.PacketFormats[id] = append(demo.PacketFormats[id], p.format)
+			demo.PacketUserIDs[id] = append(demo.PacketUserIDs[id], 2)
+		}
+		if xuid, err := strconv.ParseUint(id, 10, 64); err == nil && isBotXUID(xuid) {
+			demo.Bots[id] = true
+		}
+	}
+	return demo
+}
+
+func TestMergeDuplicateSources(t *testing.T) {
+	player := strconv.FormatUint(testSteamID, 10)
+	// first, second and third tell the merged packets apart; all carry the test player's SteamID
+	first, second, third := rawPacket(1), rawPacket(2), rawPacket(3)
+	ms := time.Millisecond
+
+	for _, tt := range []struct {
+		name    string
+		sources map[string][]testSource
+		// want maps each resulting key to the packets it holds, in order
+		want map[string][][]byte
+		bots []string
+	}{
+		{
+			name: "bot placeholder and real xuid",
+			sources: map[string][]testSource{
+				"0":    {{first, 0, voiceFormatSteam}, {third, 40 * ms, voiceFormatSteam}},
+				player: {{second, 20 * ms, voiceFormatSteam}},
+			},
+			want: map[string][][]byte{player: {first, second, third}},
+		},
+		{
+			name: "sources without Steam packets keep their key",
+			sources: map[string][]testSource{
+				"0":    {{[]byte("opus"), 0, voiceFormatOpus}},
+				player: {{second, 20 * ms, voiceFormatSteam}},
+			},
+			want: map[string][][]byte{"0": {[]byte("opus")}, player: {second}},
+			bots: []string{"0"},
+		},
+		{
+			name: "single source is unchanged",
+			sources: map[string][]testSource{
+				player: {{first, 0, voiceFormatSteam}, {second, 20 * ms, voiceFormatSteam}},
+			},
+			want: map[string][][]byte{player: {first, second}},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			demo := testDemo(tt.sources)
+			merged := mergeDuplicateSources(demo)
+
+			if len(merged.VoiceData) != len(tt.want) {
+				t.Fatalf("got sources %v, want %d", slices.Collect(maps.Keys(merged.VoiceData)), len(tt.want))
+			}
+			for id, want := range tt.want {
+				got := merged.VoiceData[id]
+				if !slices.EqualFunc(got, want, slices.Equal) {
+					t.Errorf("%s: packets %v, want %v", id, got, want)
+				}
+				if !slices.IsSorted(merged.PacketTimes[id]) || len(merged.PacketTimes[id]) != len(want) {
+					t.Errorf("%s: packet times %v not in order", id, merged.PacketTimes[id])
+				}
+				if len(merged.PacketFormats[id]) != len(want) || len(merged.PacketUserIDs[id]) != len(want) {
+					t.Errorf("%s: %d formats and %d user IDs for %d packets", id, len(merged.PacketFormats[id]), len(merged.PacketUserIDs[id]), len(want))
+				}
+			}
+			for id := range merged.Bots {
+				if !slices.Contains(tt.bots, id) {
+					t.Errorf("%s marked as a bot", id)
+				}
+			}
+			// The parsed demo is shared, so it must be left as it was
+			if len(demo.VoiceData) != len(tt.sources) {
+				t.Errorf("the parsed demo was modified")
+			}
+		})
+	}
+}
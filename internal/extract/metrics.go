@@ -0,0 +1,86 @@
+package extract
+
+import "sync"
+
+// Metric names reported by ExtractVoiceData
+const (
+	// MetricDemosProcessed counts demos parsed successfully
+	MetricDemosProcessed = "demos_processed"
+	// MetricPlayersExtracted counts players whose output file was written
+	MetricPlayersExtracted = "players_extracted"
+	// MetricDecodeErrors counts players that failed to decode or convert
+	MetricDecodeErrors = "decode_errors"
+	// MetricBytesWritten counts bytes of final output files
+	MetricBytesWritten = "bytes_written"
+	// MetricParseSeconds observes the time spent parsing each demo
+	MetricParseSeconds = "parse_seconds"
+)
+
+// Metrics receives counters and observations from the extraction process.
+// Implementations must be safe for concurrent use; adapters for systems such as
+// Prometheus can be built on top of it without the core depending on them.
+type Metrics interface {
+	// Inc adds delta to the named counter
+	Inc(name string, delta int64)
+	// Observe records a single value for the named measurement
+	Observe(name string, value float64)
+}
+
+// noopMetrics discards everything; it is used when no Metrics is configured.
+type noopMetrics struct{}
+
+func (noopMetrics) Inc(string, int64)       {}
+func (noopMetrics) Observe(string, float64) {}
+
+// MemoryMetrics is an in-memory Metrics implementation whose values can be read after extraction.
+type MemoryMetrics struct {
+	mu           sync.Mutex
+	counters     map[string]int64
+	observations map[string][]float64
+}
+
+// NewMemoryMetrics returns an empty MemoryMetrics.
+func NewMemoryMetrics() *MemoryMetrics {
+	return &MemoryMetrics{
+		counters:     make(map[string]int64),
+		observations: make(map[string][]float64),
+	}
+}
+
+// Inc adds delta to the named counter.
+func (m *MemoryMetrics) Inc(name string, delta int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.counters[name] += delta
+}
+
+// Observe records value for the named measurement.
+func (m *MemoryMetrics) Observe(name string, value float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.observations[name] = append(m.observations[name], value)
+}
+
+// MetricsSnapshot is a point-in-time copy of the values held by a MemoryMetrics.
+type MetricsSnapshot struct {
+	Counters     map[string]int64
+	Observations map[string][]float64
+}
+
+// Snapshot returns a copy of the current counters and observations.
+func (m *MemoryMetrics) Snapshot() MetricsSnapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	snap := MetricsSnapshot{
+		Counters:     make(map[string]int64, len(m.counters)),
+		Observations: make(map[string][]float64, len(m.observations)),
+	}
+	for k, v := range m.counters {
+		snap.Counters[k] = v
+	}
+	for k, v := range m.observations {
+		snap.Observations[k] = append([]float64(nil), v...)
+	}
+	return snap
+}
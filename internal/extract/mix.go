@@ -0,0 +1,75 @@
+package extract
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	// mixPlayerID names the combined output of ExtractOptions.Mix: its file is mixPlayerID plus
+	// the format's extension, and it is listed under this player in the result.
+	mixPlayerID = "mixed"
+
+	// mixKnee is the level, as a fraction of full scale, above which mixed audio is soft-limited
+	// by mixLimit rather than clipped.
+	mixKnee = 0.8
+)
+
+// mixPlayers sums the talk-spurts of every player into one track, each placed at its demo time
+// so players who talk at the same moment overlap. The track starts at the earliest spurt, which
+// is returned as start. A player's spurt that would overlap their own previous one is moved just
+// after it. Peaks above mixKnee are soft-limited (see mixLimit) instead of overflowing fullScale.
+// Every player must have been decoded at sampleRate.
+func mixPlayers(players []decodedPlayer, sampleRate, fullScale int) (pcm []int, start time.Duration) {
+	spurtsPerPlayer := make([][]timelineSpurt, len(players))
+	first := math.Inf(1)
+	for i, p := range players {
+		spurtsPerPlayer[i] = detectSpurts(p.id, "", p.packetTimes, p.result)
+		for _, spurt := range spurtsPerPlayer[i] {
+			first = min(first, spurt.Start)
+		}
+	}
+	if math.IsInf(first, 1) {
+		return nil, 0
+	}
+
+	// Place every spurt first so the track is allocated once
+	placements := make([][]int, len(players))
+	length := 0
+	for i, spurts := range spurtsPerPlayer {
+		prevEnd := 0
+		for _, spurt := range spurts {
+			at := max(int(math.Round((spurt.Start-first)*float64(sampleRate))), prevEnd)
+			placements[i] = append(placements[i], at)
+			prevEnd = at + spurt.EndSample - spurt.StartSample
+		}
+		length = max(length, prevEnd)
+	}
+
+	pcm = make([]int, length)
+	for i, p := range players {
+		for k, spurt := range spurtsPerPlayer[i] {
+			mixed := pcm[placements[i][k]:]
+			for j, v := range p.pcm[spurt.StartSample:spurt.EndSample] {
+				mixed[j] += v
+			}
+		}
+	}
+
+	for i, v := range pcm {
+		pcm[i] = mixLimit(v, fullScale)
+	}
+	return pcm, time.Duration(first * float64(time.Second))
+}
+
+// mixLimit passes samples up to mixKnee of fullScale through unchanged and bends louder ones
+// smoothly towards fullScale with a tanh curve, so overlapping speech never wraps around.
+func mixLimit(v, fullScale int) int {
+	x := float64(v) / float64(fullScale)
+	level := math.Abs(x)
+	if level <= mixKnee {
+		return v
+	}
+	limited := mixKnee + (1-mixKnee)*math.Tanh((level-mixKnee)/(1-mixKnee))
+	return int(math.Copysign(limited, x) * float64(fullScale-1))
+}
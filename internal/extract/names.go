@@ -0,0 +1,47 @@
+package extract
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxDisplayNameRunes caps the length of display names; names are free text and some
+// consumers lay them out in fixed-width columns.
+const maxDisplayNameRunes = 64
+
+// zeroWidthJoiner joins emoji into one glyph, so it is kept although it is a format character.
+const zeroWidthJoiner = '\u200d'
+
+// displayName returns a player name cleaned up for display: invalid UTF-8, control characters
+// and invisible format characters (such as bidirectional overrides) are removed, runs of
+// whitespace become a single space, and the result is trimmed and cut to maxDisplayNameRunes.
+// Emoji and right-to-left text are kept. The raw name stays available alongside it in metadata.
+func displayName(raw string) string {
+	var b strings.Builder
+	runes := 0
+	space := false
+	for _, r := range strings.ToValidUTF8(raw, "") {
+		switch {
+		case unicode.IsSpace(r):
+			space = b.Len() > 0
+			continue
+		case unicode.IsControl(r), r != zeroWidthJoiner && unicode.Is(unicode.Cf, r), r == utf8.RuneError:
+			continue
+		}
+		if runes >= maxDisplayNameRunes {
+			break
+		}
+		if space {
+			if runes+1 >= maxDisplayNameRunes {
+				break
+			}
+			b.WriteByte(' ')
+			runes++
+			space = false
+		}
+		b.WriteRune(r)
+		runes++
+	}
+	return b.String()
+}
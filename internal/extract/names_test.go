@@ -0,0 +1,44 @@
+package extract
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestDisplayName(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		raw  string
+		want string
+	}{
+		{"plain", "s1mple", "s1mple"},
+		{"control characters", "bad\x00na\x07me\x1b[31m", "badname[31m"},
+		{"right-to-left override", "‮evil‬.exe", "evil.exe"},
+		{"invalid UTF-8", "ok\xff\xfename", "okname"},
+		{"whitespace", "  two\t\n words  ", "two words"},
+		{"right-to-left text", "שלום", "שלום"},
+		{"emoji sequence", "gg \U0001F468‍\U0001F469‍\U0001F467", "gg \U0001F468‍\U0001F469‍\U0001F467"},
+		{"only invisible", "​‮\x01", ""},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := displayName(tt.raw); got != tt.want {
+				t.Errorf("displayName(%q) = %q, want %q", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDisplayNameCutsWholeRunes(t *testing.T) {
+	// Multibyte runes are counted as one each and never split
+	got := displayName(strings.Repeat("é", maxDisplayNameRunes+10))
+	if n := utf8.RuneCountInString(got); n != maxDisplayNameRunes || !utf8.ValidString(got) {
+		t.Errorf("got %d runes (valid UTF-8: %v), want %d", n, utf8.ValidString(got), maxDisplayNameRunes)
+	}
+
+	// A space is not left dangling at the cut
+	got = displayName(strings.Repeat("a", maxDisplayNameRunes-1) + " b")
+	if got != strings.Repeat("a", maxDisplayNameRunes-1) {
+		t.Errorf("got %q, want the name cut before the space", got)
+	}
+}
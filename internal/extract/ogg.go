@@ -0,0 +1,223 @@
+package extract
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/DiskMethod/cs2-voice-tools/internal/decoder"
+)
+
+// Ogg encoders selectable with ExtractOptions.OggEncoder
+const (
+	// OggEncoderFFmpeg converts to Ogg Vorbis with ffmpeg
+	OggEncoderFFmpeg = "ffmpeg"
+	// OggEncoderNative encodes Ogg Opus with libopus and a built-in Ogg muxer, without ffmpeg
+	OggEncoderNative = "native"
+)
+
+const (
+	// oggFrameDuration is the length of each Opus packet written, in milliseconds
+	oggFrameDuration = 20
+
+	// oggPreSkip is the encoder delay in 48kHz samples that players drop from the start of the
+	// stream. It is libopus' lookahead, 6.5ms, which is the same for every application mode.
+	oggPreSkip = 312
+
+	// oggGranuleRate is the rate of Ogg Opus granule positions, whatever the input rate
+	oggGranuleRate = 48000
+
+	// oggSerial identifies the single logical stream in each file ("CS2V")
+	oggSerial = 0x43533256
+
+	// oggPagePackets is the number of packets gathered per page, one second of audio
+	oggPagePackets = 1000 / oggFrameDuration
+
+	// oggMaxPacket is the largest Opus packet libopus can produce
+	oggMaxPacket = 1275 * 3
+
+	// oggMaxLacing is the number of lacing values the largest packet takes
+	oggMaxLacing = oggMaxPacket/255 + 1
+
+	// oggVendor is the vendor string written to the OpusTags header
+	oggVendor = "cs2-voice-tools"
+)
+
+// Ogg page header flags
+const (
+	oggFlagBOS = 0x02
+	oggFlagEOS = 0x04
+)
+
+// oggCRCTable is the lookup table of the Ogg page checksum, a CRC-32 with polynomial 0x04c11db7
+// computed MSB-first without reflection or final XOR (unlike hash/crc32's IEEE variant).
+var oggCRCTable = func() (table [256]uint32) {
+	for i := range table {
+		r := uint32(i) << 24
+		for range 8 {
+			if r&0x80000000 != 0 {
+				r = r<<1 ^ 0x04c11db7
+			} else {
+				r <<= 1
+			}
+		}
+		table[i] = r
+	}
+	return table
+}()
+
+// oggCRC returns the Ogg checksum of b.
+func oggCRC(b []byte) uint32 {
+	var crc uint32
+	for _, v := range b {
+		crc = crc<<8 ^ oggCRCTable[byte(crc>>24)^v]
+	}
+	return crc
+}
+
+// oggWriter writes the pages of a single Ogg logical stream.
+type oggWriter struct {
+	w        io.Writer
+	sequence uint32
+	// packets and segments hold the packets waiting for the next page and their lacing values
+	packets  [][]byte
+	segments []byte
+}
+
+// writePage writes the pending packets as one page ending at granule position granule.
+func (o *oggWriter) writePage(granule uint64, flags byte) error {
+	header := make([]byte, 27, 27+len(o.segments))
+	copy(header, "OggS")
+	header[5] = flags
+	binary.LittleEndian.PutUint64(header[6:], granule)
+	binary.LittleEndian.PutUint32(header[14:], oggSerial)
+	binary.LittleEndian.PutUint32(header[18:], o.sequence)
+	header[26] = byte(len(o.segments))
+	header = append(header, o.segments...)
+
+	page := header
+	for _, packet := range o.packets {
+		page = append(page, packet...)
+	}
+	binary.LittleEndian.PutUint32(page[22:], oggCRC(page))
+
+	o.sequence++
+	o.packets = o.packets[:0]
+	o.segments = o.segments[:0]
+	if _, err := o.w.Write(page); err != nil {
+		return fmt.Errorf("failed to write Ogg page: %w", err)
+	}
+	return nil
+}
+
+// add queues a packet for the next page. A page holds at most 255 lacing values, so callers
+// must flush once full (see full).
+func (o *oggWriter) add(packet []byte) {
+	o.packets = append(o.packets, packet)
+	n := len(packet)
+	for ; n >= 255; n -= 255 {
+		o.segments = append(o.segments, 255)
+	}
+	o.segments = append(o.segments, byte(n))
+}
+
+// full reports whether the pending page may not have room for another packet.
+func (o *oggWriter) full() bool {
+	return len(o.packets) >= oggPagePackets || len(o.segments) > 255-oggMaxLacing
+}
+
+// encodeOggOpus encodes integer PCM samples (mono, full scale at fullScale) as an Ogg Opus
+// stream to w. The last frame is padded with silence and the final granule position marks
+// the true end, so players trim the padding and the stream has the input's exact duration.
+func encodeOggOpus(w io.Writer, pcm []int, sampleRate, fullScale int) error {
+	encoder, err := decoder.NewEncoder(sampleRate, defaultNumChannels)
+	if err != nil {
+		return fmt.Errorf("failed to create Opus encoder: %w", err)
+	}
+
+	bw := bufio.NewWriter(w)
+	ogg := &oggWriter{w: bw}
+
+	// Identification header (RFC 7845, section 5.1): mono, channel mapping family 0
+	head := make([]byte, 19)
+	copy(head, "OpusHead")
+	head[8] = 1
+	head[9] = defaultNumChannels
+	binary.LittleEndian.PutUint16(head[10:], oggPreSkip)
+	binary.LittleEndian.PutUint32(head[12:], uint32(sampleRate))
+	ogg.add(head)
+	if err := ogg.writePage(0, oggFlagBOS); err != nil {
+		return err
+	}
+
+	// Comment header (section 5.2) with the vendor and no comments
+	tags := make([]byte, 0, 16+len(oggVendor))
+	tags = append(tags, "OpusTags"...)
+	tags = binary.LittleEndian.AppendUint32(tags, uint32(len(oggVendor)))
+	tags = append(tags, oggVendor...)
+	tags = binary.LittleEndian.AppendUint32(tags, 0)
+	ogg.add(tags)
+	if err := ogg.writePage(0, 0); err != nil {
+		return err
+	}
+
+	frameSize := sampleRate * oggFrameDuration / 1000
+	granuleStep := uint64(oggGranuleRate * oggFrameDuration / 1000)
+	frame := make([]float32, frameSize)
+	granule := uint64(oggPreSkip)
+	end := uint64(oggPreSkip) + uint64(len(pcm))*oggGranuleRate/uint64(sampleRate)
+
+	for start := 0; ; start += frameSize {
+		clear(frame)
+		for i := 0; i < frameSize && start+i < len(pcm); i++ {
+			frame[i] = float32(pcm[start+i]) / float32(fullScale)
+		}
+
+		packet := make([]byte, oggMaxPacket)
+		n, err := encoder.EncodeFloat32(frame, packet)
+		if err != nil {
+			return fmt.Errorf("failed to encode Opus frame: %w", err)
+		}
+		ogg.add(packet[:n])
+		granule += granuleStep
+
+		if start+frameSize >= len(pcm) {
+			return finishOgg(bw, ogg, min(granule, end))
+		}
+		if ogg.full() {
+			if err := ogg.writePage(granule, 0); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// finishOgg writes the final page, marked end of stream, and flushes.
+func finishOgg(bw *bufio.Writer, ogg *oggWriter, granule uint64) error {
+	if err := ogg.writePage(granule, oggFlagEOS); err != nil {
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("failed to write Ogg page: %w", err)
+	}
+	return nil
+}
+
+// writeOggOpus writes integer PCM samples to an Ogg Opus file, removing it on failure.
+func writeOggOpus(fileName string, pcm []int, sampleRate, fullScale int) (err error) {
+	file, err := os.Create(fileName)
+	if err != nil {
+		return fmt.Errorf("failed to create Ogg file: %w", err)
+	}
+	defer func() {
+		if closeErr := file.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("failed to close Ogg file: %w", closeErr)
+		}
+		if err != nil {
+			os.Remove(fileName)
+		}
+	}()
+	return encodeOggOpus(file, pcm, sampleRate, fullScale)
+}
@@ -0,0 +1,95 @@
+package extract
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// oggPage is a page read back from an Ogg stream.
+type oggPage struct {
+	flags    byte
+	granule  uint64
+	sequence uint32
+	body     []byte
+}
+
+// readOggPages splits an Ogg stream into its pages, failing the test on a bad magic or checksum.
+func readOggPages(t *testing.T, b []byte) []oggPage {
+	t.Helper()
+	var pages []oggPage
+	for len(b) > 0 {
+		if len(b) < 27 || string(b[:4]) != "OggS" || b[4] != 0 {
+			t.Fatalf("page %d does not start with the OggS capture pattern and version 0", len(pages))
+		}
+		segments := int(b[26])
+		bodyLen := 0
+		for _, lacing := range b[27 : 27+segments] {
+			bodyLen += int(lacing)
+		}
+		size := 27 + segments + bodyLen
+		page := bytes.Clone(b[:size])
+
+		stored := binary.LittleEndian.Uint32(page[22:])
+		binary.LittleEndian.PutUint32(page[22:], 0)
+		if crc := oggCRC(page); crc != stored {
+			t.Fatalf("page %d checksum %08x, computed %08x", len(pages), stored, crc)
+		}
+		if serial := binary.LittleEndian.Uint32(page[14:]); serial != oggSerial {
+			t.Errorf("page %d serial %08x, want %08x", len(pages), serial, oggSerial)
+		}
+
+		pages = append(pages, oggPage{
+			flags:    page[5],
+			granule:  binary.LittleEndian.Uint64(page[6:]),
+			sequence: binary.LittleEndian.Uint32(page[18:]),
+			body:     page[27+segments:],
+		})
+		b = b[size:]
+	}
+	return pages
+}
+
+func TestOggCRC(t *testing.T) {
+	// CRC-32/POSIX of "123456789" is 0x765e7680; the Ogg checksum is the same CRC without its final XOR
+	if got, want := oggCRC([]byte("123456789")), ^uint32(0x765e7680); got != want {
+		t.Errorf("oggCRC = %08x, want %08x", got, want)
+	}
+}
+
+func TestEncodeOggOpus(t *testing.T) {
+	requireOpus(t)
+	const sampleRate = 24000
+	// A little over 1.5s, so the last frame is padded with silence that the granule position trims
+	pcm := make([]int, sampleRate*3/2+7)
+
+	var buf bytes.Buffer
+	if err := encodeOggOpus(&buf, pcm, sampleRate, 32767); err != nil {
+		t.Fatalf("encodeOggOpus: %v", err)
+	}
+	pages := readOggPages(t, buf.Bytes())
+	if len(pages) < 3 {
+		t.Fatalf("got %d pages, want the two headers and audio", len(pages))
+	}
+
+	if !bytes.HasPrefix(pages[0].body, []byte("OpusHead")) || pages[0].flags != oggFlagBOS {
+		t.Errorf("first page is not an OpusHead page marked BOS")
+	}
+	if !bytes.HasPrefix(pages[1].body, []byte("OpusTags")) {
+		t.Errorf("second page is not an OpusTags page")
+	}
+	for i, page := range pages {
+		if page.sequence != uint32(i) {
+			t.Errorf("page %d has sequence number %d", i, page.sequence)
+		}
+	}
+
+	// The final granule position is the pre-skip plus the input's exact length at 48kHz
+	last := pages[len(pages)-1]
+	if last.flags != oggFlagEOS {
+		t.Errorf("last page flags %x, want EOS", last.flags)
+	}
+	if want := uint64(oggPreSkip + len(pcm)*oggGranuleRate/sampleRate); last.granule != want {
+		t.Errorf("final granule %d, want %d", last.granule, want)
+	}
+}
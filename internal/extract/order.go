@@ -0,0 +1,77 @@
+package extract
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Player ordering options for ExtractOptions.SortBy
+const (
+	// SortBySteamID orders players by ID, ascending
+	SortBySteamID = "steamid"
+	// SortByName orders players by in-game name, case-insensitively
+	SortByName = "name"
+	// SortByTalkTime orders players by voice packet count, most first
+	SortByTalkTime = "talk-time"
+)
+
+// validateSortBy rejects an unknown player ordering.
+func validateSortBy(sortBy string) error {
+	switch sortBy {
+	case SortBySteamID, SortByName, SortByTalkTime:
+		return nil
+	default:
+		return fmt.Errorf("unsupported player order: %s (expected %s, %s or %s)", sortBy, SortBySteamID, SortByName, SortByTalkTime)
+	}
+}
+
+// lessID orders player IDs numerically, as SteamID64s and user IDs are decimal numbers
+// without leading zeros; IDs that are not fall back to string order.
+func lessID(a, b string) bool {
+	if len(a) != len(b) && isDigits(a) && isDigits(b) {
+		return len(a) < len(b)
+	}
+	return a < b
+}
+
+// isDigits reports whether s is a non-empty string of ASCII digits.
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// sortPlayerIDs sorts ids in place by sortBy. Talk time is measured by voice packet count, a proxy
+// that is known before decoding; names come from the demo's roster. Ties, and players without
+// packets or a name, fall back to ID order so the result is the same on every run.
+func sortPlayerIDs(ids []string, sortBy string, demo *parsedDemo, byUserID bool) {
+	switch sortBy {
+	case SortByName:
+		names := make(map[string]string, len(ids))
+		for _, id := range ids {
+			names[id] = strings.ToLower(demo.playerName(id, byUserID))
+		}
+		sort.SliceStable(ids, func(i, j int) bool {
+			if names[ids[i]] != names[ids[j]] {
+				return names[ids[i]] < names[ids[j]]
+			}
+			return lessID(ids[i], ids[j])
+		})
+	case SortByTalkTime:
+		sort.SliceStable(ids, func(i, j int) bool {
+			if len(demo.VoiceData[ids[i]]) != len(demo.VoiceData[ids[j]]) {
+				return len(demo.VoiceData[ids[i]]) > len(demo.VoiceData[ids[j]])
+			}
+			return lessID(ids[i], ids[j])
+		})
+	default:
+		sort.SliceStable(ids, func(i, j int) bool { return lessID(ids[i], ids[j]) })
+	}
+}
@@ -0,0 +1,509 @@
+package extract
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strconv"
+	"sync"
+	"time"
+
+	dem "github.com/markus-wa/demoinfocs-golang/v4/pkg/demoinfocs"
+	"github.com/markus-wa/demoinfocs-golang/v4/pkg/demoinfocs/common"
+	"github.com/markus-wa/demoinfocs-golang/v4/pkg/demoinfocs/events"
+	"github.com/markus-wa/demoinfocs-golang/v4/pkg/demoinfocs/msgs2"
+)
+
+// cacheVersion is bumped whenever parsedDemo changes shape, invalidating older cache entries.
+const cacheVersion = 14
+
+// parsedDemo holds the voice data collected from one pass over a demo.
+// It is shared between concurrent extractions of the same demo and must not be modified.
+type parsedDemo struct {
+	// VoiceData holds each player's voice packets in arrival order, keyed by xuid
+	VoiceData map[string][][]byte
+	// PacketTimes holds the demo time each packet in VoiceData arrived at
+	PacketTimes map[string][]time.Duration
+	// PacketFormats holds the voice data format of each packet in VoiceData
+	PacketFormats map[string][]string
+	// PacketUserIDs holds the demo user ID of each packet's sender in VoiceData, or -1 if unknown
+	PacketUserIDs map[string][]int
+	// SampleRates holds the sample rate each source's voice messages report (the first one, if
+	// it changes), for sources whose messages carry one. It takes precedence over the rate in
+	// the Steam packet header when decoding
+	SampleRates map[string]int
+	// Bots marks voice sources that are bots or SourceTV rather than real players
+	Bots map[string]bool
+	// Chat holds the text chat messages sent during the demo, in order
+	Chat []chatMessage
+	// Scores holds every team score change, in order
+	Scores []scoreUpdate
+	// MapName is the map the demo was recorded on, from its header
+	MapName string
+	// TickRate is the server's ticks per second, or zero if the demo did not report it
+	TickRate float64
+	// LastTick is the last server (in-game) tick of the demo
+	LastTick int
+	// Deaths holds the spans during which players were dead, in order of death
+	Deaths []deathSpan
+	// Rounds holds the rounds played outside warmup, in order
+	Rounds []roundSpan
+	// Roster holds every participant known at the end of the demo, with their latest name
+	Roster []rosterEntry
+
+	// parseDuration is how long parsing took (zero when loaded from cache)
+	parseDuration time.Duration
+}
+
+// rosterEntry identifies a participant of the demo.
+type rosterEntry struct {
+	SteamID uint64
+	UserID  int
+	Name    string
+	// Team is the side the participant was on last ("T", "CT", "spectator" or "unassigned")
+	Team string
+}
+
+// parseCall is an in-flight parse whose result is shared by every caller for the same demo.
+type parseCall struct {
+	done chan struct{}
+	demo *parsedDemo
+	err  error
+}
+
+// inflightParses deduplicates concurrent parses of the same demo file, keyed by its absolute
+// path and archive entry.
+var (
+	inflightMu     sync.Mutex
+	inflightParses = map[string]*parseCall{}
+)
+
+// loadDemo returns the voice data of the demo described by opts. Concurrent calls for the same
+// demo file share a single parse, and with opts.CacheDir set the result is read from or written
+// to an on-disk cache keyed by the demo's content hash. A shared parse runs under the context of
+// the call that started it; a waiting call whose ctx is cancelled stops waiting, and one whose
+// ctx is still live parses the demo itself if the shared parse was cancelled.
+func loadDemo(ctx context.Context, opts ExtractOptions, metrics Metrics) (*parsedDemo, error) {
+	// Only files can be identified across calls; readers, URLs and stdin are each parsed alone
+	demoPath, entry, ok := sourceFile(opts.Source)
+	if !ok {
+		return loadDemoCached(ctx, opts, metrics)
+	}
+	abs, err := filepath.Abs(demoPath)
+	if err != nil {
+		return loadDemoCached(ctx, opts, metrics)
+	}
+	key := abs + "\x00" + entry
+
+	inflightMu.Lock()
+	if call, ok := inflightParses[key]; ok {
+		inflightMu.Unlock()
+		slog.Debug("Waiting for in-flight parse of the same demo", "demo", opts.Source.Name())
+		select {
+		case <-call.done:
+			if isCancellation(call.err) && ctx.Err() == nil {
+				slog.Debug("In-flight parse was cancelled, parsing again", "demo", opts.Source.Name())
+				return loadDemo(ctx, opts, metrics)
+			}
+			return call.demo, call.err
+		case <-ctx.Done():
+			return nil, fmt.Errorf("parsing was cancelled: %w", ctx.Err())
+		}
+	}
+	call := &parseCall{done: make(chan struct{})}
+	inflightParses[key] = call
+	inflightMu.Unlock()
+
+	call.demo, call.err = loadDemoCached(ctx, opts, metrics)
+
+	inflightMu.Lock()
+	delete(inflightParses, key)
+	inflightMu.Unlock()
+	close(call.done)
+
+	return call.demo, call.err
+}
+
+// isCancellation reports whether err comes from a cancelled or expired context.
+func isCancellation(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// loadDemoCached parses the demo, consulting opts.CacheDir first when it is set.
+func loadDemoCached(ctx context.Context, opts ExtractOptions, metrics Metrics) (*parsedDemo, error) {
+	demoPath, entry, ok := sourceFile(opts.Source)
+	if opts.CacheDir == "" || !ok {
+		return parseDemo(ctx, opts, metrics)
+	}
+
+	hash, err := hashFile(demoPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash demo file '%s': %w", demoPath, err)
+	}
+	cachePath := filepath.Join(opts.CacheDir, fmt.Sprintf("%s-v%d.gob", hash, cacheVersion))
+	if entry != "" {
+		entryHash := sha256.Sum256([]byte(entry))
+		cachePath = filepath.Join(opts.CacheDir, fmt.Sprintf("%s-%s-v%d.gob", hash, hex.EncodeToString(entryHash[:8]), cacheVersion))
+	}
+
+	if demo, err := readDemoCache(cachePath); err == nil {
+		slog.Debug("Loaded voice data from cache", "path", cachePath)
+		if opts.Progress != nil {
+			opts.Progress(1)
+		}
+		return demo, nil
+	} else if !os.IsNotExist(err) {
+		slog.Warn("Ignoring unreadable cache entry", "path", cachePath, "error", err)
+	}
+
+	demo, err := parseDemo(ctx, opts, metrics)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := writeDemoCache(cachePath, demo); err != nil {
+		slog.Warn("Failed to write cache entry", "path", cachePath, "error", err)
+	}
+	return demo, nil
+}
+
+// sourceFile returns the file on disk a source reads from, and the archive entry if any.
+// Only file-backed sources can be cached or identified across calls.
+func sourceFile(src DemoSource) (demoPath, entry string, ok bool) {
+	switch s := src.(type) {
+	case FileSource:
+		return s.Path, "", true
+	case ArchiveSource:
+		return s.Path, s.Entry, true
+	default:
+		return "", "", false
+	}
+}
+
+// parseDemo opens and parses the demo, collecting every player's voice packets.
+// Cancelling ctx cancels the parser.
+func parseDemo(ctx context.Context, opts ExtractOptions, metrics Metrics) (*parsedDemo, error) {
+	slog.Debug("Opening demo", "demo", opts.Source.Name())
+	file, err := opts.Source.Open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// Compressed demos are inflated while they are parsed
+	decompressed, err := decompressDemo(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	file = decompressed
+	defer file.Close()
+
+	readBufferSize := opts.ReadBufferSize
+
+	// Bytes read stand in for progress when the demo header carries no frame count, as in CS2
+	counter := &countingReader{r: file}
+	size := streamSize(file)
+
+	parser := dem.NewParser(bufio.NewReaderSize(counter, readBufferSize))
+	defer parser.Close()
+	stopCancel := context.AfterFunc(ctx, parser.Cancel)
+	defer stopCancel()
+
+	demo := &parsedDemo{
+		VoiceData:     map[string][][]byte{},
+		PacketTimes:   map[string][]time.Duration{},
+		PacketFormats: map[string][]string{},
+		PacketUserIDs: map[string][]int{},
+		SampleRates:   map[string]int{},
+		Bots:          map[string]bool{},
+	}
+
+	// A panic inside the handler is converted into an error and stops parsing
+	var handlerErr error
+	parser.RegisterNetMessageHandler(func(m *msgs2.CSVCMsg_VoiceData) {
+		defer func() {
+			if r := recover(); r != nil {
+				handlerErr = fmt.Errorf("%w: in voice data handler: %v\n%s", ErrDemoParsePanic, r, debug.Stack())
+				parser.Cancel()
+			}
+		}()
+		steamId := strconv.Itoa(int(m.GetXuid()))
+		demo.VoiceData[steamId] = append(demo.VoiceData[steamId], m.Audio.VoiceData)
+		demo.PacketTimes[steamId] = append(demo.PacketTimes[steamId], parser.CurrentTime())
+		demo.PacketFormats[steamId] = append(demo.PacketFormats[steamId], m.GetAudio().GetFormat().String())
+		demo.PacketUserIDs[steamId] = append(demo.PacketUserIDs[steamId], senderUserID(parser, m.GetClient()))
+		if rate := int(m.GetAudio().GetSampleRate()); rate > 0 {
+			if _, ok := demo.SampleRates[steamId]; !ok {
+				demo.SampleRates[steamId] = rate
+			}
+		}
+		if isBotXUID(m.GetXuid()) {
+			demo.Bots[steamId] = true
+		}
+	})
+
+	// Text chat rides along on the same pass; it is only written out when requested
+	parser.RegisterEventHandler(func(e events.ChatMessage) {
+		msg := chatMessage{
+			Time:    parser.CurrentTime().Seconds(),
+			Message: e.Text,
+			AllChat: e.IsChatAll,
+		}
+		if e.Sender != nil {
+			msg.Player = strconv.FormatUint(e.Sender.SteamID64, 10)
+			msg.Name = e.Sender.Name
+			msg.DisplayName = displayName(e.Sender.Name)
+			msg.Team = teamName(e.Sender.Team)
+		}
+		demo.Chat = append(demo.Chat, msg)
+	})
+
+	// Score changes let extraction start from a point in the match, such as match point
+	parser.RegisterEventHandler(func(e events.ScoreUpdated) {
+		if e.TeamState == nil {
+			return
+		}
+		demo.Scores = append(demo.Scores, scoreUpdate{
+			Time:  parser.CurrentTime(),
+			Side:  teamName(e.TeamState.Team()),
+			Clan:  e.TeamState.ClanName(),
+			Score: e.NewScore,
+		})
+	})
+
+	// Deaths let extraction keep only voice sent while alive, or only while dead
+	closeDeaths := trackDeaths(parser, demo)
+
+	// Rounds let extraction split each player's voice per round
+	closeRounds := trackRounds(parser, demo)
+
+	var progress *progressReporter
+	if opts.Progress != nil {
+		progress = &progressReporter{fn: opts.Progress}
+		parser.RegisterEventHandler(func(events.FrameDone) {
+			if fraction := parser.Progress(); fraction > 0 {
+				progress.report(float64(fraction))
+			} else if size > 0 {
+				progress.report(float64(counter.n.Load()) / float64(size))
+			}
+		})
+	}
+
+	parseStart := time.Now()
+	err = parseToEnd(parser)
+	if handlerErr != nil {
+		err = handlerErr
+	}
+	demo.parseDuration = time.Since(parseStart)
+	slog.Debug("Parsed demo", "duration", demo.parseDuration, "readBuffer", readBufferSize)
+	if err != nil {
+		if errors.Is(err, ErrDemoParsePanic) {
+			return nil, err
+		} else if errors.Is(err, dem.ErrCancelled) {
+			if ctx.Err() != nil {
+				return nil, fmt.Errorf("parsing was cancelled: %w", ctx.Err())
+			}
+			return nil, fmt.Errorf("parsing was cancelled: %w", err)
+		} else if errors.Is(err, dem.ErrUnexpectedEndOfDemo) {
+			return nil, fmt.Errorf("demo file ended unexpectedly (may be corrupt): %w", err)
+		} else if errors.Is(err, dem.ErrInvalidFileType) {
+			return nil, fmt.Errorf("invalid demo file type: %w", err)
+		}
+		return nil, fmt.Errorf("unknown error parsing demo: %w", err)
+	}
+	if progress != nil {
+		progress.send(1)
+	}
+	closeDeaths()
+	closeRounds()
+	if rate := parser.TickRate(); rate > 0 {
+		demo.TickRate = rate
+	}
+	demo.LastTick = parser.GameState().IngameTick()
+	demo.MapName = parser.Header().MapName
+
+	// Voice can arrive before its sender is in the roster, so identities are settled from the
+	// final roster once the whole demo has been read
+	demo.Roster = finalRoster(parser)
+	fillUserIDs(demo)
+
+	metrics.Inc(MetricDemosProcessed, 1)
+	metrics.Observe(MetricParseSeconds, demo.parseDuration.Seconds())
+
+	return demo, nil
+}
+
+// finalRoster returns every participant the parser knows of, including disconnected ones,
+// with the name they had last.
+func finalRoster(parser dem.Parser) []rosterEntry {
+	var roster []rosterEntry
+	for _, player := range parser.GameState().Participants().All() {
+		if player == nil {
+			continue
+		}
+		roster = append(roster, rosterEntry{SteamID: player.SteamID64, UserID: player.UserID, Name: player.Name, Team: teamName(player.Team)})
+	}
+	return roster
+}
+
+// fillUserIDs resolves the user ID of packets whose sender was not yet in the roster when they
+// arrived, matching the source's xuid against the final roster. Bots share xuid 0 and cannot be
+// matched this way, so their unresolved packets stay unknown.
+func fillUserIDs(demo *parsedDemo) {
+	userIDs := make(map[string]int)
+	for _, entry := range demo.Roster {
+		if !isBotXUID(entry.SteamID) {
+			userIDs[strconv.FormatUint(entry.SteamID, 10)] = entry.UserID
+		}
+	}
+
+	for key, ids := range demo.PacketUserIDs {
+		userID, ok := userIDs[key]
+		if !ok {
+			continue
+		}
+		for i, id := range ids {
+			if id < 0 {
+				ids[i] = userID
+			}
+		}
+	}
+}
+
+// playerName returns the latest known name of the player a voice source key refers to, a
+// SteamID64 or, with byUserID, a user ID. It returns "" when the player is not in the roster.
+func (d *parsedDemo) playerName(key string, byUserID bool) string {
+	entry, _ := d.rosterEntry(key, byUserID)
+	return entry.Name
+}
+
+// rosterEntry returns the roster entry of the player a voice source key refers to, a SteamID64
+// or, with byUserID, a user ID, and whether the player is in the roster.
+func (d *parsedDemo) rosterEntry(key string, byUserID bool) (rosterEntry, bool) {
+	for _, entry := range d.Roster {
+		if byUserID && strconv.Itoa(entry.UserID) == key {
+			return entry, true
+		}
+		if !byUserID && !isBotXUID(entry.SteamID) && strconv.FormatUint(entry.SteamID, 10) == key {
+			return entry, true
+		}
+	}
+	return rosterEntry{}, false
+}
+
+// voiceFormat returns the voice data format of the most packets among a player's packet
+// formats, or "" when there are none. Decoding follows each packet's own format; this only
+// summarises a player whose packets mix formats.
+func voiceFormat(formats []string) string {
+	counts := make(map[string]int)
+	best := ""
+	for _, format := range formats {
+		counts[format]++
+		if counts[format] > counts[best] || counts[format] == counts[best] && format < best {
+			best = format
+		}
+	}
+	return best
+}
+
+// senderUserID returns the user ID of the player in the given client slot, or -1 when no
+// participant is known for it. A slot's controller entity is the slot index plus one. An entity
+// index is a valid handle with no serial bits, so FindByHandle64 looks it up directly rather than
+// copying every participant the way ByEntityID does, which would happen on every voice packet.
+func senderUserID(parser dem.Parser, client int32) int {
+	if player := parser.GameState().Participants().FindByHandle64(uint64(client) + 1); player != nil {
+		return player.UserID
+	}
+	return -1
+}
+
+// teamName returns a short readable name for a team.
+func teamName(team common.Team) string {
+	switch team {
+	case common.TeamTerrorists:
+		return "T"
+	case common.TeamCounterTerrorists:
+		return "CT"
+	case common.TeamSpectators:
+		return "spectator"
+	default:
+		return "unassigned"
+	}
+}
+
+// parseToEnd runs the parser to completion, converting a panic into an ErrDemoParsePanic error
+// carrying the recovered value and stack so a malformed demo cannot take down the process.
+func parseToEnd(parser dem.Parser) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%w: %v\n%s", ErrDemoParsePanic, r, debug.Stack())
+		}
+	}()
+	return parser.ParseToEnd()
+}
+
+// hashFile returns the hex SHA-256 of a file's content.
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// readDemoCache decodes a cached parsedDemo.
+func readDemoCache(path string) (*parsedDemo, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	demo := &parsedDemo{}
+	if err := gob.NewDecoder(bufio.NewReader(file)).Decode(demo); err != nil {
+		return nil, err
+	}
+	return demo, nil
+}
+
+// writeDemoCache stores demo at path, writing to a temporary file first so a
+// concurrent reader never sees a partial entry.
+func writeDemoCache(path string, demo *parsedDemo) error {
+	if err := os.MkdirAll(filepath.Dir(path), DirPermissions); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".cache-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	if err := gob.NewEncoder(w).Encode(demo); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
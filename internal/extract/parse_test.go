@@ -0,0 +1,80 @@
+package extract
+
+import (
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	dem "github.com/markus-wa/demoinfocs-golang/v4/pkg/demoinfocs"
+)
+
+// handlerParser stands in for a demo parser, running handler as ParseToEnd would for each event.
+type handlerParser struct {
+	dem.Parser
+	handler func()
+}
+
+func (p handlerParser) ParseToEnd() error {
+	p.handler()
+	return nil
+}
+
+func TestParseToEndRecoversHandlerPanic(t *testing.T) {
+	parser := handlerParser{handler: func() { panic("malformed entity") }}
+
+	err := parseToEnd(parser)
+	if !errors.Is(err, ErrDemoParsePanic) {
+		t.Fatalf("err = %v, want ErrDemoParsePanic", err)
+	}
+	if !strings.Contains(err.Error(), "malformed entity") {
+		t.Errorf("error %q does not carry the recovered value", err)
+	}
+
+	if err := parseToEnd(handlerParser{handler: func() {}}); err != nil {
+		t.Errorf("without a panic: err = %v, want nil", err)
+	}
+}
+
+func TestNamesResolveFromFinalRoster(t *testing.T) {
+	player := strconv.FormatUint(testSteamID, 10)
+	// The first two packets arrived before the player connected, so their sender was unknown
+	demo := testDemo(map[string][]testSource{
+		player: {{rawPacket(1), 0, voiceFormatSteam}, {rawPacket(2), time.Second, voiceFormatSteam}, {rawPacket(3), 2 * time.Second, voiceFormatSteam}},
+		"0":    {{rawPacket(4), 0, voiceFormatSteam}},
+	})
+	demo.PacketUserIDs[player] = []int{-1, -1, 7}
+	demo.PacketUserIDs["0"] = []int{-1}
+	// The roster is read once parsing ends, so it has the name the player had last
+	demo.Roster = []rosterEntry{
+		{SteamID: testSteamID, UserID: 7, Name: "renamed", Team: "T"},
+		{SteamID: 0, UserID: 9, Name: "BOT Eli", Team: "CT"},
+	}
+
+	fillUserIDs(demo)
+	if want := []int{7, 7, 7}; !slices.Equal(demo.PacketUserIDs[player], want) {
+		t.Errorf("player user IDs = %v, want %v", demo.PacketUserIDs[player], want)
+	}
+	// Bots share xuid 0, so their unknown senders cannot be matched
+	if want := []int{-1}; !slices.Equal(demo.PacketUserIDs["0"], want) {
+		t.Errorf("bot user IDs = %v, want %v", demo.PacketUserIDs["0"], want)
+	}
+
+	for _, tt := range []struct {
+		key      string
+		byUserID bool
+		want     string
+	}{
+		{player, false, "renamed"},
+		{"7", true, "renamed"},
+		{"9", true, "BOT Eli"},
+		{"0", false, ""},
+		{"76561198000000002", false, ""},
+	} {
+		if got := demo.playerName(tt.key, tt.byUserID); got != tt.want {
+			t.Errorf("playerName(%q, byUserID %v) = %q, want %q", tt.key, tt.byUserID, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package extract
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"time"
+
+	"github.com/DiskMethod/cs2-voice-tools/internal/decoder"
+)
+
+// DecodedPlayer is one player's voice decoded to PCM by DecodeVoiceData.
+type DecodedPlayer struct {
+	// Player is the SteamID64 of the player
+	Player string
+	// Name is the player's name at the end of the demo, when known
+	Name string
+	// SampleRate is the rate of PCM in Hz
+	SampleRate int
+	// PCM is the player's mono audio, full scale ±1, with the pauses between transmissions removed
+	PCM []float32
+	// VoicedDuration is the part of the audio decoded from real voice data
+	VoicedDuration time.Duration
+}
+
+// DecodeVoiceData decodes every player's voice to PCM in memory, writing no files, for callers
+// that process the audio themselves. The demo is loaded as for extraction (honouring the cache),
+// and PlayerIDs, IncludeBots, SortBy, LossConcealment, MaxConcealedFrames, TargetSampleRate, Gain, Headroom,
+// SilenceGaps, KeepEmpty and Jobs apply; output options are ignored. The samples are those
+// ExtractVoiceData writes, before they are converted to the bit depth. Players that fail to decode are skipped;
+// when none can be decoded the error wraps ErrNoDecodableVoice.
+func DecodeVoiceData(ctx context.Context, opts ExtractOptions) ([]DecodedPlayer, error) {
+	if err := opts.applyDefaults(); err != nil {
+		return nil, err
+	}
+	if err := validateDecodeOptions(opts); err != nil {
+		return nil, err
+	}
+	if err := decoder.CheckOpus(); err != nil {
+		return nil, err
+	}
+
+	demo, err := loadDemo(ctx, opts, opts.Metrics)
+	if err != nil {
+		return nil, err
+	}
+	if len(demo.VoiceData) == 0 {
+		return nil, ErrNoVoiceData
+	}
+
+	playerFilter := make(map[string]bool)
+	for _, id := range opts.PlayerIDs {
+		playerFilter[id] = true
+	}
+
+	ids := make([]string, 0, len(demo.VoiceData))
+	for id := range demo.VoiceData {
+		if len(playerFilter) > 0 && !playerFilter[id] {
+			continue
+		}
+		if demo.Bots[id] && !opts.IncludeBots {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sortPlayerIDs(ids, opts.SortBy, demo, false)
+
+	decoded := make([]*DecodedPlayer, len(ids))
+	decodeErrs := make([]error, len(ids))
+	forEachParallel(len(ids), opts.Jobs, func(i int) {
+		id := ids[i]
+		if ctx.Err() != nil {
+			return
+		}
+		pcm, result, err := decodePlayerVoice(id, demo.VoiceData[id], demo.PacketFormats[id], demo.SampleRates[id], opts)
+		if errors.Is(err, ErrNoAudio) {
+			slog.Debug("No decodable audio, skipping player", "player", id)
+			return
+		}
+		if err != nil {
+			slog.Error("Failed to decode voice data", "player", id, "error", err)
+			decodeErrs[i] = fmt.Errorf("player %s: %w", id, err)
+			return
+		}
+
+		decoded[i] = &DecodedPlayer{
+			Player:         id,
+			Name:           demo.playerName(id, false),
+			SampleRate:     result.SampleRate,
+			PCM:            pcm,
+			VoicedDuration: result.VoicedDuration,
+		}
+	})
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("decoding was cancelled: %w", err)
+	}
+
+	players := make([]DecodedPlayer, 0, len(ids))
+	for _, player := range decoded {
+		if player != nil {
+			players = append(players, *player)
+		}
+	}
+	if err := errors.Join(decodeErrs...); err != nil && len(players) == 0 {
+		return nil, fmt.Errorf("%w: %w", ErrNoDecodableVoice, err)
+	}
+	return players, nil
+}
+
+// validateDecodeOptions checks the options that shape decoding, shared by extraction, in-memory
+// decoding and verification so each rejects the same values with the same error.
+func validateDecodeOptions(opts ExtractOptions) error {
+	if opts.TargetSampleRate != 0 && !opusSampleRates[opts.TargetSampleRate] {
+		return fmt.Errorf("unsupported sample rate: %d (expected 8000, 12000, 16000, 24000 or 48000)", opts.TargetSampleRate)
+	}
+	if opts.Headroom < 0 || math.IsNaN(opts.Headroom) || math.IsInf(opts.Headroom, 0) {
+		return fmt.Errorf("invalid headroom: %v dB (must be zero or positive)", opts.Headroom)
+	}
+	if err := validateGain(opts.Gain); err != nil {
+		return err
+	}
+	if err := validateMaxConcealedFrames(opts.MaxConcealedFrames); err != nil {
+		return err
+	}
+	if err := validateSortBy(opts.SortBy); err != nil {
+		return err
+	}
+	if opts.Jobs < 0 {
+		return fmt.Errorf("invalid job count: %d (must be zero or positive)", opts.Jobs)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package extract
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// playlistFileName is the name of the playlist written to the output directory.
+const playlistFileName = "playlist.m3u8"
+
+// Playlist ordering options
+const (
+	// PlaylistOrderName orders entries by title
+	PlaylistOrderName = "name"
+	// PlaylistOrderDuration orders entries by duration, longest first
+	PlaylistOrderDuration = "duration"
+)
+
+// playlistEntry is one extracted file listed in the playlist.
+type playlistEntry struct {
+	Path     string
+	Title    string
+	Duration time.Duration
+}
+
+// writePlaylist writes an extended M3U playlist of entries to dir with the given mode and returns
+// its path. File references are relative to dir so the playlist keeps working if the directory is moved.
+func writePlaylist(dir string, entries []playlistEntry, order string, mode os.FileMode) (string, error) {
+	switch order {
+	case PlaylistOrderDuration:
+		sort.SliceStable(entries, func(i, j int) bool { return entries[i].Duration > entries[j].Duration })
+	case PlaylistOrderName, "":
+		sort.SliceStable(entries, func(i, j int) bool { return entries[i].Title < entries[j].Title })
+	default:
+		return "", fmt.Errorf("unsupported playlist order: %s (expected %s or %s)", order, PlaylistOrderName, PlaylistOrderDuration)
+	}
+
+	playlistPath := filepath.Join(dir, playlistFileName)
+	file, err := os.Create(playlistPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to create playlist: %w", err)
+	}
+
+	w := bufio.NewWriter(file)
+	fmt.Fprintln(w, "#EXTM3U")
+	for _, e := range entries {
+		ref := e.Path
+		if rel, err := filepath.Rel(dir, e.Path); err == nil {
+			ref = filepath.ToSlash(rel)
+		}
+		title := strings.NewReplacer("\r", " ", "\n", " ").Replace(e.Title)
+		fmt.Fprintf(w, "#EXTINF:%d,%s\n", int(math.Ceil(e.Duration.Seconds())), title)
+		fmt.Fprintln(w, ref)
+	}
+
+	if err := w.Flush(); err != nil {
+		file.Close()
+		return "", fmt.Errorf("failed to write playlist: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return "", fmt.Errorf("failed to write playlist: %w", err)
+	}
+	if err := setMode(playlistPath, mode); err != nil {
+		return "", err
+	}
+
+	return playlistPath, nil
+}
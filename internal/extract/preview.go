@@ -0,0 +1,15 @@
+package extract
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// previewSuffix is inserted before the extension of outputs written with ExtractOptions.Preview.
+const previewSuffix = ".preview"
+
+// previewPath returns path with previewSuffix before its extension, e.g. "123.wav" becomes "123.preview.wav".
+func previewPath(path string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + previewSuffix + ext
+}
@@ -0,0 +1,49 @@
+package extract
+
+import (
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// progressInterval is the shortest time between two progress reports.
+const progressInterval = 100 * time.Millisecond
+
+// ProgressFunc receives the fraction of the demo parsed so far, from 0 to 1.
+type ProgressFunc func(fraction float64)
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n atomic.Int64
+}
+
+// Read reads from the underlying reader, adding to the count.
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n.Add(int64(n))
+	return n, err
+}
+
+// progressReporter throttles progress updates to one per progressInterval, never reporting a
+// smaller fraction than before.
+type progressReporter struct {
+	fn   ProgressFunc
+	last time.Time
+	sent float64
+}
+
+// report passes fraction on if progressInterval has passed since the last report.
+func (p *progressReporter) report(fraction float64) {
+	if now := time.Now(); now.Sub(p.last) >= progressInterval {
+		p.send(fraction)
+		p.last = now
+	}
+}
+
+// send passes fraction on immediately, clamped to [previous report, 1].
+func (p *progressReporter) send(fraction float64) {
+	fraction = min(max(fraction, p.sent), 1)
+	p.sent = fraction
+	p.fn(fraction)
+}
@@ -0,0 +1,49 @@
+package extract
+
+// ExtractedFile describes one audio file written by ExtractVoiceData.
+type ExtractedFile struct {
+	Player string `json:"player"`
+	// UserID is the demo's user ID for the player, when the parser knew it
+	UserID string `json:"userId,omitempty"`
+	// Name is the player's name at the end of the demo, when known, exactly as the demo has it
+	Name string `json:"name,omitempty"`
+	// DisplayName is Name without control or invisible characters, trimmed and length-limited
+	DisplayName string `json:"displayName,omitempty"`
+	Path        string `json:"path"`
+	// Duration is the playback length of the file, in seconds
+	Duration float64 `json:"duration"`
+	// VoicedDuration is the part of Duration decoded from real voice data, in seconds
+	VoicedDuration float64 `json:"voicedDuration"`
+	SampleRate     int     `json:"sampleRate"`
+	// Clip is the file's 1-based talk-spurt number when split by spurt
+	Clip int `json:"clip,omitempty"`
+	// Round is the file's round number when split by round; it is left out for the voice
+	// between rounds (round 0)
+	Round int `json:"round,omitempty"`
+	// Start is the demo time the clip starts at, in seconds, when split by spurt or round, or the
+	// mix starts at when mixed
+	Start float64 `json:"start,omitempty"`
+	// Preview marks a file holding only the start of the player's audio (see ExtractOptions.Preview)
+	Preview bool `json:"preview,omitempty"`
+	// SteamIDMismatches is the number of the player's Steam packets whose embedded SteamID differs
+	// from the net message's xuid, which points at a parsing bug or an unusual demo
+	SteamIDMismatches int `json:"steamIdMismatches,omitempty"`
+}
+
+// ExtractResult summarizes a completed extraction.
+type ExtractResult struct {
+	Demo      string `json:"demo"`
+	OutputDir string `json:"outputDir"`
+	Format    string `json:"format"`
+	// Files lists the audio files written in this run
+	Files []ExtractedFile `json:"files"`
+	// MissingPlayers lists requested players that had no voice data in the demo
+	MissingPlayers []string `json:"missingPlayers,omitempty"`
+	// OmittedPlayers lists players with voice data left out by MaxPlayers
+	OmittedPlayers []string `json:"omittedPlayers,omitempty"`
+	// MatchInfo is the official match metadata from the demo's .dem.info companion file, if it has one
+	MatchInfo *MatchInfo `json:"matchInfo,omitempty"`
+	// DecodeErr joins the errors of players whose voice could not be decoded, each wrapping the
+	// decoder's error so errors.Is matches sentinels such as voicepacket.ErrMismatchChecksum
+	DecodeErr error `json:"-"`
+}
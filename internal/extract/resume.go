@@ -0,0 +1,163 @@
+package extract
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// resumeManifestName is the file in the output directory that records completed outputs for resumption.
+const resumeManifestName = ".cs2voice-resume.json"
+
+// resumeEntry records a completed output file and the hash of the packets and settings it was
+// produced from (see hashOutput).
+type resumeEntry struct {
+	Player string `json:"player"`
+	Hash   string `json:"hash"`
+}
+
+// resumeManifest tracks completed outputs so an interrupted extraction can skip finished players.
+// Entries are keyed by the output path relative to the output directory.
+type resumeManifest struct {
+	path    string
+	dir     string
+	mode    os.FileMode
+	Outputs map[string]resumeEntry `json:"outputs"`
+}
+
+// loadResumeManifest reads the manifest from dir, returning an empty manifest if none exists yet.
+// The manifest is written with mode.
+func loadResumeManifest(dir string, mode os.FileMode) (*resumeManifest, error) {
+	m := &resumeManifest{
+		path:    filepath.Join(dir, resumeManifestName),
+		dir:     dir,
+		mode:    mode,
+		Outputs: make(map[string]resumeEntry),
+	}
+
+	data, err := os.ReadFile(m.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return m, nil
+		}
+		return nil, fmt.Errorf("failed to read resume manifest: %w", err)
+	}
+
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("failed to parse resume manifest '%s': %w", m.path, err)
+	}
+	if m.Outputs == nil {
+		m.Outputs = make(map[string]resumeEntry)
+	}
+
+	return m, nil
+}
+
+// key returns the manifest key for an output path.
+func (m *resumeManifest) key(outputPath string) string {
+	if rel, err := filepath.Rel(m.dir, outputPath); err == nil {
+		return filepath.ToSlash(rel)
+	}
+	return outputPath
+}
+
+// isComplete reports whether outputPath was already produced from the same player's packets with
+// the same output settings, and the file is still present.
+func (m *resumeManifest) isComplete(outputPath, player, hash string) bool {
+	entry, ok := m.Outputs[m.key(outputPath)]
+	if !ok || entry.Player != player || entry.Hash != hash {
+		return false
+	}
+
+	_, err := os.Stat(outputPath)
+	return err == nil
+}
+
+// record marks outputPath as complete and persists the manifest immediately,
+// so progress survives an interruption later in the run.
+func (m *resumeManifest) record(outputPath, player, hash string) error {
+	m.Outputs[m.key(outputPath)] = resumeEntry{Player: player, Hash: hash}
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode resume manifest: %w", err)
+	}
+
+	if err := os.WriteFile(m.path, data, m.mode); err != nil {
+		return fmt.Errorf("failed to write resume manifest: %w", err)
+	}
+	if err := setMode(m.path, m.mode); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// outputSettings are the options that change the content of an output file beyond the packets it
+// is decoded from. They are hashed with the packets, so a resumed run with different settings
+// redoes the outputs written with the old ones instead of keeping them as complete. Packet filters
+// (tick range, life state, score) need no entry, since they change the packets themselves.
+type outputSettings struct {
+	Format             string   `json:"format"`
+	BitDepth           int      `json:"bitDepth"`
+	WAVEncoder         string   `json:"wavEncoder"`
+	OggEncoder         string   `json:"oggEncoder"`
+	Headroom           float64  `json:"headroom"`
+	Gain               int      `json:"gain"`
+	LossConcealment    string   `json:"lossConcealment"`
+	MaxConcealedFrames int      `json:"maxConcealedFrames"`
+	SilenceGaps        bool     `json:"silenceGaps"`
+	TargetSampleRate   int      `json:"targetSampleRate"`
+	LoudnessMatch      bool     `json:"loudnessMatch"`
+	LoudnessTarget     float64  `json:"loudnessTarget"`
+	CompactTimeline    bool     `json:"compactTimeline"`
+	CompactGap         string   `json:"compactGap"`
+	Preview            string   `json:"preview"`
+	PacketCues         bool     `json:"packetCues"`
+	WAVInfo            bool     `json:"wavInfo"`
+	FFmpegExtraArgs    []string `json:"ffmpegExtraArgs"`
+}
+
+// newOutputSettings collects the output settings of opts for a player written in format.
+func newOutputSettings(opts ExtractOptions, format string) outputSettings {
+	return outputSettings{
+		Format:             format,
+		BitDepth:           opts.BitDepth,
+		WAVEncoder:         opts.WAVEncoder,
+		OggEncoder:         opts.OggEncoder,
+		Headroom:           opts.Headroom,
+		Gain:               opts.Gain,
+		LossConcealment:    opts.LossConcealment.String(),
+		MaxConcealedFrames: opts.MaxConcealedFrames,
+		SilenceGaps:        opts.SilenceGaps,
+		TargetSampleRate:   opts.TargetSampleRate,
+		LoudnessMatch:      opts.LoudnessMatch,
+		LoudnessTarget:     opts.LoudnessTarget,
+		CompactTimeline:    opts.CompactTimeline,
+		CompactGap:         opts.CompactGap.String(),
+		Preview:            opts.Preview.String(),
+		PacketCues:         opts.PacketCues,
+		WAVInfo:            opts.WAVInfo,
+		FFmpegExtraArgs:    opts.FFmpegExtraArgs,
+	}
+}
+
+// hashOutput returns a hex SHA-256 over the output settings and the length-prefixed voice packets
+// of a player, identifying the content of the file they produce.
+func hashOutput(payloads [][]byte, settings outputSettings) string {
+	h := sha256.New()
+	// The settings are a struct of plain values, so encoding cannot fail
+	encoded, _ := json.Marshal(settings)
+	h.Write(encoded)
+	var lenBuf [4]byte
+	for _, p := range payloads {
+		binary.LittleEndian.PutUint32(lenBuf[:], uint32(len(p)))
+		h.Write(lenBuf[:])
+		h.Write(p)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
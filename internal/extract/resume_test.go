@@ -0,0 +1,41 @@
+package extract
+
+import (
+	"testing"
+
+	"github.com/DiskMethod/cs2-voice-tools/internal/decoder"
+)
+
+func TestHashOutputCoversSettings(t *testing.T) {
+	payloads := [][]byte{{1, 2, 3}, {4, 5}}
+	opts := ExtractOptions{Format: "wav", BitDepth: 32}
+	base := hashOutput(payloads, newOutputSettings(opts, "wav"))
+
+	if again := hashOutput(payloads, newOutputSettings(opts, "wav")); again != base {
+		t.Fatalf("same packets and settings hash differently: %s, %s", base, again)
+	}
+
+	for _, tt := range []struct {
+		name string
+		opts ExtractOptions
+	}{
+		{"bit depth", ExtractOptions{Format: "wav", BitDepth: 16}},
+		{"headroom", ExtractOptions{Format: "wav", BitDepth: 32, Headroom: 3}},
+		{"gain", ExtractOptions{Format: "wav", BitDepth: 32, Gain: 6}},
+		{"loss mode", ExtractOptions{Format: "wav", BitDepth: 32, LossConcealment: decoder.LossSilence}},
+		{"concealed frames", ExtractOptions{Format: "wav", BitDepth: 32, MaxConcealedFrames: 20}},
+		{"silence gaps", ExtractOptions{Format: "wav", BitDepth: 32, SilenceGaps: true}},
+		{"sample rate", ExtractOptions{Format: "wav", BitDepth: 32, TargetSampleRate: 48000}},
+	} {
+		if hashOutput(payloads, newOutputSettings(tt.opts, "wav")) == base {
+			t.Errorf("changing the %s does not change the hash", tt.name)
+		}
+	}
+
+	if hashOutput(payloads, newOutputSettings(opts, "mp3")) == base {
+		t.Error("changing the format does not change the hash")
+	}
+	if hashOutput(payloads[:1], newOutputSettings(opts, "wav")) == base {
+		t.Error("changing the packets does not change the hash")
+	}
+}
@@ -0,0 +1,154 @@
+package extract
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	dem "github.com/markus-wa/demoinfocs-golang/v4/pkg/demoinfocs"
+	"github.com/markus-wa/demoinfocs-golang/v4/pkg/demoinfocs/events"
+)
+
+// roundSpan is a stretch of demo time taken by one round of the match.
+type roundSpan struct {
+	// Number is the 1-based round number, as the game counts it
+	Number int
+	// FreezeStart is when the round started, at the beginning of freeze time
+	FreezeStart time.Duration
+	// Start is when freeze time ended and play began, or FreezeStart if that was not seen
+	Start time.Duration
+	End   time.Duration
+}
+
+// trackRounds records a round span for every round started outside warmup, lasting until the
+// round ends. The time between a round's end and the next round's start belongs to no round.
+// The returned function closes a round still open at the end of the demo and must be called
+// once parsing completes.
+func trackRounds(parser dem.Parser, demo *parsedDemo) func() {
+	// open is the index in demo.Rounds of the round in progress, or -1
+	open := -1
+
+	closeRound := func() {
+		if open >= 0 {
+			demo.Rounds[open].End = parser.CurrentTime()
+			open = -1
+		}
+	}
+
+	parser.RegisterEventHandler(func(events.RoundStart) {
+		// A round can start without a RoundEnd, e.g. after a restart
+		closeRound()
+		if parser.GameState().IsWarmupPeriod() {
+			return
+		}
+		now := parser.CurrentTime()
+		open = len(demo.Rounds)
+		demo.Rounds = append(demo.Rounds, roundSpan{
+			Number:      parser.GameState().TotalRoundsPlayed() + 1,
+			FreezeStart: now,
+			Start:       now,
+		})
+	})
+	parser.RegisterEventHandler(func(events.RoundFreezetimeEnd) {
+		if open >= 0 {
+			demo.Rounds[open].Start = parser.CurrentTime()
+		}
+	})
+	parser.RegisterEventHandler(func(events.RoundEnd) { closeRound() })
+
+	return closeRound
+}
+
+// roundAt returns the number of the round being played at demo time t, or 0 when t falls
+// between rounds. Freeze time belongs to its round only with freezeTime set.
+func roundAt(rounds []roundSpan, t time.Duration, freezeTime bool) int {
+	for _, r := range rounds {
+		start := r.Start
+		if freezeTime {
+			start = r.FreezeStart
+		}
+		if t >= start && t < r.End {
+			return r.Number
+		}
+	}
+	return 0
+}
+
+// roundPath returns path with a round number inserted before the extension, e.g. player.wav
+// becomes player_round03.wav.
+func roundPath(path string, round int) string {
+	if path == "" {
+		return ""
+	}
+	ext := filepath.Ext(path)
+	return fmt.Sprintf("%s_round%02d%s", strings.TrimSuffix(path, ext), round, ext)
+}
+
+// splitByRound cuts a decoded player into one part per round they spoke in, in round order.
+// Each packet goes to the round it arrived in, and its audio is appended to that round's part;
+// packets between rounds (warmup, time after a round ends and, without freezeTime, freeze time)
+// are collected in round 0. Each part carries its packets with offsets relative to the part and
+// the demo time of its first packet. Voiced duration is estimated from the player's share of
+// voiced audio, as for talk-spurt clips.
+func splitByRound(p decodedPlayer, rounds []roundSpan, freezeTime bool) []decodedPlayer {
+	var voicedRatio float64
+	if p.result.Duration > 0 {
+		voicedRatio = float64(p.result.VoicedDuration) / float64(p.result.Duration)
+	}
+
+	parts := make(map[int]*decodedPlayer)
+	for i, offset := range p.result.PacketOffsets {
+		if i >= len(p.packetTimes) {
+			break
+		}
+		end := p.result.Samples
+		if i+1 < len(p.result.PacketOffsets) {
+			end = p.result.PacketOffsets[i+1]
+		}
+
+		round := roundAt(rounds, p.packetTimes[i], freezeTime)
+		part, ok := parts[round]
+		if !ok {
+			part = &decodedPlayer{
+				id:              p.id,
+				result:          decodeResult{SampleRate: p.result.SampleRate},
+				tempWavPath:     roundPath(p.tempWavPath, round),
+				finalOutputPath: roundPath(p.finalOutputPath, round),
+				format:          p.format,
+				round:           round,
+				start:           p.packetTimes[i],
+			}
+			parts[round] = part
+		}
+		part.result.PacketOffsets = append(part.result.PacketOffsets, len(part.pcm))
+		part.packetTimes = append(part.packetTimes, p.packetTimes[i])
+		part.packets++
+		part.pcm = append(part.pcm, p.pcm[offset:end]...)
+	}
+
+	numbers := make([]int, 0, len(parts))
+	for round, part := range parts {
+		// Rounds whose packets produced no audio (silence, skipped) get no file
+		if len(part.pcm) > 0 {
+			numbers = append(numbers, round)
+		}
+	}
+	slices.Sort(numbers)
+
+	split := make([]decodedPlayer, 0, len(numbers))
+	for _, round := range numbers {
+		part := parts[round]
+		part.result.Samples = len(part.pcm) / defaultNumChannels
+		part.result.Duration = samplesDuration(len(part.pcm), part.result.SampleRate, defaultNumChannels)
+		part.result.VoicedDuration = time.Duration(float64(part.result.Duration) * voicedRatio)
+		// The player's decode time and stats are counted once, with its first part
+		if len(split) == 0 {
+			part.decodeTime = p.decodeTime
+			part.result.Stats = p.result.Stats
+		}
+		split = append(split, *part)
+	}
+	return split
+}
@@ -0,0 +1,72 @@
+package extract
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// scoreUpdate is a team's score changing during the demo.
+type scoreUpdate struct {
+	Time time.Duration
+	// Side is the side the team was playing when the score changed ("CT" or "T")
+	Side  string
+	Clan  string
+	Score int
+}
+
+// scoreCondition is a team reaching a number of round wins, as given to FromScore.
+type scoreCondition struct {
+	// Team is "any", "ct", "t", or a clan name compared case-insensitively
+	Team string
+	Wins int
+}
+
+// parseScoreCondition parses a FromScore value of the form "<team>=<wins>", where team is
+// any, ct, t or a clan name.
+func parseScoreCondition(s string) (scoreCondition, error) {
+	team, wins, ok := strings.Cut(s, "=")
+	team = strings.TrimSpace(team)
+	if !ok || team == "" {
+		return scoreCondition{}, fmt.Errorf("invalid score condition: %q (expected <team>=<wins>, e.g. any=12)", s)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(wins))
+	if err != nil || n < 1 {
+		return scoreCondition{}, fmt.Errorf("invalid score condition: %q (wins must be a positive number)", s)
+	}
+	return scoreCondition{Team: strings.ToLower(team), Wins: n}, nil
+}
+
+// matches reports whether a score update satisfies the condition.
+func (c scoreCondition) matches(u scoreUpdate) bool {
+	if u.Score < c.Wins {
+		return false
+	}
+	switch c.Team {
+	case "any":
+		return true
+	case "ct", "t":
+		return strings.EqualFold(u.Side, c.Team)
+	default:
+		return strings.EqualFold(u.Clan, c.Team)
+	}
+}
+
+// scoreConditionTime returns the demo time at which the condition first holds.
+func scoreConditionTime(updates []scoreUpdate, c scoreCondition) (time.Duration, bool) {
+	for _, u := range updates {
+		if c.matches(u) {
+			return u.Time, true
+		}
+	}
+	return 0, false
+}
+
+// packetsFrom keeps only the voice packets received at or after start, dropping players left
+// with none.
+func packetsFrom(demo *parsedDemo, start time.Duration) *parsedDemo {
+	return filterPackets(demo, func(key string, i int) bool {
+		return demo.PacketTimes[key][i] >= start
+	})
+}
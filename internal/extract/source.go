@@ -0,0 +1,406 @@
+package extract
+
+import (
+	"archive/zip"
+	"bufio"
+	"compress/bzip2"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// ErrDemoNotInArchive is returned when an archive does not contain the requested demo entry
+var ErrDemoNotInArchive = errors.New("no demo file found in archive")
+
+// zipMagic is the local file header signature at the start of a zip archive
+var zipMagic = []byte("PK\x03\x04")
+
+// Signatures at the start of compressed demos (.dem.gz, .dem.bz2)
+var (
+	gzipMagic  = []byte{0x1f, 0x8b}
+	bzip2Magic = []byte("BZh")
+)
+
+// compressedDemoExts are the extensions of compressed demos, trimmed to find the demo's own name.
+var compressedDemoExts = []string{".gz", ".bz2"}
+
+// demoReader is a demo stream together with everything that must be closed after parsing.
+type demoReader struct {
+	io.Reader
+	closers []io.Closer
+	// size is the length of the stream in bytes, or zero if unknown
+	size int64
+}
+
+// Close closes the underlying resources in reverse order of opening.
+func (d *demoReader) Close() error {
+	var errs []error
+	for i := len(d.closers) - 1; i >= 0; i-- {
+		if err := d.closers[i].Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// DemoSource provides the bytes of a demo to parse. Implementations exist for files, zip
+// archives, URLs and stdin; NewDemoSource picks one from a path the way the CLI does.
+type DemoSource interface {
+	// Name identifies the demo in logs and output files, e.g. its path or URL
+	Name() string
+	// Open returns a reader over the demo; the caller closes it. Cancelling ctx may abort reading
+	Open(ctx context.Context) (io.ReadCloser, error)
+	// Seekable reports whether the reader returned by Open also implements io.Seeker
+	Seekable() bool
+}
+
+// FileSource reads a demo from a file on disk. A file that turns out to be a zip
+// archive is read like an ArchiveSource with its first .dem entry.
+type FileSource struct {
+	Path string
+}
+
+// ArchiveSource streams a demo entry from a zip archive on disk without extracting it.
+type ArchiveSource struct {
+	Path string
+	// Entry selects the entry by full or base name; empty means the first .dem entry
+	Entry string
+}
+
+// URLSource streams a demo from an http:// or https:// URL.
+type URLSource struct {
+	URL string
+	// Timeout bounds the whole download, including reading the body; zero means no limit
+	Timeout time.Duration
+	// AuthHeader, if set, is a "Name: value" header added to the request
+	AuthHeader string
+}
+
+// StdinSource reads a demo from standard input.
+type StdinSource struct{}
+
+// stdinDemoPath is the demo path that selects StdinSource.
+const stdinDemoPath = "-"
+
+// NewDemoSource returns the source for a demo path as given on the command line: "-" reads stdin,
+// http(s) URLs are downloaded, and paths with a .zip extension or an entry name are read as archives.
+// timeout and authHeader only apply to URLs.
+func NewDemoSource(demoPath, entry string, timeout time.Duration, authHeader string) DemoSource {
+	switch {
+	case demoPath == stdinDemoPath:
+		return StdinSource{}
+	case isDemoURL(demoPath):
+		return URLSource{URL: demoPath, Timeout: timeout, AuthHeader: authHeader}
+	case entry != "" || strings.EqualFold(path.Ext(demoPath), ".zip"):
+		return ArchiveSource{Path: demoPath, Entry: entry}
+	default:
+		return FileSource{Path: demoPath}
+	}
+}
+
+// Name returns the file path.
+func (s FileSource) Name() string { return s.Path }
+
+// Seekable reports whether the file is a plain demo; one that turns out to be a zip archive or
+// compressed is not.
+func (s FileSource) Seekable() bool {
+	file, err := os.Open(s.Path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	for _, magic := range [][]byte{zipMagic, gzipMagic, bzip2Magic} {
+		if ok, err := hasMagic(file, magic); err != nil || ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Open opens the file, or its first .dem entry if it is a zip archive.
+func (s FileSource) Open(ctx context.Context) (io.ReadCloser, error) {
+	file, err := os.Open(s.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open demo file '%s': %w", s.Path, err)
+	}
+
+	isZip, err := hasMagic(file, zipMagic)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to read demo file '%s': %w", s.Path, err)
+	}
+	if isZip {
+		return openArchiveEntry(file, s.Path, "")
+	}
+	return file, nil
+}
+
+// Name returns the archive path.
+func (s ArchiveSource) Name() string { return s.Path }
+
+// Seekable reports false, since entries are decompressed as they are read.
+func (s ArchiveSource) Seekable() bool { return false }
+
+// Open streams the selected entry. A file that is not actually a zip archive is read as a plain demo.
+func (s ArchiveSource) Open(ctx context.Context) (io.ReadCloser, error) {
+	file, err := os.Open(s.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open demo file '%s': %w", s.Path, err)
+	}
+
+	isZip, err := hasMagic(file, zipMagic)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to read demo file '%s': %w", s.Path, err)
+	}
+	if !isZip && !strings.EqualFold(path.Ext(s.Path), ".zip") {
+		if s.Entry != "" {
+			slog.Warn("Ignoring demo entry, input is not an archive", "entry", s.Entry)
+		}
+		return file, nil
+	}
+	return openArchiveEntry(file, s.Path, s.Entry)
+}
+
+// Name returns the URL.
+func (s URLSource) Name() string { return s.URL }
+
+// Seekable reports false, since the response body is streamed.
+func (s URLSource) Seekable() bool { return false }
+
+// Open starts the download; see openDemoURL.
+func (s URLSource) Open(ctx context.Context) (io.ReadCloser, error) {
+	return openDemoURL(ctx, s.URL, s.Timeout, s.AuthHeader)
+}
+
+// Name returns "-", the path that selects stdin.
+func (StdinSource) Name() string { return stdinDemoPath }
+
+// Seekable reports false; stdin may be a pipe.
+func (StdinSource) Seekable() bool { return false }
+
+// Open returns stdin. Closing the returned reader leaves stdin open.
+func (StdinSource) Open(ctx context.Context) (io.ReadCloser, error) {
+	return io.NopCloser(os.Stdin), nil
+}
+
+// ReaderSource reads a demo from a reader the caller already has open, e.g. a request body or an
+// object store download. The reader is read once, from its current position, and never closed.
+type ReaderSource struct {
+	Reader io.Reader
+	// Label identifies the demo in logs; "reader" if empty
+	Label string
+}
+
+// Name returns the label of the demo.
+func (s ReaderSource) Name() string {
+	if s.Label == "" {
+		return "reader"
+	}
+	return s.Label
+}
+
+// Seekable reports false; the reader is only read sequentially.
+func (ReaderSource) Seekable() bool { return false }
+
+// Open returns the reader. Closing the returned reader leaves the underlying one open.
+func (s ReaderSource) Open(ctx context.Context) (io.ReadCloser, error) {
+	if s.Reader == nil {
+		return nil, fmt.Errorf("demo reader is nil")
+	}
+	return io.NopCloser(s.Reader), nil
+}
+
+// streamSize returns the length in bytes of a stream returned by DemoSource.Open, or zero when
+// it is not known (stdin, or a download without a Content-Length).
+func streamSize(r io.Reader) int64 {
+	switch r := r.(type) {
+	case *demoReader:
+		return r.size
+	case *os.File:
+		if info, err := r.Stat(); err == nil && info.Mode().IsRegular() {
+			return info.Size()
+		}
+	}
+	return 0
+}
+
+// decompressDemo wraps a demo stream compressed with gzip or bzip2 in a decompressor that
+// inflates it as it is read, so nothing is written to disk or held in memory. Compression is
+// recognised by its magic bytes, whatever the file is called. Other streams are returned
+// unchanged. Closing the result closes r.
+func decompressDemo(r io.ReadCloser) (io.ReadCloser, error) {
+	// Files are peeked at in place so plain demos keep their size for progress reporting
+	var peek func(magic []byte) (bool, error)
+	var br *bufio.Reader
+	if file, ok := r.(*os.File); ok {
+		peek = func(magic []byte) (bool, error) { return hasMagic(file, magic) }
+	} else {
+		br = bufio.NewReader(r)
+		peek = func(magic []byte) (bool, error) {
+			header, err := br.Peek(len(magic))
+			if err != nil && !errors.Is(err, io.EOF) {
+				return false, err
+			}
+			return string(header) == string(magic), nil
+		}
+	}
+	source := io.Reader(r)
+	if br != nil {
+		source = br
+	}
+
+	isGzip, err := peek(gzipMagic)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read demo: %w", err)
+	}
+	if isGzip {
+		gz, err := gzip.NewReader(source)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read gzip-compressed demo: %w", err)
+		}
+		slog.Debug("Decompressing gzip-compressed demo")
+		return &demoReader{Reader: gz, closers: []io.Closer{r, gz}}, nil
+	}
+
+	isBzip2, err := peek(bzip2Magic)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read demo: %w", err)
+	}
+	if isBzip2 {
+		slog.Debug("Decompressing bzip2-compressed demo")
+		return &demoReader{Reader: bzip2.NewReader(source), closers: []io.Closer{r}}, nil
+	}
+
+	if br != nil {
+		return &demoReader{Reader: br, closers: []io.Closer{r}, size: streamSize(r)}, nil
+	}
+	return r, nil
+}
+
+// trimCompressionExt removes a compression extension from a demo path, e.g. "match.dem.gz"
+// becomes "match.dem".
+func trimCompressionExt(demoPath string) string {
+	for _, ext := range compressedDemoExts {
+		if strings.EqualFold(path.Ext(demoPath), ext) {
+			return demoPath[:len(demoPath)-len(ext)]
+		}
+	}
+	return demoPath
+}
+
+// isDemoURL reports whether the demo path is an http:// or https:// URL.
+func isDemoURL(demoPath string) bool {
+	lower := strings.ToLower(demoPath)
+	return strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://")
+}
+
+// openArchiveEntry streams entry (or the first .dem entry) from the open zip archive file.
+// The file is closed on error, or together with the returned reader.
+func openArchiveEntry(file *os.File, archivePath, entry string) (io.ReadCloser, error) {
+	// zip.OpenReader would reopen the file, so reuse the open handle with its size
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to stat demo archive '%s': %w", archivePath, err)
+	}
+
+	archive, err := zip.NewReader(file, info.Size())
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to read demo archive '%s': %w", archivePath, err)
+	}
+
+	demoFile, err := findDemoEntry(archive, entry)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("%w: %s", err, archivePath)
+	}
+
+	slog.Debug("Reading demo from archive", "archive", archivePath, "entry", demoFile.Name)
+	rc, err := demoFile.Open()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to open archive entry '%s': %w", demoFile.Name, err)
+	}
+
+	return &demoReader{Reader: rc, closers: []io.Closer{file, rc}, size: int64(demoFile.UncompressedSize64)}, nil
+}
+
+// openDemoURL starts an HTTP GET for demoURL and returns the response body for streaming.
+// Cancelling ctx aborts the download.
+// authHeader, if set, is a "Name: value" header added to the request (e.g. an Authorization token).
+// timeout bounds the whole download, including reading the body; zero means no limit.
+func openDemoURL(ctx context.Context, demoURL string, timeout time.Duration, authHeader string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, demoURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid demo URL '%s': %w", demoURL, err)
+	}
+
+	if authHeader != "" {
+		name, value, ok := strings.Cut(authHeader, ":")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("invalid auth header, expected 'Name: value'")
+		}
+		req.Header.Set(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download demo '%s': %w", demoURL, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to download demo '%s': %s", demoURL, resp.Status)
+	}
+
+	slog.Debug("Streaming demo from URL", "url", demoURL, "size", resp.ContentLength)
+	return &demoReader{Reader: resp.Body, closers: []io.Closer{resp.Body}, size: max(resp.ContentLength, 0)}, nil
+}
+
+// findDemoEntry returns the archive entry named entry (matched on full or base name),
+// or the first entry with a .dem extension when entry is empty.
+func findDemoEntry(archive *zip.Reader, entry string) (*zip.File, error) {
+	for _, f := range archive.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		if entry != "" {
+			if f.Name == entry || path.Base(f.Name) == entry {
+				return f, nil
+			}
+			continue
+		}
+		if strings.EqualFold(path.Ext(f.Name), ".dem") {
+			return f, nil
+		}
+	}
+
+	if entry != "" {
+		return nil, fmt.Errorf("%w (entry '%s' not found)", ErrDemoNotInArchive, entry)
+	}
+	return nil, ErrDemoNotInArchive
+}
+
+// hasMagic reports whether the file starts with magic, leaving the read offset at the start.
+func hasMagic(file *os.File, magic []byte) (bool, error) {
+	header := make([]byte, len(magic))
+	n, err := io.ReadFull(file, header)
+	if _, seekErr := file.Seek(0, io.SeekStart); seekErr != nil {
+		return false, seekErr
+	}
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return false, err
+	}
+	return n == len(magic) && string(header) == string(magic), nil
+}
@@ -0,0 +1,74 @@
+package extract
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// clipPath returns path with a 1-based clip number inserted before the extension,
+// e.g. player.wav becomes player_001.wav.
+func clipPath(path string, clip int) string {
+	if path == "" {
+		return ""
+	}
+	ext := filepath.Ext(path)
+	return fmt.Sprintf("%s_%03d%s", strings.TrimSuffix(path, ext), clip, ext)
+}
+
+// splitBySpurt cuts a decoded player into one clip per talk-spurt, numbered from 1 in order.
+// Each clip carries the packets that start within it, with offsets and times relative to the
+// clip, and the demo time it starts at. Clips shorter than minDuration are dropped without
+// using up a number. A clip's voiced duration is estimated from the player's share of voiced
+// audio, since concealment is not tracked per sample.
+func splitBySpurt(p decodedPlayer, spurts []timelineSpurt, minDuration time.Duration) []decodedPlayer {
+	var voicedRatio float64
+	if p.result.Duration > 0 {
+		voicedRatio = float64(p.result.VoicedDuration) / float64(p.result.Duration)
+	}
+
+	var clips []decodedPlayer
+	for _, spurt := range spurts {
+		duration := samplesDuration(spurt.EndSample-spurt.StartSample, spurt.SampleRate, 1)
+		if duration < minDuration {
+			continue
+		}
+
+		var offsets []int
+		var times []time.Duration
+		for i, offset := range p.result.PacketOffsets {
+			if offset >= spurt.StartSample && offset < spurt.EndSample && i < len(p.packetTimes) {
+				offsets = append(offsets, offset-spurt.StartSample)
+				times = append(times, p.packetTimes[i])
+			}
+		}
+
+		clip := len(clips) + 1
+		// The player's decode time is counted once, with its first clip
+		var decodeTime time.Duration
+		if clip == 1 {
+			decodeTime = p.decodeTime
+		}
+		result := p.result
+		result.Duration = duration
+		result.VoicedDuration = time.Duration(float64(duration) * voicedRatio)
+		result.Samples = spurt.EndSample - spurt.StartSample
+		result.PacketOffsets = offsets
+
+		clips = append(clips, decodedPlayer{
+			id:              p.id,
+			pcm:             p.pcm[spurt.StartSample:spurt.EndSample],
+			result:          result,
+			tempWavPath:     clipPath(p.tempWavPath, clip),
+			finalOutputPath: clipPath(p.finalOutputPath, clip),
+			format:          p.format,
+			packetTimes:     times,
+			packets:         len(times),
+			clip:            clip,
+			start:           time.Duration(spurt.Start * float64(time.Second)),
+			decodeTime:      decodeTime,
+		})
+	}
+	return clips
+}
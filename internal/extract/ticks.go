@@ -0,0 +1,60 @@
+package extract
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// tickRange is an inclusive range of server ticks, as given to TickRange.
+type tickRange struct {
+	Start int
+	End   int
+}
+
+// parseTickRange parses a TickRange value of the form "START:END" with START < END.
+func parseTickRange(s string) (tickRange, error) {
+	start, end, ok := strings.Cut(s, ":")
+	if !ok {
+		return tickRange{}, fmt.Errorf("invalid tick range: %q (expected START:END, e.g. 1000:5000)", s)
+	}
+	startTick, err := strconv.Atoi(strings.TrimSpace(start))
+	if err != nil || startTick < 0 {
+		return tickRange{}, fmt.Errorf("invalid tick range: %q (START must be a non-negative number)", s)
+	}
+	endTick, err := strconv.Atoi(strings.TrimSpace(end))
+	if err != nil || endTick < 0 {
+		return tickRange{}, fmt.Errorf("invalid tick range: %q (END must be a non-negative number)", s)
+	}
+	if startTick >= endTick {
+		return tickRange{}, fmt.Errorf("invalid tick range: %q (START must be less than END)", s)
+	}
+	return tickRange{Start: startTick, End: endTick}, nil
+}
+
+// clamp limits the range to the demo's ticks, from 0 to lastTick, reporting false if none
+// of the range lies within them.
+func (r tickRange) clamp(lastTick int) (tickRange, bool) {
+	if r.Start > lastTick {
+		return r, false
+	}
+	r.End = min(r.End, lastTick)
+	return r, true
+}
+
+// packetTick returns the server tick a packet arrived at. Packet times are the parser's
+// in-game tick multiplied by the tick interval, so rounding recovers the tick exactly.
+func packetTick(t time.Duration, tickRate float64) int {
+	return int(math.Round(t.Seconds() * tickRate))
+}
+
+// packetsInTickRange keeps only the voice packets that arrived within r, dropping players left
+// with none.
+func packetsInTickRange(demo *parsedDemo, r tickRange) *parsedDemo {
+	return filterPackets(demo, func(key string, i int) bool {
+		tick := packetTick(demo.PacketTimes[key][i], demo.TickRate)
+		return tick >= r.Start && tick <= r.End
+	})
+}
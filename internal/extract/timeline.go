@@ -0,0 +1,150 @@
+package extract
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// timelineFileName is the name of the talk-spurt index written to the output directory.
+const timelineFileName = "timeline.json"
+
+// spurtGap is the largest pause between consecutive voice packets that still counts as one talk-spurt.
+const spurtGap = 500 * time.Millisecond
+
+// Segment is a stretch of speech found by a voice-activity detector, as offsets from the
+// start of the audio it was given. End is exclusive.
+type Segment struct {
+	Start time.Duration
+	End   time.Duration
+}
+
+// timelineSpurt is one continuous stretch of speech by a player.
+type timelineSpurt struct {
+	Player string `json:"player"`
+	// File is the player's output file, relative to the output directory
+	File string `json:"file"`
+	// Start is the demo time the spurt began, in seconds
+	Start float64 `json:"start"`
+	// Duration is the length of the spurt's audio, in seconds
+	Duration float64 `json:"duration"`
+	// StartSample and EndSample delimit the spurt in File (per channel, end exclusive)
+	StartSample int `json:"startSample"`
+	EndSample   int `json:"endSample"`
+	SampleRate  int `json:"sampleRate"`
+}
+
+// timelineDocument is the top-level structure of timeline.json.
+type timelineDocument struct {
+	Demo   string          `json:"demo"`
+	Spurts []timelineSpurt `json:"spurts"`
+}
+
+// detectSpurts groups a player's packets into talk-spurts wherever consecutive packets are
+// more than spurtGap apart in demo time, and maps each spurt to its sample range in the output.
+func detectSpurts(player, outputPath string, packetTimes []time.Duration, result decodeResult) []timelineSpurt {
+	if len(packetTimes) == 0 || len(packetTimes) != len(result.PacketOffsets) || result.SampleRate <= 0 {
+		return nil
+	}
+
+	var spurts []timelineSpurt
+	first := 0
+	for i := 1; i <= len(packetTimes); i++ {
+		if i < len(packetTimes) && packetTimes[i]-packetTimes[i-1] <= spurtGap {
+			continue
+		}
+
+		startSample := result.PacketOffsets[first]
+		endSample := result.Samples
+		if i < len(packetTimes) {
+			endSample = result.PacketOffsets[i]
+		}
+
+		// Packets that produced no audio (silence, skipped) don't make a spurt
+		if endSample > startSample {
+			spurts = append(spurts, timelineSpurt{
+				Player:      player,
+				File:        outputPath,
+				Start:       packetTimes[first].Seconds(),
+				Duration:    float64(endSample-startSample) / float64(result.SampleRate),
+				StartSample: startSample,
+				EndSample:   endSample,
+				SampleRate:  result.SampleRate,
+			})
+		}
+		first = i
+	}
+
+	return spurts
+}
+
+// segmentSpurts turns the segments a voice-activity detector found in a player's output into
+// talk-spurts. Each segment's demo time is taken from the last packet that starts at or before
+// it, plus the segment's distance from that packet's first sample. Segments outside the audio
+// are clipped or dropped.
+func segmentSpurts(player, outputPath string, packetTimes []time.Duration, result decodeResult, segments []Segment) []timelineSpurt {
+	if len(packetTimes) == 0 || len(packetTimes) != len(result.PacketOffsets) || result.SampleRate <= 0 {
+		return nil
+	}
+
+	var spurts []timelineSpurt
+	for _, seg := range segments {
+		startSample := max(int(seg.Start*time.Duration(result.SampleRate)/time.Second), 0)
+		endSample := min(int(seg.End*time.Duration(result.SampleRate)/time.Second), result.Samples)
+		if endSample <= startSample {
+			continue
+		}
+
+		// Packet offsets never decrease, so the last one at or before the start locates it in demo time
+		packet := sort.Search(len(result.PacketOffsets), func(i int) bool { return result.PacketOffsets[i] > startSample }) - 1
+		packet = max(packet, 0)
+		start := packetTimes[packet] + samplesDuration(startSample-result.PacketOffsets[packet], result.SampleRate, 1)
+
+		spurts = append(spurts, timelineSpurt{
+			Player:      player,
+			File:        outputPath,
+			Start:       start.Seconds(),
+			Duration:    float64(endSample-startSample) / float64(result.SampleRate),
+			StartSample: startSample,
+			EndSample:   endSample,
+			SampleRate:  result.SampleRate,
+		})
+	}
+
+	return spurts
+}
+
+// writeTimeline writes the talk-spurts of all players, ordered by start time, to dir with the
+// given mode and returns its path.
+func writeTimeline(dir, demoPath string, spurts []timelineSpurt, mode os.FileMode) (string, error) {
+	sort.SliceStable(spurts, func(i, j int) bool {
+		if spurts[i].Start != spurts[j].Start {
+			return spurts[i].Start < spurts[j].Start
+		}
+		return spurts[i].Player < spurts[j].Player
+	})
+
+	for i := range spurts {
+		if rel, err := filepath.Rel(dir, spurts[i].File); err == nil {
+			spurts[i].File = filepath.ToSlash(rel)
+		}
+	}
+
+	data, err := json.MarshalIndent(timelineDocument{Demo: demoPath, Spurts: spurts}, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode timeline: %w", err)
+	}
+
+	timelinePath := filepath.Join(dir, timelineFileName)
+	if err := os.WriteFile(timelinePath, data, mode); err != nil {
+		return "", fmt.Errorf("failed to write timeline: %w", err)
+	}
+	if err := setMode(timelinePath, mode); err != nil {
+		return "", err
+	}
+
+	return timelinePath, nil
+}
@@ -0,0 +1,152 @@
+package extract
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/DiskMethod/cs2-voice-tools/internal/decoder"
+	"github.com/DiskMethod/cs2-voice-tools/internal/voicepacket"
+)
+
+// VerifyLimits are the integrity thresholds VerifyVoiceData checks. Zero tolerates none.
+type VerifyLimits struct {
+	// MaxChecksumFailures is the number of Steam packets with a bad crc32 allowed
+	MaxChecksumFailures int
+	// MaxInvalidPackets is the number of Steam packets that fail to parse for other reasons allowed
+	MaxInvalidPackets int
+	// MaxDecodeErrors is the number of decode errors allowed, counting each player whose voice
+	// fails to decode and each packet the decoder skips
+	MaxDecodeErrors int
+}
+
+// VerifiedPlayer is the integrity report for one player's voice.
+type VerifiedPlayer struct {
+	Player string `json:"player"`
+	// Name is the player's name at the end of the demo, when known
+	Name             string `json:"name,omitempty"`
+	Packets          int    `json:"packets"`
+	ChecksumFailures int    `json:"checksumFailures"`
+	InvalidPackets   int    `json:"invalidPackets"`
+	// SkippedPackets is the number of packets the decoder dropped
+	SkippedPackets int `json:"skippedPackets"`
+	// LostFrames is the number of frames missing from gaps in the frame counter
+	LostFrames int `json:"lostFrames"`
+	// SteamIDMismatches is the number of Steam packets whose embedded SteamID differs from the
+	// net message's xuid
+	SteamIDMismatches int `json:"steamIdMismatches"`
+	// DecodeError is set when the player's voice failed to decode at all
+	DecodeError string `json:"decodeError,omitempty"`
+	// Duration is the length of the decodable audio, in seconds
+	Duration float64 `json:"duration"`
+	// VoicedDuration is the part of Duration decoded from real voice data, in seconds
+	VoicedDuration float64 `json:"voicedDuration"`
+}
+
+// VerifyResult summarizes the integrity of a demo's voice data.
+type VerifyResult struct {
+	Demo             string           `json:"demo"`
+	Packets          int              `json:"packets"`
+	ChecksumFailures int              `json:"checksumFailures"`
+	InvalidPackets   int              `json:"invalidPackets"`
+	DecodeErrors     int              `json:"decodeErrors"`
+	Players          []VerifiedPlayer `json:"players"`
+	// Passed is true when no threshold in VerifyLimits was exceeded
+	Passed bool `json:"passed"`
+	// Failures describes each threshold that was exceeded
+	Failures []string `json:"failures,omitempty"`
+}
+
+// VerifyVoiceData runs the decode pipeline over every player's voice in memory, writing no
+// files, and checks the result against limits. Each Steam packet is parsed on its own so that
+// checksum failures are counted individually, then the player's voice is decoded as
+// ExtractVoiceData would. The demo is loaded as for extraction (honouring the cache), and
+// PlayerIDs, IncludeBots, SortBy, LossConcealment, MaxConcealedFrames, TargetSampleRate and Gain apply; output options are ignored.
+func VerifyVoiceData(ctx context.Context, opts ExtractOptions, limits VerifyLimits) (*VerifyResult, error) {
+	if err := opts.applyDefaults(); err != nil {
+		return nil, err
+	}
+	if err := validateDecodeOptions(opts); err != nil {
+		return nil, err
+	}
+	if err := decoder.CheckOpus(); err != nil {
+		return nil, err
+	}
+
+	demo, err := loadDemo(ctx, opts, opts.Metrics)
+	if err != nil {
+		return nil, err
+	}
+
+	playerFilter := make(map[string]bool)
+	for _, id := range opts.PlayerIDs {
+		playerFilter[id] = true
+	}
+
+	ids := make([]string, 0, len(demo.VoiceData))
+	for id := range demo.VoiceData {
+		if len(playerFilter) > 0 && !playerFilter[id] {
+			continue
+		}
+		if demo.Bots[id] && !opts.IncludeBots {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sortPlayerIDs(ids, opts.SortBy, demo, false)
+
+	result := &VerifyResult{Demo: opts.DemoPath, Players: []VerifiedPlayer{}}
+	for _, id := range ids {
+		if err := ctx.Err(); err != nil {
+			return nil, fmt.Errorf("verification was cancelled: %w", err)
+		}
+
+		payloads, formats := demo.VoiceData[id], demo.PacketFormats[id]
+		player := VerifiedPlayer{Player: id, Name: demo.playerName(id, false), Packets: len(payloads)}
+
+		for i, payload := range payloads {
+			if i >= len(formats) || formats[i] != voiceFormatSteam {
+				continue
+			}
+			if _, err := voicepacket.DecodeChunk(payload); errors.Is(err, voicepacket.ErrMismatchChecksum) {
+				player.ChecksumFailures++
+			} else if err != nil {
+				player.InvalidPackets++
+			}
+		}
+
+		_, decoded, err := decodePlayerVoice(id, payloads, formats, demo.SampleRates[id], opts)
+		// A player with no audio, e.g. only silence, decoded without failing
+		if err != nil && !errors.Is(err, ErrNoAudio) {
+			player.DecodeError = err.Error()
+			result.DecodeErrors++
+		} else {
+			player.SkippedPackets = decoded.Stats.SkippedPackets
+			player.LostFrames = decoded.Stats.LostFrames
+			player.SteamIDMismatches = decoded.Stats.SteamIDMismatches
+			player.Duration = decoded.Duration.Seconds()
+			player.VoicedDuration = decoded.VoicedDuration.Seconds()
+			result.DecodeErrors += decoded.Stats.SkippedPackets
+		}
+		slog.Debug("Verified player voice", "player", id, "packets", player.Packets,
+			"checksumFailures", player.ChecksumFailures, "invalidPackets", player.InvalidPackets, "decodeError", player.DecodeError)
+
+		result.Packets += player.Packets
+		result.ChecksumFailures += player.ChecksumFailures
+		result.InvalidPackets += player.InvalidPackets
+		result.Players = append(result.Players, player)
+	}
+
+	if result.ChecksumFailures > limits.MaxChecksumFailures {
+		result.Failures = append(result.Failures, fmt.Sprintf("%d checksum failures (allowed: %d)", result.ChecksumFailures, limits.MaxChecksumFailures))
+	}
+	if result.InvalidPackets > limits.MaxInvalidPackets {
+		result.Failures = append(result.Failures, fmt.Sprintf("%d invalid packets (allowed: %d)", result.InvalidPackets, limits.MaxInvalidPackets))
+	}
+	if result.DecodeErrors > limits.MaxDecodeErrors {
+		result.Failures = append(result.Failures, fmt.Sprintf("%d decode errors (allowed: %d)", result.DecodeErrors, limits.MaxDecodeErrors))
+	}
+	result.Passed = len(result.Failures) == 0
+	return result, nil
+}
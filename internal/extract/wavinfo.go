@@ -0,0 +1,56 @@
+package extract
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// wavInfo is the provenance written to a WAV file's LIST/INFO chunk.
+type wavInfo struct {
+	// Player is the SteamID64, or user ID when keyed by user ID
+	Player string
+	// Name is the player's display name, if known
+	Name string
+	// Demo is the demo's file name
+	Demo string
+	// Extracted is when the extraction started
+	Extracted time.Time
+}
+
+// tags returns the INFO tags for info in the order they are written: INAM (title) and IART
+// (artist) for players' media libraries, ICRD for the extraction date, and ICMT (comment) with
+// every field as key=value pairs for tools that parse it.
+func (info wavInfo) tags() [][2]string {
+	artist := info.Name
+	if artist == "" {
+		artist = info.Player
+	}
+	extracted := info.Extracted.UTC().Format(time.RFC3339)
+	return [][2]string{
+		{"INAM", fmt.Sprintf("%s - %s", artist, info.Demo)},
+		{"IART", artist},
+		{"ICRD", extracted},
+		{"ICMT", fmt.Sprintf("player=%s; name=%s; demo=%s; extracted=%s", info.Player, info.Name, info.Demo, extracted)},
+	}
+}
+
+// appendWavInfo appends a LIST/INFO chunk describing where the audio came from to the finished
+// WAV file at path, so the file stays self-describing when separated from the extraction's other
+// outputs. Text is written as null-terminated strings; line breaks are replaced by spaces.
+func appendWavInfo(path string, info wavInfo) error {
+	var list bytes.Buffer
+	list.WriteString("INFO")
+	for _, tag := range info.tags() {
+		value := strings.NewReplacer("\r", " ", "\n", " ", "\x00", "").Replace(tag[1])
+		writeRIFFChunk(&list, tag[0], append([]byte(value), 0))
+	}
+
+	var chunk bytes.Buffer
+	writeRIFFChunk(&chunk, "LIST", list.Bytes())
+	if err := appendRIFFChunks(path, chunk.Bytes()); err != nil {
+		return fmt.Errorf("failed to append WAV info: %w", err)
+	}
+	return nil
+}
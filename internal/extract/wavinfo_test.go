@@ -0,0 +1,74 @@
+package extract
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// infoTags reads the tags of the LIST/INFO chunk in a WAV file's chunks.
+func infoTags(t *testing.T, chunks []riffChunk) map[string]string {
+	t.Helper()
+	for _, chunk := range chunks {
+		if chunk.ID != "LIST" || !strings.HasPrefix(string(chunk.Data), "INFO") {
+			continue
+		}
+		tags := map[string]string{}
+		// The INFO subchunks share the RIFF chunk layout, after the list type
+		for _, tag := range splitChunks(t, chunk.Data[4:]) {
+			tags[tag.ID] = strings.TrimRight(string(tag.Data), "\x00")
+		}
+		return tags
+	}
+	t.Fatal("no LIST/INFO chunk")
+	return nil
+}
+
+func TestAppendWavInfo(t *testing.T) {
+	info := wavInfo{
+		Player:    "76561198000000001",
+		Name:      "two\nlines",
+		Demo:      "match.dem",
+		Extracted: time.Date(2024, 5, 1, 12, 30, 0, 0, time.FixedZone("CEST", 2*60*60)),
+	}
+	want := map[string]string{
+		"INAM": "two lines - match.dem",
+		"IART": "two lines",
+		"ICRD": "2024-05-01T10:30:00Z",
+		"ICMT": "player=76561198000000001; name=two lines; demo=match.dem; extracted=2024-05-01T10:30:00Z",
+	}
+
+	// 24-bit mono with an odd sample count leaves the data chunk at an odd length
+	for _, samples := range []int{4, 5} {
+		path := filepath.Join(t.TempDir(), "player.wav")
+		if err := writeWav(path, make([]int, samples), defaultSteamSampleRate, 24, WAVEncoderNative); err != nil {
+			t.Fatalf("writeWav: %v", err)
+		}
+		if err := appendWavInfo(path, info); err != nil {
+			t.Fatalf("appendWavInfo: %v", err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		chunks := riffChunks(t, data)
+		if len(chunks) != 3 || chunks[0].ID != "fmt " || chunks[1].ID != "data" {
+			t.Fatalf("%d samples: chunks %v, want fmt, data and LIST", samples, chunks)
+		}
+		if got := len(chunks[1].Data); got != samples*3 {
+			t.Errorf("%d samples: data chunk is %d bytes, want %d", samples, got, samples*3)
+		}
+		tags := infoTags(t, chunks)
+		for id, value := range want {
+			if tags[id] != value {
+				t.Errorf("%d samples: %s = %q, want %q", samples, id, tags[id], value)
+			}
+		}
+		if len(tags) != len(want) {
+			t.Errorf("%d samples: got tags %v, want %v", samples, tags, want)
+		}
+	}
+}
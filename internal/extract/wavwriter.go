@@ -0,0 +1,65 @@
+package extract
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// WAV encoders selectable with ExtractOptions.WAVEncoder
+const (
+	// WAVEncoderGoAudio encodes with the go-audio/wav package
+	WAVEncoderGoAudio = "go-audio"
+	// WAVEncoderNative writes the RIFF, fmt and data chunks directly
+	WAVEncoderNative = "native"
+)
+
+// wavFormatPCM is the fmt chunk format tag for integer PCM (WAVE_FORMAT_PCM), written by both
+// encoders. Output is never IEEE float (WAVE_FORMAT_IEEE_FLOAT, 3), even at 32 bits.
+const wavFormatPCM = 1
+
+// encodeWavNative writes integer PCM samples as a mono WAV file to w without go-audio. All sizes
+// are known up front, so the header is written first and w need not be seekable. Samples are
+// written little-endian at bitDepth bits, truncated to that width; they must already be in
+// range (see fullScaleValue). The layout matches what go-audio produces.
+func encodeWavNative(w io.Writer, pcm []int, sampleRate, bitDepth int) error {
+	bytesPerSample := bitDepth / 8
+	blockAlign := defaultNumChannels * bytesPerSample
+	dataSize := len(pcm) * bytesPerSample
+
+	bw := bufio.NewWriter(w)
+	header := []any{
+		[4]byte{'R', 'I', 'F', 'F'},
+		uint32(4 + 8 + 16 + 8 + dataSize), // "WAVE", fmt chunk, data chunk header and samples
+		[4]byte{'W', 'A', 'V', 'E'},
+		[4]byte{'f', 'm', 't', ' '},
+		uint32(16),
+		uint16(wavFormatPCM),
+		uint16(defaultNumChannels),
+		uint32(sampleRate),
+		uint32(sampleRate * blockAlign),
+		uint16(blockAlign),
+		uint16(bitDepth),
+		[4]byte{'d', 'a', 't', 'a'},
+		uint32(dataSize),
+	}
+	for _, field := range header {
+		if err := binary.Write(bw, binary.LittleEndian, field); err != nil {
+			return fmt.Errorf("failed to write WAV header: %w", err)
+		}
+	}
+
+	sample := make([]byte, 4)
+	for _, v := range pcm {
+		binary.LittleEndian.PutUint32(sample, uint32(v))
+		if _, err := bw.Write(sample[:bytesPerSample]); err != nil {
+			return fmt.Errorf("failed to write WAV data: %w", err)
+		}
+	}
+
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("failed to write WAV data: %w", err)
+	}
+	return nil
+}
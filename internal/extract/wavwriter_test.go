@@ -0,0 +1,132 @@
+package extract
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/go-audio/wav"
+)
+
+// riffChunk is one chunk of a RIFF file, as read back by riffChunks.
+type riffChunk struct {
+	ID   string
+	Data []byte
+}
+
+// riffChunks splits a RIFF/WAVE file into its top-level chunks, in order.
+func riffChunks(t *testing.T, data []byte) []riffChunk {
+	t.Helper()
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+		t.Fatalf("not a RIFF/WAVE file: % x", data[:min(len(data), 12)])
+	}
+	if size := binary.LittleEndian.Uint32(data[4:]); int(size) != len(data)-8 {
+		t.Errorf("RIFF size = %d, want %d", size, len(data)-8)
+	}
+	return splitChunks(t, data[12:])
+}
+
+// splitChunks splits data into consecutive RIFF chunks.
+func splitChunks(t *testing.T, data []byte) []riffChunk {
+	t.Helper()
+	var chunks []riffChunk
+	for rest := data; len(rest) > 0; {
+		if len(rest) < 8 {
+			t.Fatalf("truncated chunk header: % x", rest)
+		}
+		size := int(binary.LittleEndian.Uint32(rest[4:]))
+		if len(rest) < 8+size {
+			t.Fatalf("chunk %q is %d bytes, only %d left", rest[:4], size, len(rest)-8)
+		}
+		chunks = append(chunks, riffChunk{ID: string(rest[:4]), Data: rest[8 : 8+size]})
+		// Odd chunks are padded to an even length, though a last data chunk often is not
+		rest = rest[min(len(rest), 8+size+size%2):]
+	}
+	return chunks
+}
+
+// testWavPCM returns samples spanning the full range of bitDepth.
+func testWavPCM(bitDepth int) []int {
+	fullScale := fullScaleValue(bitDepth)
+	return []int{0, fullScale, -fullScale, fullScale / 2, -fullScale / 3, 1, -1}
+}
+
+func TestWriteWavBitDepths(t *testing.T) {
+	for _, encoder := range []string{WAVEncoderGoAudio, WAVEncoderNative} {
+		for _, bitDepth := range []int{16, 24, 32} {
+			t.Run(fmt.Sprintf("%s %d-bit", encoder, bitDepth), func(t *testing.T) {
+				path := filepath.Join(t.TempDir(), "player.wav")
+				pcm := testWavPCM(bitDepth)
+				if err := writeWav(path, pcm, defaultSteamSampleRate, bitDepth, encoder); err != nil {
+					t.Fatalf("writeWav: %v", err)
+				}
+
+				file, err := os.Open(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer file.Close()
+				dec := wav.NewDecoder(file)
+				buf, err := dec.FullPCMBuffer()
+				if err != nil {
+					t.Fatalf("reading back: %v", err)
+				}
+				if int(dec.BitDepth) != bitDepth || int(dec.SampleRate) != defaultSteamSampleRate || int(dec.NumChans) != defaultNumChannels {
+					t.Errorf("header: %d bits, %d Hz, %d channels; want %d bits, %d Hz, %d channel",
+						dec.BitDepth, dec.SampleRate, dec.NumChans, bitDepth, defaultSteamSampleRate, defaultNumChannels)
+				}
+				if !slices.Equal(buf.Data, pcm) {
+					t.Errorf("samples read back as %v, want %v", buf.Data, pcm)
+				}
+				fullScale := fullScaleValue(bitDepth)
+				for i, v := range buf.Data {
+					if v > fullScale || v < -fullScale {
+						t.Errorf("sample %d = %d, outside ±%d", i, v, fullScale)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestNativeWavMatchesGoAudio(t *testing.T) {
+	for _, bitDepth := range []int{16, 24, 32} {
+		pcm := append(testWavPCM(bitDepth), intPCMReference(testPackets(1, 480)[0], float32(fullScaleValue(bitDepth)))...)
+		var goAudio, native memWriteSeeker
+		if err := encodeWav(&goAudio, pcm, defaultSteamSampleRate, bitDepth, WAVEncoderGoAudio); err != nil {
+			t.Fatalf("%d-bit go-audio: %v", bitDepth, err)
+		}
+		if err := encodeWav(&native, pcm, defaultSteamSampleRate, bitDepth, WAVEncoderNative); err != nil {
+			t.Fatalf("%d-bit native: %v", bitDepth, err)
+		}
+		if !bytes.Equal(native.buf, goAudio.buf) {
+			t.Errorf("%d-bit: native output (%d bytes) differs from go-audio's (%d bytes)", bitDepth, len(native.buf), len(goAudio.buf))
+		}
+	}
+}
+
+func TestWavFormatTagIsPCM(t *testing.T) {
+	for _, encoder := range []string{WAVEncoderGoAudio, WAVEncoderNative} {
+		for _, bitDepth := range []int{16, 24, 32} {
+			var out memWriteSeeker
+			if err := encodeWav(&out, testWavPCM(bitDepth), defaultSteamSampleRate, bitDepth, encoder); err != nil {
+				t.Fatalf("%s %d-bit: %v", encoder, bitDepth, err)
+			}
+			chunks := riffChunks(t, out.buf)
+			if len(chunks) == 0 || chunks[0].ID != "fmt " || len(chunks[0].Data) < 16 {
+				t.Fatalf("%s %d-bit: first chunk is not a fmt chunk: %+v", encoder, bitDepth, chunks)
+			}
+			// The format tag is the first field of the fmt chunk; 3 would mean IEEE float
+			if tag := binary.LittleEndian.Uint16(chunks[0].Data); tag != 1 {
+				t.Errorf("%s %d-bit: format tag = %d, want 1 (integer PCM)", encoder, bitDepth, tag)
+			}
+			if bits := binary.LittleEndian.Uint16(chunks[0].Data[14:]); int(bits) != bitDepth {
+				t.Errorf("%s %d-bit: bits per sample = %d", encoder, bitDepth, bits)
+			}
+		}
+	}
+}
@@ -0,0 +1,338 @@
+package extract
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// playerWriter writes decoded players to their outputs for one extraction: audio files or
+// OutputWriter, and what each output adds to the result, playlist, timeline, manifest and resume
+// manifest. Players decoded concurrently may be written at the same time, each into their own
+// playerOutputs.
+type playerWriter struct {
+	opts     ExtractOptions
+	demo     *parsedDemo
+	metrics  Metrics
+	bitDepth int
+
+	// tempDir holds intermediate WAV files for converted formats, or is empty when none are needed
+	tempDir string
+
+	// resume is the manifest of completed outputs when resuming, or nil
+	resume *resumeManifest
+	// resumeMu serializes updates to the resume manifest from players written concurrently
+	resumeMu sync.Mutex
+
+	// start is when the extraction started, recorded in WAV info
+	start time.Time
+}
+
+// pipeConversion reports whether output in format is converted by piping audio through ffmpeg
+// instead of going through a WAV file.
+func pipeConversion(opts ExtractOptions, format string) bool {
+	return opts.PipeFFmpeg && pipeMuxers[format] != ""
+}
+
+// nativeEncode reports whether output in format is encoded straight from the decoded samples.
+func nativeEncode(opts ExtractOptions, format string) bool {
+	return format == "ogg" && opts.OggEncoder == OggEncoderNative
+}
+
+// needsTempWav reports whether output in format is converted from a temporary WAV file.
+func needsTempWav(opts ExtractOptions, format string) bool {
+	return format != "wav" && !pipeConversion(opts, format) && !nativeEncode(opts, format)
+}
+
+// spurts finds the talk-spurts in a decoded player's audio, written to outputPath.
+func (w *playerWriter) spurts(p decodedPlayer, outputPath string) []timelineSpurt {
+	if w.opts.VAD == nil {
+		return detectSpurts(p.id, outputPath, p.packetTimes, p.result)
+	}
+	pcm := make([]float32, len(p.pcm))
+	for i, v := range p.pcm {
+		pcm[i] = float32(v) / float32(fullScaleValue(w.bitDepth))
+	}
+	segments := w.opts.VAD(pcm, p.result.SampleRate)
+	return segmentSpurts(p.id, outputPath, p.packetTimes, p.result, segments)
+}
+
+// writeFile writes one output file from decoded audio and converts it if needed, adding the
+// time taken to out. It reports whether the file was written.
+func (w *playerWriter) writeFile(p decodedPlayer, out *playerOutputs) bool {
+	writeStart := time.Now()
+
+	// Write the output under a staging name and only rename it into place once complete,
+	// so a crash or failed encode never leaves a partial file at the final path
+	stagedPath, err := stageOutput(p.finalOutputPath)
+	if err != nil {
+		slog.Error("Failed to create output file", "player", p.id, "error", err)
+		w.metrics.Inc(MetricDecodeErrors, 1)
+		return false
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			os.Remove(stagedPath)
+		}
+	}()
+
+	// For WAV format the staged file is the WAV itself
+	wavPath := p.tempWavPath
+	if p.format == "wav" {
+		wavPath = stagedPath
+	}
+
+	// Generate the WAV file (either temporary or the staged output for WAV format), unless it is
+	// piped to ffmpeg or the format is encoded natively
+	if !pipeConversion(w.opts, p.format) && !nativeEncode(w.opts, p.format) {
+		if err := writeWav(wavPath, p.pcm, p.result.SampleRate, w.bitDepth, w.opts.WAVEncoder); err != nil {
+			slog.Error("Failed to write WAV file", "player", p.id, "error", err)
+			w.metrics.Inc(MetricDecodeErrors, 1)
+			return false
+		}
+
+		if w.opts.PacketCues {
+			if err := appendCueRegions(wavPath, packetCueRegions(p.result.PacketOffsets, p.result.Samples)); err != nil {
+				slog.Warn("Failed to write packet cues", "player", p.id, "error", err)
+			}
+		}
+		if w.opts.WAVInfo && p.format == "wav" {
+			info := wavInfo{
+				Player:    p.id,
+				Name:      displayName(w.demo.playerName(p.id, w.opts.KeyByUserID)),
+				Demo:      filepath.Base(w.opts.DemoPath),
+				Extracted: w.start,
+			}
+			if err := appendWavInfo(wavPath, info); err != nil {
+				slog.Warn("Failed to write WAV info", "player", p.id, "error", err)
+			}
+		}
+	}
+
+	playerDecode := p.decodeTime + time.Since(writeStart)
+	out.decodeTime += playerDecode
+	slog.Debug("Decoded player audio", "player", p.id, "duration", playerDecode)
+	slog.Debug("Decode diagnostics",
+		"player", p.id,
+		"frames", p.result.Stats.Frames,
+		"lostFrames", p.result.Stats.LostFrames,
+		"plcFrames", p.result.Stats.PLCFrames,
+		"silenceFrames", p.result.Stats.SilenceFrames,
+		"skippedPackets", p.result.Stats.SkippedPackets,
+		"steamIDMismatches", p.result.Stats.SteamIDMismatches)
+
+	// Convert to the desired format if needed
+	// If format is wav, we've already written the final file - no conversion needed
+	if p.format != "wav" {
+		convertStart := time.Now()
+		if nativeEncode(w.opts, p.format) {
+			err = writeOggOpus(stagedPath, p.pcm, p.result.SampleRate, fullScaleValue(w.bitDepth))
+		} else if pipeConversion(w.opts, p.format) {
+			err = convertPCMViaPipe(p.pcm, p.result.SampleRate, w.bitDepth, w.opts.WAVEncoder, stagedPath, p.format, w.opts.FFmpegExtraArgs)
+		} else {
+			err = convertAudioToFormat(p.tempWavPath, stagedPath, p.format, w.opts.FFmpegExtraArgs)
+		}
+		playerConvert := time.Since(convertStart)
+		out.convertTime += playerConvert
+		slog.Debug("Converted player audio", "player", p.id, "duration", playerConvert)
+		if err != nil {
+			slog.Error("Failed to convert audio format", "player", p.id, "format", p.format, "error", err)
+			w.metrics.Inc(MetricDecodeErrors, 1)
+			return false
+		}
+	}
+
+	if err := commitOutput(stagedPath, p.finalOutputPath, w.opts.FileMode); err != nil {
+		slog.Error("Failed to write output file", "player", p.id, "path", p.finalOutputPath, "error", err)
+		w.metrics.Inc(MetricDecodeErrors, 1)
+		return false
+	}
+	committed = true
+	if info, err := os.Stat(p.finalOutputPath); err == nil {
+		w.metrics.Inc(MetricBytesWritten, info.Size())
+	}
+	return true
+}
+
+// streamOutput encodes one output as WAV in memory, since the encoder patches the header sizes
+// after the samples, and copies it to OutputWriter. It reports whether the output was written.
+func (w *playerWriter) streamOutput(p decodedPlayer, out *playerOutputs) bool {
+	writeStart := time.Now()
+	wavData := &memWriteSeeker{}
+	err := encodeWav(wavData, p.pcm, p.result.SampleRate, w.bitDepth, w.opts.WAVEncoder)
+	out.decodeTime += p.decodeTime + time.Since(writeStart)
+	if err == nil {
+		_, err = w.opts.OutputWriter.Write(wavData.buf)
+	}
+	if err != nil {
+		slog.Error("Failed to write WAV output", "player", p.id, "error", err)
+		w.metrics.Inc(MetricDecodeErrors, 1)
+		return false
+	}
+	w.metrics.Inc(MetricBytesWritten, int64(len(wavData.buf)))
+	return true
+}
+
+// writeOutput writes one output, to a file or OutputWriter, and records it in out.
+func (w *playerWriter) writeOutput(p decodedPlayer, out *playerOutputs) {
+	if w.opts.OutputWriter != nil {
+		if !w.streamOutput(p, out) {
+			return
+		}
+	} else if !w.writeFile(p, out) {
+		return
+	}
+
+	slog.Debug("Audio file created successfully", "player", p.id, "path", p.finalOutputPath, "duration", p.result.Duration)
+	w.metrics.Inc(MetricPlayersExtracted, 1)
+	name := w.demo.playerName(p.id, w.opts.KeyByUserID)
+	display := displayName(name)
+	title := p.id
+	if display != "" {
+		title = display
+	}
+	if p.clip > 0 {
+		title = fmt.Sprintf("%s #%d", title, p.clip)
+	}
+	if w.opts.PerRound {
+		title = fmt.Sprintf("%s round %d", title, p.round)
+	}
+	out.playlist = append(out.playlist, playlistEntry{Path: p.finalOutputPath, Title: title, Duration: p.result.Duration})
+	file := ExtractedFile{
+		Player:         p.id,
+		UserID:         sourceUserID(w.demo.PacketUserIDs[p.id]),
+		Name:           name,
+		DisplayName:    display,
+		Path:           p.finalOutputPath,
+		Duration:       p.result.Duration.Seconds(),
+		VoicedDuration: p.result.VoicedDuration.Seconds(),
+		SampleRate:     p.result.SampleRate,
+		Preview:        w.opts.Preview > 0,
+	}
+	if p.id != mixPlayerID {
+		file.SteamIDMismatches = p.result.Stats.SteamIDMismatches
+	}
+	file.Clip = p.clip
+	file.Round = p.round
+	file.Start = p.start.Seconds()
+	out.files = append(out.files, file)
+	if w.opts.Timeline {
+		out.timeline = append(out.timeline, w.spurts(p, p.finalOutputPath)...)
+	}
+	if w.opts.Manifest {
+		entry := manifestEntry{
+			Name:     name,
+			File:     p.finalOutputPath,
+			Format:   p.format,
+			Duration: p.result.Duration.Seconds(),
+			Packets:  p.packets,
+		}
+		if p.id != mixPlayerID {
+			entry.VoiceFormat = voiceFormat(w.demo.PacketFormats[p.id])
+		}
+		switch {
+		case p.id == mixPlayerID:
+		case w.opts.KeyByUserID:
+			// The key is a user ID; the packets carry the SteamID
+			entry.SteamID = resolveSourceID(p.id, w.demo.VoiceData[p.id], w.demo.PacketFormats[p.id])
+		default:
+			entry.SteamID = p.id
+		}
+		out.manifest = append(out.manifest, entry)
+	}
+
+	if w.resume != nil {
+		w.resumeMu.Lock()
+		err := w.resume.record(p.finalOutputPath, p.id, p.outputHash)
+		w.resumeMu.Unlock()
+		if err != nil {
+			slog.Warn("Failed to update resume manifest", "error", err)
+		}
+	}
+}
+
+// writePlayer writes a decoded player's audio as one file, compacted or not, or one file per talk-spurt.
+func (w *playerWriter) writePlayer(p decodedPlayer, out *playerOutputs) {
+	if w.opts.CompactTimeline {
+		compacted := compactBySpurt(p, w.spurts(p, ""), w.opts.CompactGap, fullScaleValue(w.bitDepth))
+		slog.Debug("Compacted player audio to its talk-spurts", "player", p.id,
+			"duration", p.result.Duration, "compactedDuration", compacted.result.Duration)
+		w.writeOutput(compacted, out)
+		return
+	}
+	if w.opts.PerRound {
+		parts := splitByRound(p, w.demo.Rounds, w.opts.RoundFreezeTime)
+		slog.Debug("Split player audio by round", "player", p.id, "rounds", len(parts))
+		for _, part := range parts {
+			if _, err := os.Stat(part.finalOutputPath); err == nil && !w.opts.ForceOverwrite {
+				slog.Warn("File already exists, skipping", "path", part.finalOutputPath)
+				continue
+			}
+			w.writeOutput(part, out)
+		}
+		return
+	}
+	if !w.opts.SplitBySpurt {
+		w.writeOutput(p, out)
+		return
+	}
+	clips := splitBySpurt(p, w.spurts(p, ""), w.opts.MinDuration)
+	slog.Debug("Split player audio by talk-spurt", "player", p.id, "clips", len(clips))
+	for _, clip := range clips {
+		if _, err := os.Stat(clip.finalOutputPath); err == nil && !w.opts.ForceOverwrite {
+			slog.Warn("File already exists, skipping", "path", clip.finalOutputPath)
+			continue
+		}
+		w.writeOutput(clip, out)
+	}
+}
+
+// writeMix writes the decoded players mixed into one file, recorded in out.
+func (w *playerWriter) writeMix(players []decodedPlayer, out *playerOutputs) {
+	mix := decodedPlayer{
+		id:              mixPlayerID,
+		format:          w.opts.Format,
+		finalOutputPath: filepath.Join(w.opts.OutputDir, mixPlayerID+"."+w.opts.Format),
+	}
+	if w.opts.Format != "wav" {
+		mix.tempWavPath = filepath.Join(w.tempDir, mixPlayerID+".wav")
+	}
+	if w.opts.Preview > 0 {
+		mix.finalOutputPath = previewPath(mix.finalOutputPath)
+	}
+	if w.opts.OutputFile != "" {
+		mix.finalOutputPath = w.opts.OutputFile
+	}
+	if w.opts.OutputWriter != nil {
+		mix.finalOutputPath = writerOutputPath
+	}
+	if _, err := os.Stat(mix.finalOutputPath); err == nil && !w.opts.ForceOverwrite && w.opts.OutputWriter == nil {
+		slog.Warn("File already exists, skipping", "path", mix.finalOutputPath)
+		return
+	}
+
+	mix.pcm, mix.start = mixPlayers(players, w.opts.TargetSampleRate, fullScaleValue(w.bitDepth))
+	if len(mix.pcm) == 0 {
+		slog.Debug("No talk-spurts to mix")
+		return
+	}
+	mix.result = decodeResult{
+		SampleRate: w.opts.TargetSampleRate,
+		Samples:    len(mix.pcm) / defaultNumChannels,
+		Duration:   samplesDuration(len(mix.pcm), w.opts.TargetSampleRate, defaultNumChannels),
+	}
+	for _, p := range players {
+		mix.result.VoicedDuration += p.result.VoicedDuration
+		mix.result.Stats.Add(p.result.Stats)
+		mix.packets += p.packets
+		mix.decodeTime += p.decodeTime
+	}
+	// Overlapping speech counts once in the mix's length
+	mix.result.VoicedDuration = min(mix.result.VoicedDuration, mix.result.Duration)
+	slog.Debug("Mixed player audio", "players", len(players), "start", mix.start, "duration", mix.result.Duration)
+	w.writeOutput(mix, out)
+}
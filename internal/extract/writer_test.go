@@ -0,0 +1,69 @@
+package extract
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// dirNames lists the names of the entries in dir.
+func dirNames(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("reading %s: %v", dir, err)
+	}
+	names := make([]string, len(entries))
+	for i, entry := range entries {
+		names[i] = entry.Name()
+	}
+	return names
+}
+
+func TestWriteFileLeavesNoPartialOutput(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		format string
+		// tempWav is where a converted format's intermediate WAV goes, relative to the temp dir
+		tempWav   string
+		ffmpegArg string
+		written   bool
+	}{
+		{"wav written", "wav", "", "", true},
+		{"intermediate WAV fails", "flac", filepath.Join("missing", "player.wav"), "", false},
+		{"conversion fails", "flac", "player.wav", "-not-an-ffmpeg-option", false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			outputDir, tempDir := t.TempDir(), t.TempDir()
+			finalPath := filepath.Join(outputDir, "player."+tt.format)
+			opts := ExtractOptions{Format: tt.format, WAVEncoder: WAVEncoderNative, FileMode: FilePermissions}
+			if tt.ffmpegArg != "" {
+				opts.FFmpegExtraArgs = []string{tt.ffmpegArg}
+			}
+			w := &playerWriter{opts: opts, demo: &parsedDemo{}, metrics: noopMetrics{}, bitDepth: 16, tempDir: tempDir}
+			p := decodedPlayer{
+				id:              "player",
+				pcm:             []int{0, 1000, -1000, 0},
+				result:          decodeResult{SampleRate: defaultSteamSampleRate, Samples: 4},
+				finalOutputPath: finalPath,
+				format:          tt.format,
+			}
+			if tt.tempWav != "" {
+				p.tempWavPath = filepath.Join(tempDir, tt.tempWav)
+			}
+
+			if got := w.writeFile(p, &playerOutputs{}); got != tt.written {
+				t.Fatalf("writeFile = %v, want %v", got, tt.written)
+			}
+			want := []string{}
+			if tt.written {
+				want = []string{filepath.Base(finalPath)}
+			}
+			// The staging file is removed on failure and renamed into place on success
+			if got := dirNames(t, outputDir); !slices.Equal(got, want) {
+				t.Errorf("output directory holds %q, want %q", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,285 @@
+// Package voicepacket parses Steam and CS2 voice data packets. It is pure Go, so code that only
+// inspects packets (SteamIDs, voice types, lengths) does not pull in the cgo Opus decoder.
+package voicepacket
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+)
+
+// minimumLength is the smallest possible size of a valid voice data packet: a SteamID, a voice
+// record and the crc32, without header records.
+// This is based on the observed structure from reverse engineering the Steam voice codec.
+// See: https://zhenyangli.me/posts/reversing-steam-voice-codec/
+const (
+	minimumLength = 15
+
+	// PayloadTypeHeader is the expected value for the payload type byte that indicates Steam voice packet header
+	PayloadTypeHeader = 0x0B
+
+	// PayloadTypeExtra is a header record carrying a 16-bit value of unknown meaning, which some
+	// Steam voice packets have before or instead of the sample rate
+	PayloadTypeExtra = 0x0A
+
+	// maxHeaderRecords bounds the header records read before the voice record
+	maxHeaderRecords = 4
+
+	// VoiceTypeOpusPLC is the value for the voiceType byte indicating Opus PLC encoded voice data
+	VoiceTypeOpusPLC = 0x06
+
+	// VoiceTypeSilence is the value for the voiceType byte indicating silence
+	VoiceTypeSilence = 0x00
+
+	// VoiceTypeRaw is the value for the voiceType byte indicating uncompressed 16-bit PCM
+	VoiceTypeRaw = 0x03
+
+	// VoiceTypeSilk is the value for the voiceType byte indicating SILK encoded voice data
+	VoiceTypeSilk = 0x04
+
+	// VoiceTypeOpus is the value for the voiceType byte indicating Opus data without PLC framing
+	VoiceTypeOpus = 0x05
+
+	// steamID64IndividualBase is the first SteamID64 of the individual account range (prefix 7656)
+	steamID64IndividualBase = 76561197960265728
+
+	// steamID64IndividualSpan is the number of account IDs in the individual range
+	steamID64IndividualSpan = 1 << 32
+)
+
+// voiceTypeNames names the voiceType values known from the Steam voice codec,
+// including those that are recognized but not decoded.
+var voiceTypeNames = map[byte]string{
+	VoiceTypeSilence: "silence",
+	VoiceTypeRaw:     "raw PCM",
+	VoiceTypeSilk:    "SILK",
+	VoiceTypeOpus:    "Opus",
+	VoiceTypeOpusPLC: "Opus PLC",
+}
+
+// VoiceTypeName returns a readable name for a voiceType byte, or "unknown".
+func VoiceTypeName(voiceType byte) string {
+	if name, ok := voiceTypeNames[voiceType]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+var (
+	// ErrInsufficientData is returned when there is not enough data to parse a chunk.
+	ErrInsufficientData = errors.New("insufficient amount of data to chunk")
+	// ErrInvalidVoicePacket is returned when a voice packet does not match the expected format.
+	ErrInvalidVoicePacket = errors.New("invalid voice packet")
+	// ErrMismatchChecksum is returned when a packet's checksum does not match the computed value.
+	ErrMismatchChecksum = errors.New("mismatching voice data checksum")
+	// ErrUnsupportedVoiceType is returned for voiceType values that are known but cannot be decoded.
+	ErrUnsupportedVoiceType = errors.New("unsupported voice type")
+	// ErrImplausibleSteamID is returned alongside the parse error when a packet that fails to parse
+	// also has a SteamID outside the individual SteamID64 range, which usually means the buffer is
+	// not a little-endian Steam voice packet at all.
+	ErrImplausibleSteamID = errors.New("implausible SteamID in voice packet")
+)
+
+// isPlausibleSteamID reports whether id lies in the individual SteamID64 account range.
+func isPlausibleSteamID(id uint64) bool {
+	return id >= steamID64IndividualBase && id < steamID64IndividualBase+steamID64IndividualSpan
+}
+
+// Chunk represents a parsed voice data packet from a CS2 demo file.
+type Chunk struct {
+	SteamID    uint64
+	SampleRate uint16
+	VoiceType  byte
+	Length     uint16
+	Data       []byte
+	Checksum   uint32
+	// Extra is the value of a PayloadTypeExtra header record, if the packet has one
+	Extra uint16
+	// Layout lists the payload type of every record in the packet in order, ending with the
+	// voice type, e.g. [0x0B 0x06] for the standard layout
+	Layout []byte
+}
+
+// HasPlausibleSteamID reports whether the chunk's SteamID lies in the individual SteamID64 range.
+// Packets from bots or with placeholder IDs parse fine but fail this check.
+func (c *Chunk) HasPlausibleSteamID() bool {
+	return isPlausibleSteamID(c.SteamID)
+}
+
+// IsStandardLayout reports whether the chunk has the usual layout: the sample rate header and
+// then the voice record.
+func (c *Chunk) IsStandardLayout() bool {
+	return len(c.Layout) == 2 && c.Layout[0] == PayloadTypeHeader
+}
+
+// SilenceFrames returns the number of frames of silence a silence chunk (VoiceTypeSilence)
+// stands for, carried in its length field, or 0 for any other chunk. Each frame is 20ms.
+func (c *Chunk) SilenceFrames() int {
+	if c.VoiceType != VoiceTypeSilence {
+		return 0
+	}
+	return int(c.Length)
+}
+
+// LayoutString formats Layout for diagnostics, e.g. "0a 0b 06".
+func (c *Chunk) LayoutString() string {
+	return fmt.Sprintf("% x", c.Layout)
+}
+
+// IsHeaderRecord reports whether a payload type byte starts a header record (PayloadTypeHeader
+// or PayloadTypeExtra) rather than the voice record.
+func IsHeaderRecord(payloadType byte) bool {
+	return payloadType == PayloadTypeHeader || payloadType == PayloadTypeExtra
+}
+
+// DecodeChunk parses a raw voice data packet from a CS2 demo file.
+//
+// Packet structure (see blog for details):
+// [u64 steamID][u8 payloadType=0x0B][u16 sampleRate][u8 voiceType][u16 length][voice data][u32 crc32]
+// - steamID: Little-endian 64-bit Steam ID of the player, usually an individual SteamID64 (see HasPlausibleSteamID)
+// - payloadType: 0x0B for the sample rate header (see PayloadTypeHeader)
+// - sampleRate: Audio sample rate (typically 24000, see reverse engineering)
+// - voiceType: 0x06 for Opus PLC data, 0x03 for raw 16-bit PCM, 0x00 for silence (0x04 SILK and 0x05 Opus are recognized but unsupported)
+// - length: Length of the following voice data
+// - voice data: Opus PLC encoded data (if voiceType==0x06) or little-endian 16-bit samples (if voiceType==0x03)
+// - crc32: CRC32 checksum of all previous bytes
+//
+// Each [u8 type][u16 value] pair before the voice record is a header record. Layouts seen after
+// game updates are accepted too: a PayloadTypeExtra record before or instead of the sample rate,
+// or no header at all (SampleRate is then 0). The records found are listed in Chunk.Layout.
+//
+// For more details, see: https://zhenyangli.me/posts/reversing-steam-voice-codec/
+func DecodeChunk(b []byte) (*Chunk, error) {
+	return decodeChunk(b, false)
+}
+
+// DecodeChunkLenient parses a packet like DecodeChunk but accepts extra bytes after the crc32,
+// such as padding added by a recording tool. The checksum is still validated over the header
+// and voice data only, never the extra bytes.
+func DecodeChunkLenient(b []byte) (*Chunk, error) {
+	return decodeChunk(b, true)
+}
+
+// decodeChunk implements DecodeChunk, allowing bytes after the crc32 when lenient is set.
+// The SteamID is only a diagnostic: a packet that fails to parse and whose first 8 bytes are not
+// a plausible SteamID64 also matches ErrImplausibleSteamID, but an otherwise valid packet with an
+// unusual SteamID is returned as is.
+func decodeChunk(b []byte, lenient bool) (*Chunk, error) {
+	chunk, err := parseChunk(b, lenient)
+	if err != nil && len(b) >= 8 {
+		// Data that is not a Steam voice packet, or has the wrong byte order, rarely decodes to a real SteamID64
+		if id := binary.LittleEndian.Uint64(b); !isPlausibleSteamID(id) {
+			return nil, fmt.Errorf("%w (received %d, expected a SteamID64 starting with 7656): %w", ErrImplausibleSteamID, id, err)
+		}
+	}
+	return chunk, err
+}
+
+// parseChunk parses the fields of a voice data packet and validates its crc32.
+func parseChunk(b []byte, lenient bool) (*Chunk, error) {
+	bLen := len(b)
+
+	if bLen < minimumLength {
+		return nil, fmt.Errorf("%w (received: %d bytes, expected at least %d bytes)", ErrInsufficientData, bLen, minimumLength)
+	}
+
+	chunk := &Chunk{}
+
+	buf := bytes.NewBuffer(b)
+
+	if err := binary.Read(buf, binary.LittleEndian, &chunk.SteamID); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInsufficientData, err)
+	}
+
+	// Header records come first; the first other payload type is the voice record
+	for {
+		var payloadType byte
+		if err := binary.Read(buf, binary.LittleEndian, &payloadType); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInsufficientData, err)
+		}
+		chunk.Layout = append(chunk.Layout, payloadType)
+		if !IsHeaderRecord(payloadType) {
+			chunk.VoiceType = payloadType
+			break
+		}
+		if len(chunk.Layout) > maxHeaderRecords {
+			return nil, fmt.Errorf("%w (more than %d header records: %s)", ErrInvalidVoicePacket, maxHeaderRecords, chunk.LayoutString())
+		}
+
+		var value uint16
+		if err := binary.Read(buf, binary.LittleEndian, &value); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInsufficientData, err)
+		}
+		if payloadType == PayloadTypeHeader {
+			chunk.SampleRate = value
+		} else {
+			chunk.Extra = value
+		}
+	}
+	voiceType := chunk.VoiceType
+
+	if err := binary.Read(buf, binary.LittleEndian, &chunk.Length); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInsufficientData, err)
+	}
+
+	switch voiceType {
+	case VoiceTypeOpusPLC, VoiceTypeRaw:
+		// Opus PLC encoded voice data, or uncompressed 16-bit PCM (see decoder.DecodeRawPCM)
+		remaining := buf.Len()
+		chunkLen := int(chunk.Length)
+
+		if remaining < chunkLen {
+			return nil, fmt.Errorf("%w (received: %d bytes, expected at least %d bytes)", ErrInsufficientData, bLen, (bLen + (chunkLen - remaining)))
+		}
+
+		data := make([]byte, chunkLen)
+		n, err := buf.Read(data)
+
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInsufficientData, err)
+		}
+
+		if n != chunkLen {
+			return nil, fmt.Errorf("%w (expected to read %d bytes, but read %d bytes)", ErrInsufficientData, chunkLen, n)
+		}
+
+		chunk.Data = data
+	case VoiceTypeSilence:
+		// Silence frame (no data)
+		// The length field is the number of silence frames
+		// chunk.Data remains empty
+	case VoiceTypeSilk, VoiceTypeOpus:
+		// Recognized subtypes that the decoder cannot handle
+		return nil, fmt.Errorf("%w: %s (voice type 0x%x, only Opus PLC, raw PCM and silence are decoded)", ErrUnsupportedVoiceType, VoiceTypeName(voiceType), voiceType)
+	default:
+		if len(chunk.Layout) == 1 {
+			// Neither a header nor a voice record, so most likely not a Steam voice packet at all
+			return nil, fmt.Errorf("%w (received %x, expected %x)", ErrInvalidVoicePacket, voiceType, PayloadTypeHeader)
+		}
+		return nil, fmt.Errorf("%w (expected 0x6, 0x3 or 0x0 voice data, received %x after %s)", ErrInvalidVoicePacket, voiceType, chunk.LayoutString())
+	}
+
+	remaining := buf.Len()
+
+	if remaining < 4 || (!lenient && remaining != 4) {
+		return nil, fmt.Errorf("%w (has %d bytes remaining, expected 4 bytes remaining)", ErrInvalidVoicePacket, remaining)
+	}
+
+	// The crc32 covers everything from the SteamID through the voice data, which ends where the
+	// checksum starts; any bytes after the checksum (lenient mode) are not part of it
+	checksumStart := bLen - remaining
+
+	if err := binary.Read(buf, binary.LittleEndian, &chunk.Checksum); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInsufficientData, err)
+	}
+
+	actualChecksum := crc32.ChecksumIEEE(b[:checksumStart])
+
+	if chunk.Checksum != actualChecksum {
+		return nil, fmt.Errorf("%w (received %x, expected %x)", ErrMismatchChecksum, chunk.Checksum, actualChecksum)
+	}
+
+	return chunk, nil
+}
@@ -0,0 +1,131 @@
+package voicepacket
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"testing"
+)
+
+// testSteamID is a SteamID64 in the individual account range.
+const testSteamID = 76561198000000001
+
+// buildPacket assembles a Steam voice packet in the standard layout, with a valid crc32.
+func buildPacket(steamID uint64, sampleRate uint16, voiceType byte, length uint16, data []byte) []byte {
+	b := binary.LittleEndian.AppendUint64(nil, steamID)
+	b = append(b, PayloadTypeHeader)
+	b = binary.LittleEndian.AppendUint16(b, sampleRate)
+	b = append(b, voiceType)
+	b = binary.LittleEndian.AppendUint16(b, length)
+	b = append(b, data...)
+	return binary.LittleEndian.AppendUint32(b, crc32.ChecksumIEEE(b))
+}
+
+func TestDecodeChunkSilence(t *testing.T) {
+	// The length field of a silence packet is a frame count, with no voice data after it
+	packet := buildPacket(testSteamID, 24000, VoiceTypeSilence, 5, nil)
+
+	chunk, err := DecodeChunk(packet)
+	if err != nil {
+		t.Fatalf("DecodeChunk: %v", err)
+	}
+	if len(chunk.Data) != 0 {
+		t.Errorf("Data has %d bytes, want none", len(chunk.Data))
+	}
+	if got := chunk.SilenceFrames(); got != 5 {
+		t.Errorf("SilenceFrames() = %d, want 5", got)
+	}
+	if chunk.SteamID != testSteamID || chunk.SampleRate != 24000 {
+		t.Errorf("SteamID, SampleRate = %d, %d, want %d, 24000", chunk.SteamID, chunk.SampleRate, uint64(testSteamID))
+	}
+}
+
+func TestDecodeChunkSteamIDIsADiagnostic(t *testing.T) {
+	raw := []byte{0x10, 0x00, 0xf0, 0xff}
+
+	for _, tt := range []struct {
+		name          string
+		steamID       uint64
+		wantPlausible bool
+	}{
+		{"individual SteamID64", testSteamID, true},
+		{"bot or placeholder", 0, false},
+		{"outside the individual range", 90071992547409920, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			// A well-formed packet parses whatever its SteamID
+			chunk, err := DecodeChunk(buildPacket(tt.steamID, 24000, VoiceTypeRaw, uint16(len(raw)), raw))
+			if err != nil {
+				t.Fatalf("DecodeChunk: %v", err)
+			}
+			if chunk.SteamID != tt.steamID || chunk.HasPlausibleSteamID() != tt.wantPlausible {
+				t.Errorf("SteamID %d, HasPlausibleSteamID() = %v; want %d, %v", chunk.SteamID, chunk.HasPlausibleSteamID(), tt.steamID, tt.wantPlausible)
+			}
+
+			// A malformed one also reports the SteamID when it is implausible
+			_, err = DecodeChunk(buildPacket(tt.steamID, 24000, 0x7f, 0, nil))
+			if !errors.Is(err, ErrInvalidVoicePacket) {
+				t.Fatalf("unknown voice type: err = %v, want ErrInvalidVoicePacket", err)
+			}
+			if errors.Is(err, ErrImplausibleSteamID) == tt.wantPlausible {
+				t.Errorf("unknown voice type: errors.Is(err, ErrImplausibleSteamID) = %v, want %v", !tt.wantPlausible, !tt.wantPlausible)
+			}
+		})
+	}
+}
+
+func TestDecodeChunkRejectsTamperedPackets(t *testing.T) {
+	data := []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06}
+	packet := buildPacket(testSteamID, 24000, VoiceTypeOpusPLC, uint16(len(data)), data)
+	if _, err := DecodeChunk(packet); err != nil {
+		t.Fatalf("untampered packet: %v", err)
+	}
+
+	for _, tt := range []struct {
+		name string
+		// offset is the byte to flip, counted from the end of the packet
+		offset int
+	}{
+		{"voice data byte", 4 + len(data)/2},
+		{"stored crc32 byte", 2},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			tampered := bytes.Clone(packet)
+			tampered[len(tampered)-tt.offset] ^= 0x01
+			if _, err := DecodeChunk(tampered); !errors.Is(err, ErrMismatchChecksum) {
+				t.Errorf("err = %v, want ErrMismatchChecksum", err)
+			}
+		})
+	}
+}
+
+func TestDecodeChunkLenientChecksumSpan(t *testing.T) {
+	data := []byte{0x01, 0x02, 0x03, 0x04}
+	packet := buildPacket(testSteamID, 24000, VoiceTypeOpusPLC, uint16(len(data)), data)
+	want := binary.LittleEndian.Uint32(packet[len(packet)-4:])
+	padded := append(bytes.Clone(packet), 0xde, 0xad, 0xbe, 0xef, 0x00)
+
+	if _, err := DecodeChunk(padded); !errors.Is(err, ErrInvalidVoicePacket) {
+		t.Errorf("DecodeChunk with trailing bytes: err = %v, want ErrInvalidVoicePacket", err)
+	}
+
+	// The crc32 covers the SteamID through the voice data, not the stored checksum or the padding
+	chunk, err := DecodeChunkLenient(padded)
+	if err != nil {
+		t.Fatalf("DecodeChunkLenient: %v", err)
+	}
+	if chunk.Checksum != want || !bytes.Equal(chunk.Data, data) {
+		t.Errorf("Checksum %x, Data %x; want %x, %x", chunk.Checksum, chunk.Data, want, data)
+	}
+
+	// Changing the padding does not matter, but changing the covered bytes does
+	padded[len(padded)-1] ^= 0xff
+	if _, err := DecodeChunkLenient(padded); err != nil {
+		t.Errorf("DecodeChunkLenient after changing the padding: %v", err)
+	}
+	padded[len(packet)-5] ^= 0xff
+	if _, err := DecodeChunkLenient(padded); !errors.Is(err, ErrMismatchChecksum) {
+		t.Errorf("DecodeChunkLenient after changing the voice data: err = %v, want ErrMismatchChecksum", err)
+	}
+}
@@ -0,0 +1,76 @@
+// Package voice decodes the voice chat of CS2 demos to PCM in memory, for programs that embed
+// the extractor instead of running the cs2voice command. Nothing is written to disk.
+package voice
+
+import (
+	"context"
+	"io"
+
+	"github.com/DiskMethod/cs2-voice-tools/internal/extract"
+)
+
+// Errors returned by Extract, for use with errors.Is.
+var (
+	// ErrNoVoiceData means the demo has no voice messages at all
+	ErrNoVoiceData = extract.ErrNoVoiceData
+	// ErrNoDecodableVoice means every player's voice failed to decode
+	ErrNoDecodableVoice = extract.ErrNoDecodableVoice
+)
+
+// PlayerAudio is one player's decoded voice.
+type PlayerAudio struct {
+	// SteamID is the SteamID64 of the player
+	SteamID string
+	// Name is the player's in-game name at the end of the demo, empty when unknown
+	Name string
+	// SampleRate is the rate of PCM in Hz: Options.SampleRate when set, otherwise the rate the
+	// player's voice was recorded at
+	SampleRate int
+	// PCM is mono audio with full scale at ±1. Pauses between transmissions are not included
+	PCM []float32
+}
+
+// Options tunes Extract. The zero value decodes every real player at the rate their voice was
+// recorded at.
+type Options struct {
+	// Players limits decoding to these SteamID64s; empty decodes everyone
+	Players []string
+	// IncludeBots also decodes voice from bots and SourceTV
+	IncludeBots bool
+	// SampleRate decodes every player at this rate: 8000, 12000, 16000, 24000 or 48000
+	// (zero keeps each player's own rate)
+	SampleRate int
+	// Jobs is the number of players decoded at the same time (zero means one per CPU)
+	Jobs int
+}
+
+// Extract reads a demo from r and decodes every player's voice, keyed by SteamID64. The demo
+// may be gzip or bzip2 compressed. r is read once and not closed.
+func Extract(r io.Reader) (map[string]*PlayerAudio, error) {
+	return ExtractContext(context.Background(), r, Options{})
+}
+
+// ExtractContext is Extract with options and a context that cancels parsing and decoding.
+func ExtractContext(ctx context.Context, r io.Reader, opts Options) (map[string]*PlayerAudio, error) {
+	decoded, err := extract.DecodeVoiceData(ctx, extract.ExtractOptions{
+		Source:           extract.ReaderSource{Reader: r},
+		PlayerIDs:        opts.Players,
+		IncludeBots:      opts.IncludeBots,
+		TargetSampleRate: opts.SampleRate,
+		Jobs:             opts.Jobs,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	players := make(map[string]*PlayerAudio, len(decoded))
+	for _, p := range decoded {
+		players[p.Player] = &PlayerAudio{
+			SteamID:    p.Player,
+			Name:       p.Name,
+			SampleRate: p.SampleRate,
+			PCM:        p.PCM,
+		}
+	}
+	return players, nil
+}
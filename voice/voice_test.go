@@ -0,0 +1,71 @@
+package voice
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// blockingReader signals when it is first read, then blocks until release is closed.
+type blockingReader struct {
+	reading chan struct{}
+	release chan struct{}
+	err     error
+}
+
+func (r *blockingReader) Read(p []byte) (int, error) {
+	close(r.reading)
+	<-r.release
+	return 0, r.err
+}
+
+type errReader struct{ err error }
+
+func (r errReader) Read(p []byte) (int, error) { return 0, r.err }
+
+func TestExtractContextConcurrentReadersAreIndependent(t *testing.T) {
+	errFirst := errors.New("first demo")
+	errSecond := errors.New("second demo")
+
+	first := &blockingReader{reading: make(chan struct{}), release: make(chan struct{}), err: errFirst}
+	firstDone := make(chan error, 1)
+	go func() {
+		_, err := ExtractContext(context.Background(), first, Options{})
+		firstDone <- err
+	}()
+
+	select {
+	case <-first.reading:
+	case err := <-firstDone:
+		t.Fatalf("first extraction returned before reading its demo: %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("first extraction never read its demo")
+	}
+
+	// The second call must not wait on, or share the result of, the first one still in flight
+	secondDone := make(chan error, 1)
+	go func() {
+		_, err := ExtractContext(context.Background(), errReader{err: errSecond}, Options{})
+		secondDone <- err
+	}()
+	select {
+	case err := <-secondDone:
+		if !errors.Is(err, errSecond) {
+			t.Errorf("second extraction error = %v, want %v", err, errSecond)
+		}
+	case <-time.After(5 * time.Second):
+		close(first.release)
+		t.Fatal("second extraction waited for the first")
+	}
+
+	close(first.release)
+	select {
+	case err := <-firstDone:
+		if !errors.Is(err, errFirst) {
+			t.Errorf("first extraction error = %v, want %v", err, errFirst)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("first extraction did not finish")
+	}
+}